@@ -36,7 +36,7 @@ func generateAnalogFrame(duration int, loc *time.Location, headers bool, showSec
 		)
 	}
 
-	elements = append(elements, drawClockCircle(centerX, centerY, clockRadius)...)
+	elements = append(elements, Element{Type: "circle", X: centerX, Y: centerY, Radius: clockRadius})
 
 	if showRoman {
 		elements = append(elements, drawRomanNumerals(centerX, centerY, clockRadius)...)
@@ -71,43 +71,6 @@ func generateAnalogFrame(duration int, loc *time.Location, headers bool, showSec
 	}
 }
 
-func drawClockCircle(cx, cy, radius int) []Element {
-	elements := []Element{}
-
-	x := radius
-	y := 0
-	err := 1 - radius
-
-	for x >= y {
-
-		points := [][2]int{
-			{cx + x, cy + y}, {cx - x, cy + y},
-			{cx + x, cy - y}, {cx - x, cy - y},
-			{cx + y, cy + x}, {cx - y, cy + x},
-			{cx + y, cy - x}, {cx - y, cy - x},
-		}
-		for _, p := range points {
-			elements = append(elements, Element{
-				Type:   "line",
-				X:      p[0],
-				Y:      p[1],
-				Width:  1,
-				Height: 1,
-			})
-		}
-
-		y++
-		if err < 0 {
-			err += 2*y + 1
-		} else {
-			x--
-			err += 2*(y-x) + 1
-		}
-	}
-
-	return elements
-}
-
 func drawHourMarkers(cx, cy, radius int) []Element {
 	elements := []Element{}
 
@@ -123,7 +86,7 @@ func drawHourMarkers(cx, cy, radius int) []Element {
 		x2 := cx + int(outerRadius*math.Cos(radians))
 		y2 := cy + int(outerRadius*math.Sin(radians))
 
-		elements = append(elements, drawLine(x1, y1, x2, y2)...)
+		elements = append(elements, Element{Type: "segment", X1: x1, Y1: y1, X2: x2, Y2: y2})
 	}
 
 	return elements
@@ -183,7 +146,7 @@ func drawRomanNumerals(cx, cy, radius int) []Element {
 		x2 := cx + int(outerRadius*math.Cos(radians))
 		y2 := cy + int(outerRadius*math.Sin(radians))
 
-		elements = append(elements, drawLine(x1, y1, x2, y2)...)
+		elements = append(elements, Element{Type: "segment", X1: x1, Y1: y1, X2: x2, Y2: y2})
 	}
 
 	return elements
@@ -199,7 +162,7 @@ func drawClockHand(cx, cy int, angleDegrees float64, length, thickness int) []El
 
 	if thickness <= 1 {
 
-		elements = append(elements, drawLine(cx, cy, endX, endY)...)
+		elements = append(elements, Element{Type: "segment", X1: cx, Y1: cy, X2: endX, Y2: endY})
 	} else {
 
 		perpAngle := radians + math.Pi/2
@@ -214,60 +177,9 @@ func drawClockHand(cx, cy int, angleDegrees float64, length, thickness int) []El
 			x2 := endX + offsetX
 			y2 := endY + offsetY
 
-			elements = append(elements, drawLine(x1, y1, x2, y2)...)
+			elements = append(elements, Element{Type: "segment", X1: x1, Y1: y1, X2: x2, Y2: y2})
 		}
 	}
 
 	return elements
 }
-
-func drawLine(x1, y1, x2, y2 int) []Element {
-	elements := []Element{}
-
-	dx := abs(x2 - x1)
-	dy := abs(y2 - y1)
-	sx := 1
-	sy := 1
-
-	if x1 > x2 {
-		sx = -1
-	}
-	if y1 > y2 {
-		sy = -1
-	}
-
-	err := dx - dy
-
-	for {
-		elements = append(elements, Element{
-			Type:   "line",
-			X:      x1,
-			Y:      y1,
-			Width:  1,
-			Height: 1,
-		})
-
-		if x1 == x2 && y1 == y2 {
-			break
-		}
-
-		e2 := 2 * err
-		if e2 > -dy {
-			err -= dy
-			x1 += sx
-		}
-		if e2 < dx {
-			err += dx
-			y1 += sy
-		}
-	}
-
-	return elements
-}
-
-func abs(x int) int {
-	if x < 0 {
-		return -x
-	}
-	return x
-}
@@ -103,15 +103,13 @@ func generateBCDFrame(duration int, loc *time.Location, headers bool, hourMode24
 			cx := colX[col] + ledRadius
 			cy := startY + row*(ledDiameter+ledSpacing) + ledRadius
 
-			isOn := bcd[col][row]
-
-			if isOn {
-
-				elements = append(elements, drawFilledCircle(cx, cy, ledRadius)...)
-			} else {
-
-				elements = append(elements, drawHollowCircle(cx, cy, ledRadius)...)
-			}
+			elements = append(elements, Element{
+				Type:   "circle",
+				X:      cx,
+				Y:      cy,
+				Radius: ledRadius,
+				Filled: bcd[col][row],
+			})
 		}
 	}
 
@@ -122,88 +120,3 @@ func generateBCDFrame(duration int, loc *time.Location, headers bool, hourMode24
 		Elements: elements,
 	}
 }
-
-func drawFilledCircle(cx, cy, r int) []Element {
-	elements := []Element{}
-
-	for dy := -r; dy <= r; dy++ {
-
-		dySq := dy * dy
-		rSq := r * r
-		if dySq > rSq {
-			continue
-		}
-
-		dx := 0
-		for (dx+1)*(dx+1) <= rSq-dySq {
-			dx++
-		}
-
-		if dx >= 0 {
-			width := dx*2 + 1
-			x := cx - dx
-			y := cy + dy
-			elements = append(elements, Element{
-				Type:   "line",
-				X:      x,
-				Y:      y,
-				Width:  width,
-				Height: 1,
-			})
-		}
-	}
-
-	return elements
-}
-
-func drawHollowCircle(cx, cy, r int) []Element {
-	elements := []Element{}
-
-	if r <= 2 {
-
-		elements = append(elements,
-			Element{Type: "line", X: cx, Y: cy - r, Width: 1, Height: 1},
-			Element{Type: "line", X: cx, Y: cy + r, Width: 1, Height: 1},
-			Element{Type: "line", X: cx - r, Y: cy, Width: 1, Height: 1},
-			Element{Type: "line", X: cx + r, Y: cy, Width: 1, Height: 1},
-			Element{Type: "line", X: cx - 1, Y: cy - r + 1, Width: 1, Height: 1},
-			Element{Type: "line", X: cx + 1, Y: cy - r + 1, Width: 1, Height: 1},
-			Element{Type: "line", X: cx - 1, Y: cy + r - 1, Width: 1, Height: 1},
-			Element{Type: "line", X: cx + 1, Y: cy + r - 1, Width: 1, Height: 1},
-		)
-		return elements
-	}
-
-	x := r
-	y := 0
-	err := 1 - r
-
-	for x >= y {
-
-		points := [][2]int{
-			{cx + x, cy + y}, {cx - x, cy + y},
-			{cx + x, cy - y}, {cx - x, cy - y},
-			{cx + y, cy + x}, {cx - y, cy + x},
-			{cx + y, cy - x}, {cx - y, cy - x},
-		}
-		for _, p := range points {
-			elements = append(elements, Element{
-				Type:   "line",
-				X:      p[0],
-				Y:      p[1],
-				Width:  1,
-				Height: 1,
-			})
-		}
-
-		y++
-		if err < 0 {
-			err += 2*y + 1
-		} else {
-			x--
-			err += 2*(y-x) + 1
-		}
-	}
-
-	return elements
-}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	configHistoryFile = "config_history.json"
+	maxConfigHistory  = 20
+)
+
+// noteConfigChange queues change descriptions for the next history
+// snapshot; every save made until then shares them. The caller must hold
+// mutex.
+func noteConfigChange(changes ...string) {
+	pendingConfigChanges = append(pendingConfigChanges, changes...)
+}
+
+// historyConfig strips what a snapshot must not roll back: Spotify
+// credentials (the refresh token rotates) and the cached moon phase, which
+// changes on its own and would otherwise fill the history.
+func historyConfig(config PersistentConfig) PersistentConfig {
+	config.SpotifyClientID = ""
+	config.SpotifyClientSecret = ""
+	config.SpotifyRefreshToken = ""
+	config.MoonPhaseData = MoonPhaseData{}
+	return config
+}
+
+// appendConfigHistory records a saved config unless it matches the latest
+// snapshot, trimming the history to maxConfigHistory. It returns a copy of
+// the history to persist, or nil when nothing was added. The caller must
+// hold mutex.
+func appendConfigHistory(config PersistentConfig, now time.Time) []ConfigSnapshot {
+	config = historyConfig(config)
+	changes := pendingConfigChanges
+	pendingConfigChanges = nil
+
+	if n := len(configHistory); n > 0 && sameConfig(configHistory[n-1].Config, config) {
+		return nil
+	}
+	if len(changes) == 0 {
+		changes = []string{"settings saved"}
+	}
+
+	configHistoryCounter++
+	configHistory = append(configHistory, ConfigSnapshot{
+		ID:        configHistoryCounter,
+		Timestamp: now,
+		Changes:   changes,
+		Config:    config,
+	})
+	if len(configHistory) > maxConfigHistory {
+		configHistory = append([]ConfigSnapshot(nil), configHistory[len(configHistory)-maxConfigHistory:]...)
+	}
+	return append([]ConfigSnapshot(nil), configHistory...)
+}
+
+// sameConfig compares configs by their JSON form, so a snapshot read back
+// from disk matches the live config it was taken from.
+func sameConfig(a, b PersistentConfig) bool {
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aJSON) == string(bJSON)
+}
+
+func loadConfigHistory() {
+	data, err := os.ReadFile(configHistoryFile)
+	if err != nil {
+		return
+	}
+	var history []ConfigSnapshot
+	if err := json.Unmarshal(data, &history); err != nil {
+		log.Printf("Error decoding %s: %v, starting a new history", configHistoryFile, err)
+		return
+	}
+
+	mutex.Lock()
+	configHistory = history
+	for _, snap := range history {
+		if snap.ID > configHistoryCounter {
+			configHistoryCounter = snap.ID
+		}
+	}
+	mutex.Unlock()
+
+	log.Printf("Loaded %d config snapshots", len(history))
+}
+
+// seedConfigHistory records the config loaded at startup when there is no
+// history yet, so the first change made on a fresh deploy can be undone.
+func seedConfigHistory() {
+	mutex.Lock()
+	if len(configHistory) > 0 {
+		mutex.Unlock()
+		return
+	}
+	noteConfigChange("loaded at startup")
+	history := appendConfigHistory(snapshotConfig(), time.Now())
+	mutex.Unlock()
+
+	if history != nil {
+		writeConfigHistory(history)
+	}
+}
+
+func writeConfigHistory(history []ConfigSnapshot) {
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		log.Printf("Error encoding config history: %v", err)
+		return
+	}
+	tempFile := configHistoryFile + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0600); err != nil {
+		log.Printf("Error writing config history: %v", err)
+		return
+	}
+	if err := os.Rename(tempFile, configHistoryFile); err != nil {
+		log.Printf("Error renaming config history: %v", err)
+		os.Remove(tempFile)
+	}
+}
+
+// findSnapshot looks a snapshot up by ID. The caller must hold mutex.
+func findSnapshot(id int) (ConfigSnapshot, bool) {
+	for _, snap := range configHistory {
+		if snap.ID == id {
+			return snap, true
+		}
+	}
+	return ConfigSnapshot{}, false
+}
+
+// snapshotParam resolves a snapshot ID parameter, where "current" means the
+// live config. The caller must hold mutex.
+func snapshotParam(value string) (PersistentConfig, error) {
+	if value == "current" {
+		return historyConfig(snapshotConfig()), nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return PersistentConfig{}, fmt.Errorf("snapshot id %q must be a number or \"current\"", value)
+	}
+	snap, ok := findSnapshot(id)
+	if !ok {
+		return PersistentConfig{}, fmt.Errorf("snapshot %d not found", id)
+	}
+	return snap.Config, nil
+}
+
+// flattenJSON maps every leaf of a decoded JSON value to its path, such as
+// "cycleItems[2].text".
+func flattenJSON(prefix string, value interface{}, out map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 && prefix != "" {
+			out[prefix] = v
+		}
+		for key, child := range v {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flattenJSON(path, child, out)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			out[prefix] = v
+		}
+		for i, child := range v {
+			flattenJSON(fmt.Sprintf("%s[%d]", prefix, i), child, out)
+		}
+	default:
+		out[prefix] = v
+	}
+}
+
+// diffConfigs lists every path whose value differs between two configs.
+func diffConfigs(from, to PersistentConfig) []ConfigDiffEntry {
+	flatten := func(config PersistentConfig) map[string]interface{} {
+		var generic interface{}
+		data, _ := json.Marshal(config)
+		json.Unmarshal(data, &generic)
+		out := make(map[string]interface{})
+		flattenJSON("", generic, out)
+		return out
+	}
+	before, after := flatten(from), flatten(to)
+
+	paths := make(map[string]bool, len(before)+len(after))
+	for path := range before {
+		paths[path] = true
+	}
+	for path := range after {
+		paths[path] = true
+	}
+
+	diff := []ConfigDiffEntry{}
+	for path := range paths {
+		oldValue, inOld := before[path]
+		newValue, inNew := after[path]
+		if inOld && inNew && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		entry := ConfigDiffEntry{Path: path, From: oldValue, To: newValue}
+		switch {
+		case !inOld:
+			entry.Op = "added"
+		case !inNew:
+			entry.Op = "removed"
+		default:
+			entry.Op = "changed"
+		}
+		diff = append(diff, entry)
+	}
+	sort.Slice(diff, func(i, j int) bool { return diff[i].Path < diff[j].Path })
+	return diff
+}
+
+func handleConfigHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	type historyEntry struct {
+		ID        int       `json:"id"`
+		Timestamp time.Time `json:"timestamp"`
+		Changes   []string  `json:"changes"`
+	}
+
+	mutex.Lock()
+	list := make([]historyEntry, 0, len(configHistory))
+	for i := len(configHistory) - 1; i >= 0; i-- {
+		snap := configHistory[i]
+		list = append(list, historyEntry{ID: snap.ID, Timestamp: snap.Timestamp, Changes: snap.Changes})
+	}
+	mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"snapshots": list})
+}
+
+func handleConfigHistoryDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	toParam := query.Get("to")
+	if toParam == "" {
+		toParam = "current"
+	}
+	mutex.Lock()
+	from, err := snapshotParam(query.Get("from"))
+	if err != nil {
+		mutex.Unlock()
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := snapshotParam(toParam)
+	mutex.Unlock()
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":    query.Get("from"),
+		"to":      toParam,
+		"changes": diffConfigs(from, to),
+	})
+}
+
+func handleConfigHistoryRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ID int `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mutex.Lock()
+	snap, ok := findSnapshot(req.ID)
+	mutex.Unlock()
+	if !ok {
+		jsonError(w, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	// Snapshots taken before an upgrade go through the same migrations as
+	// config.json.
+	data, err := json.Marshal(snap.Config)
+	if err != nil {
+		jsonError(w, "Failed to read snapshot", http.StatusInternalServerError)
+		return
+	}
+	config, _, err := decodeConfig(data)
+	if err != nil {
+		jsonError(w, "Snapshot cannot be restored: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mutex.Lock()
+	applyConfig(config)
+	if loc, err := time.LoadLocation(timezoneName); err == nil {
+		displayLocation = loc
+	}
+	noteConfigChange(fmt.Sprintf("restored snapshot %d", snap.ID))
+	settings := currentSettings()
+	mutex.Unlock()
+
+	invalidateRenderCache()
+	go saveConfig()
+	go fetchWeather()
+	publishEvent("settings", settings)
+
+	log.Printf("⏪ Config restored from snapshot %d (%s)", snap.ID, snap.Timestamp.Format(time.RFC3339))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "restored", "id": snap.ID})
+}
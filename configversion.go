@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// currentConfigVersion is the schemaVersion written to config.json and
+// exports. Files without a schemaVersion are version 1.
+const currentConfigVersion = 2
+
+const maxConfigImportBytes = 8 << 20
+
+// configMigrations[v] upgrades a raw config from version v to v+1. Each
+// step works on the decoded JSON object so it can rename, add or reshape
+// keys that PersistentConfig no longer describes.
+var configMigrations = map[int]func(raw map[string]interface{}){
+	// Version 2 added deviceOverrides, profiles, activeProfile, nightMode
+	// and asset-backed cycle items. All of them are optional and a v1 file
+	// has none, so there is nothing to convert; the step only bumps the
+	// version.
+	1: func(raw map[string]interface{}) {},
+}
+
+// rawConfigVersion reads schemaVersion from a raw config, treating a
+// missing one as version 1.
+func rawConfigVersion(raw map[string]interface{}) (int, error) {
+	value, ok := raw["schemaVersion"]
+	if !ok {
+		return 1, nil
+	}
+	v, ok := value.(float64)
+	if !ok || v != float64(int(v)) || v < 1 {
+		return 0, fmt.Errorf("schemaVersion must be a positive integer")
+	}
+	return int(v), nil
+}
+
+// migrateConfig upgrades a raw config in place to currentConfigVersion and
+// returns the version it started from.
+func migrateConfig(raw map[string]interface{}) (int, error) {
+	from, err := rawConfigVersion(raw)
+	if err != nil {
+		return 0, err
+	}
+	if from > currentConfigVersion {
+		return from, fmt.Errorf("schemaVersion %d is newer than this server supports (%d)", from, currentConfigVersion)
+	}
+	for v := from; v < currentConfigVersion; v++ {
+		migrate, ok := configMigrations[v]
+		if !ok {
+			return from, fmt.Errorf("no migration from schema version %d", v)
+		}
+		migrate(raw)
+	}
+	raw["schemaVersion"] = currentConfigVersion
+	return from, nil
+}
+
+// decodeConfig migrates and decodes a config file or export.
+func decodeConfig(data []byte) (PersistentConfig, int, error) {
+	config, _, from, err := decodeConfigRaw(data)
+	return config, from, err
+}
+
+func decodeConfigRaw(data []byte) (PersistentConfig, map[string]interface{}, int, error) {
+	var config PersistentConfig
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return config, nil, 0, err
+	}
+	if raw == nil {
+		return config, nil, 0, fmt.Errorf("config must be a JSON object")
+	}
+	from, err := migrateConfig(raw)
+	if err != nil {
+		return config, raw, from, err
+	}
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return config, raw, from, err
+	}
+	if err := json.Unmarshal(migrated, &config); err != nil {
+		return config, raw, from, err
+	}
+	return config, raw, from, nil
+}
+
+// configKeys lists the JSON keys PersistentConfig understands.
+func configKeys() map[string]bool {
+	keys := make(map[string]bool)
+	t := reflect.TypeOf(PersistentConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}
+
+// validateConfig checks every field of an imported config and reports all
+// problems rather than stopping at the first.
+func validateConfig(config PersistentConfig, raw map[string]interface{}) []ConfigFieldError {
+	var errs []ConfigFieldError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, ConfigFieldError{Field: field, Error: fmt.Sprintf(format, args...)})
+	}
+
+	known := configKeys()
+	var unknown []string
+	for key := range raw {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		add(key, "unknown field")
+	}
+
+	if config.FrameDuration < 50 || config.FrameDuration > 5000 {
+		add("frameDuration", "must be between 50 and 5000")
+	}
+	if config.EspRefreshDuration < 500 || config.EspRefreshDuration > 30000 {
+		add("espRefreshDuration", "must be between 500 and 30000")
+	}
+	if config.GifFps < 0 || config.GifFps > 30 {
+		add("gifFps", "must be between 0 and 30")
+	}
+	if config.DisplayRotation != 0 && config.DisplayRotation != 2 {
+		add("displayRotation", "must be 0 or 2")
+	}
+	if len(config.CycleItems) == 0 {
+		add("cycleItems", "must not be empty")
+	} else if err := validateCycleItems(config.CycleItems); err != nil {
+		add("cycleItems", "%v", err)
+	}
+	if config.CycleItemCounter < 0 {
+		add("cycleItemCounter", "must not be negative")
+	}
+	if config.CityLat < -90 || config.CityLat > 90 {
+		add("cityLat", "must be between -90 and 90")
+	}
+	if config.CityLng < -180 || config.CityLng > 180 {
+		add("cityLng", "must be between -180 and 180")
+	}
+	if config.TimezoneName == "" {
+		add("timezoneName", "is required")
+	} else if _, err := time.LoadLocation(config.TimezoneName); err != nil {
+		add("timezoneName", "unknown timezone %q", config.TimezoneName)
+	}
+	if config.LedBrightness < 0 || config.LedBrightness > 100 {
+		add("ledBrightness", "must be between 0 and 100")
+	}
+	validModes := map[string]bool{"auto": true, "static": true, "flash": true, "pulse": true, "rainbow": true}
+	if !validModes[config.LedEffectMode] {
+		add("ledEffectMode", "invalid mode %q", config.LedEffectMode)
+	}
+	if len(config.LedCustomColor) != 7 || config.LedCustomColor[0] != '#' {
+		add("ledCustomColor", "must be in #RRGGBB format")
+	}
+	if config.LedFlashSpeed < 100 || config.LedFlashSpeed > 2000 {
+		add("ledFlashSpeed", "must be between 100 and 2000")
+	}
+	if config.LedPulseSpeed < 500 || config.LedPulseSpeed > 3000 {
+		add("ledPulseSpeed", "must be between 500 and 3000")
+	}
+	validScales := map[string]bool{"compact": true, "normal": true, "large": true}
+	if !validScales[config.DisplayScale] {
+		add("displayScale", "invalid scale %q", config.DisplayScale)
+	}
+	if config.PomodoroWorkDuration < 60 || config.PomodoroWorkDuration > 3600 {
+		add("pomodoroWorkDuration", "must be between 60 and 3600")
+	}
+	if config.PomodoroBreakDuration < 60 || config.PomodoroBreakDuration > 1800 {
+		add("pomodoroBreakDuration", "must be between 60 and 1800")
+	}
+	if config.PomodoroLongBreak < 300 || config.PomodoroLongBreak > 2700 {
+		add("pomodoroLongBreak", "must be between 300 and 2700")
+	}
+	if config.PomodoroCyclesUntil < 2 || config.PomodoroCyclesUntil > 8 {
+		add("pomodoroCyclesUntil", "must be between 2 and 8")
+	}
+
+	ids := make([]string, 0, len(config.DeviceOverrides))
+	for id := range config.DeviceOverrides {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		field := "deviceOverrides." + id
+		if !isValidDeviceID(id) {
+			add(field, "invalid device id")
+		} else if err := validateDeviceOverrides(config.DeviceOverrides[id]); err != nil {
+			add(field, "%v", err)
+		}
+	}
+
+	if config.NightMode != nil {
+		if err := validateNightMode(*config.NightMode); err != nil {
+			add("nightMode", "%v", err)
+		}
+	}
+
+	names := make(map[string]bool, len(config.Profiles))
+	for i, p := range config.Profiles {
+		field := fmt.Sprintf("profiles[%d]", i)
+		if err := validateProfile(p); err != nil {
+			add(field, "%v", err)
+		} else if names[p.Name] {
+			add(field, "duplicate name %q", p.Name)
+		}
+		names[p.Name] = true
+	}
+	if config.ActiveProfile != "" && !names[config.ActiveProfile] {
+		add("activeProfile", "no profile named %q", config.ActiveProfile)
+	}
+	return errs
+}
+
+func handleConfigExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	mutex.Lock()
+	config := snapshotConfig()
+	mutex.Unlock()
+
+	if r.URL.Query().Get("secrets") != "true" {
+		config.SpotifyClientID = ""
+		config.SpotifyClientSecret = ""
+		config.SpotifyRefreshToken = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"esp-desk-config.json\"")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(config)
+}
+
+func handleConfigImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigImportBytes))
+	if err != nil {
+		jsonError(w, "Config too large or unreadable", http.StatusBadRequest)
+		return
+	}
+
+	config, raw, from, err := decodeConfigRaw(data)
+	var errs []ConfigFieldError
+	if err != nil {
+		var typeErr *json.UnmarshalTypeError
+		field := ""
+		switch {
+		case errors.As(err, &typeErr):
+			field = typeErr.Field
+		case raw != nil:
+			field = "schemaVersion"
+		}
+		errs = []ConfigFieldError{{Field: field, Error: err.Error()}}
+	} else {
+		errs = validateConfig(config, raw)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":  "Config is invalid",
+			"status": http.StatusBadRequest,
+			"errors": errs,
+		})
+		return
+	}
+
+	response := map[string]interface{}{
+		"status":        "valid",
+		"fromVersion":   from,
+		"schemaVersion": currentConfigVersion,
+	}
+	if r.URL.Query().Get("dryRun") == "true" {
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	mutex.Lock()
+	applyConfig(config)
+	if loc, err := time.LoadLocation(timezoneName); err == nil {
+		displayLocation = loc
+	}
+	noteConfigChange(fmt.Sprintf("config imported (schema version %d)", from))
+	settings := currentSettings()
+	mutex.Unlock()
+
+	invalidateRenderCache()
+	go saveConfig()
+	go fetchWeather()
+	publishEvent("settings", settings)
+
+	log.Printf("📥 Config imported (schema version %d -> %d, %d cycle items)", from, currentConfigVersion, len(config.CycleItems))
+	response["status"] = "imported"
+	json.NewEncoder(w).Encode(response)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 )
@@ -53,10 +54,6 @@ func handleCustomText(w http.ResponseWriter, r *http.Request) {
 		req.Duration = 5000
 	}
 
-	mutex.Lock()
-	isCustomMode = true
-	isGifMode = false
-
 	var elements []Element
 
 	charCount := len([]rune(req.Text))
@@ -145,14 +142,25 @@ func handleCustomText(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	frames = finalFrames
-	index = 0
+	mutex.Lock()
+	setDisplayFrames(resolveDevice(r), finalFrames, false, CustomSource{
+		Type: "text",
+		Params: map[string]interface{}{
+			"text": req.Text, "x": req.X, "y": req.Y, "size": req.Size,
+			"centered": req.Centered, "framed": req.Framed, "large": req.Large,
+			"inverted": req.Inverted, "duration": req.Duration,
+		},
+	})
 	mutex.Unlock()
 
 	log.Printf("📝 Custom text: centered=%v, framed=%v, large=%v, inverted=%v", req.Centered, req.Framed, req.Large, req.Inverted)
 
+	response := map[string]interface{}{"success": true, "frameCount": 1}
+	if _, clipped := rasterizeFrame(Frame{Elements: elements}); len(clipped) > 0 {
+		response["clipped"] = clipped
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "frameCount": 1})
+	json.NewEncoder(w).Encode(response)
 }
 
 func handleMarquee(w http.ResponseWriter, r *http.Request) {
@@ -162,131 +170,112 @@ func handleMarquee(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Text      string `json:"text"`
-		Y         int    `json:"y"`
-		Size      int    `json:"size"`
-		Speed     int    `json:"speed"`
-		Direction string `json:"direction"`
-		Loops     int    `json:"loops"`
-		MaxFrames int    `json:"maxFrames"`
-		Framed    bool   `json:"framed"`
+		Text      string        `json:"text"`
+		Y         int           `json:"y"`
+		Size      int           `json:"size"`
+		Speed     int           `json:"speed"`
+		Direction string        `json:"direction"`
+		Lines     []MarqueeLine `json:"lines"`
+		Mode      string        `json:"mode"`
+		Pause     *int          `json:"pause"`
+		MaxFrames int           `json:"maxFrames"`
+		Framed    bool          `json:"framed"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		jsonError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if req.Size == 0 {
-		req.Size = 2
-	}
-	if req.Speed == 0 {
-		req.Speed = 3
+	if req.Mode == "" {
+		req.Mode = marqueeLoop
 	}
-	if req.Y == 0 {
-		req.Y = 25
-	}
-	if req.Direction == "" {
-		req.Direction = "left"
+	validModes := map[string]bool{marqueeLoop: true, marqueePingPong: true, marqueePause: true}
+	if !validModes[req.Mode] {
+		jsonError(w, "Invalid mode: "+req.Mode, http.StatusBadRequest)
+		return
 	}
-	if req.Loops == 0 {
-		req.Loops = 2
+	pause := 0
+	if req.Mode == marqueePause {
+		pause = defaultMarqueePauseMs
 	}
-
-	charWidth := req.Size * 6
-	textWidth := len(req.Text) * charWidth
-	totalDistance := 128 + textWidth
-
-	var allPositions []int
-	for loop := 0; loop < req.Loops; loop++ {
-		for offset := 0; offset < totalDistance; offset += req.Speed {
-			var x int
-			if req.Direction == "left" {
-				x = 128 - offset
-			} else {
-				x = offset - textWidth
-			}
-			allPositions = append(allPositions, x)
+	if req.Pause != nil {
+		if *req.Pause < 0 || *req.Pause > 10000 {
+			jsonError(w, "pause must be between 0 and 10000", http.StatusBadRequest)
+			return
 		}
+		pause = *req.Pause
 	}
 
-	maxMarqueeFrames := req.MaxFrames
-	if maxMarqueeFrames < 2 {
-		maxMarqueeFrames = 5
+	// A single marquee is the top-level fields; "lines" gives up to two
+	// lines that scroll independently.
+	lines := req.Lines
+	if len(lines) == 0 {
+		if req.Y == 0 {
+			req.Y = 25
+		}
+		lines = []MarqueeLine{{Text: req.Text, Y: req.Y, Size: req.Size, Speed: req.Speed, Direction: req.Direction}}
 	}
-	if maxMarqueeFrames > 20 {
-		maxMarqueeFrames = 20
+	if len(lines) > maxMarqueeLines {
+		jsonError(w, fmt.Sprintf("at most %d lines are supported", maxMarqueeLines), http.StatusBadRequest)
+		return
 	}
-	var selectedPositions []int
-	totalPositions := len(allPositions)
 
-	if totalPositions <= maxMarqueeFrames {
-		selectedPositions = allPositions
-	} else {
-
-		step := float64(totalPositions) / float64(maxMarqueeFrames)
-		for i := 0; i < maxMarqueeFrames; i++ {
-			idx := int(float64(i) * step)
-			if idx >= totalPositions {
-				idx = totalPositions - 1
+	tracks := make([]marqueeTrack, len(lines))
+	for i := range lines {
+		line := &lines[i]
+		if line.Size == 0 {
+			line.Size = 2
+		}
+		if line.Speed == 0 {
+			line.Speed = 3
+		}
+		if line.Direction == "" {
+			line.Direction = "left"
+		}
+		if len(req.Lines) > 0 && line.Y == 0 {
+			// Centre each line in its half of the screen.
+			line.Y = i*oledHeight/2 + (oledHeight/2-7*line.Size)/2
+		}
+		if err := validateMarqueeLine(*line, len(req.Lines) == 0); err != nil {
+			if len(req.Lines) > 0 {
+				err = fmt.Errorf("lines[%d]: %v", i, err)
 			}
-			selectedPositions = append(selectedPositions, allPositions[idx])
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		log.Printf("Marquee: sampling %d positions down to %d frames", totalPositions, maxMarqueeFrames)
+		tracks[i] = newMarqueeTrack(line.Text, line.Y, line.Size, line.Speed, line.Direction, req.Mode, pause)
 	}
 
-	var marqueeFrames []Frame
-	frameTime := 50
-
-	if totalPositions > maxMarqueeFrames {
-		frameTime = (totalPositions * 50) / len(selectedPositions)
-	}
-
-	for _, x := range selectedPositions {
-
-		var frameElements []Element
-
-		if req.Framed {
-			frameElements = append(frameElements,
-
-				Element{Type: "line", X: 0, Y: 0, Width: 128, Height: 1},
-
-				Element{Type: "line", X: 0, Y: 63, Width: 128, Height: 1},
-
-				Element{Type: "line", X: 0, Y: 0, Width: 1, Height: 64},
-
-				Element{Type: "line", X: 127, Y: 0, Width: 1, Height: 64},
-			)
-		}
-
-		frameElements = append(frameElements,
-			Element{Type: "text", X: x, Y: req.Y, Size: req.Size, Value: req.Text},
-		)
-
-		textFrame := Frame{
-			Version:  1,
-			Duration: frameTime,
-			Clear:    true,
-			Elements: frameElements,
-		}
+	mutex.Lock()
+	dev := resolveDevice(r)
+	budget := marqueeFrameBudget(dev, req.MaxFrames)
+	mutex.Unlock()
 
-		bitmapFrame := convertFrameToBitmap(textFrame)
-		marqueeFrames = append(marqueeFrames, bitmapFrame)
+	marqueeFrames := buildMarqueeFrames(tracks, req.Framed, budget)
+	loopMs := 0
+	for _, frame := range marqueeFrames {
+		loopMs += frame.Duration
 	}
 
 	mutex.Lock()
-	isCustomMode = true
-	isGifMode = true
-	frames = marqueeFrames
-	index = 0
+	setDisplayFrames(dev, marqueeFrames, true, CustomSource{
+		Type: "marquee",
+		Params: map[string]interface{}{
+			"text": req.Text, "lines": lines, "mode": req.Mode, "pause": pause,
+			"maxFrames": req.MaxFrames, "framed": req.Framed,
+		},
+	})
 	mutex.Unlock()
 
-	log.Printf("Marquee generated: %d bitmap frames for local ESP32 playback", len(marqueeFrames))
+	log.Printf("Marquee generated: %d bitmap frames (budget %d, %dms loop) for local ESP32 playback", len(marqueeFrames), budget, loopMs)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":    true,
-		"frameCount": len(marqueeFrames),
-		"message":    "Marquee frames converted to bitmaps for local playback",
+		"success":     true,
+		"frameCount":  len(marqueeFrames),
+		"frameBudget": budget,
+		"loopMs":      loopMs,
+		"message":     "Marquee frames converted to bitmaps for local playback",
 	})
 }
 
@@ -307,10 +296,6 @@ func handleCustom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	mutex.Lock()
-	isCustomMode = true
-	isGifMode = false
-
 	var el Element
 	if len(req.Bitmap) > 0 {
 		el = Element{
@@ -331,6 +316,7 @@ func handleCustom(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	mutex.Lock()
 	var elements []Element
 	if len(req.Bitmap) > 0 {
 		elements = []Element{el}
@@ -342,10 +328,13 @@ func handleCustom(w http.ResponseWriter, r *http.Request) {
 		elements = append(elements, el)
 	}
 
-	frames = []Frame{
-		{Version: 1, Duration: 5000, Clear: true, Elements: elements},
+	source := CustomSource{Type: "custom", Params: map[string]interface{}{"text": req.Text}}
+	if len(req.Bitmap) > 0 {
+		source.Params = map[string]interface{}{"width": req.Width, "height": req.Height}
 	}
-	index = 0
+	setDisplayFrames(resolveDevice(r), []Frame{
+		{Version: 1, Duration: 5000, Clear: true, Elements: elements},
+	}, false, source)
 	mutex.Unlock()
 
 	w.WriteHeader(http.StatusOK)
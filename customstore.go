@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// Custom content lives in its own file next to config.json: uploaded GIFs
+// and marquees run to hundreds of kilobytes of bitmaps, which would bloat
+// every config save and the config history.
+
+func storedCustomContent(source *CustomSource, gifMode bool, content []Frame, now time.Time) CustomContent {
+	stored := CustomContent{IsGifMode: gifMode, SavedAt: now}
+	if source != nil {
+		stored.Source = *source
+	}
+	stored.Frames = make([]Frame, len(content))
+	for i, frame := range content {
+		stored.Frames[i] = encodeFrameBitmaps(frame, bitmapEncodingBase64)
+	}
+	return stored
+}
+
+// snapshotCustomContent captures the custom content of the shared display
+// and every device. The caller must hold mutex.
+func snapshotCustomContent(now time.Time) CustomContentFile {
+	var store CustomContentFile
+	if isCustomMode {
+		shared := storedCustomContent(customSource, isGifMode, frames, now)
+		store.Shared = &shared
+	}
+	for id, dev := range devices {
+		if !dev.IsCustomMode {
+			continue
+		}
+		if store.Devices == nil {
+			store.Devices = make(map[string]CustomContent)
+		}
+		store.Devices[id] = storedCustomContent(dev.CustomSource, dev.IsGifMode, dev.Frames, now)
+	}
+	return store
+}
+
+func decodeCustomFrames(stored CustomContent) ([]Frame, error) {
+	if len(stored.Frames) == 0 {
+		return nil, fmt.Errorf("no frames")
+	}
+	decoded := make([]Frame, len(stored.Frames))
+	for i, frame := range stored.Frames {
+		var err error
+		if decoded[i], err = decodeFrameBitmaps(frame); err != nil {
+			return nil, fmt.Errorf("frame %d: %v", i, err)
+		}
+	}
+	return decoded, nil
+}
+
+// restoreCustomContent puts stored custom content back on the display and
+// returns how many displays were restored. Entries that cannot be decoded
+// are skipped. The caller must hold mutex.
+func restoreCustomContent(store CustomContentFile) int {
+	restored := 0
+	if store.Shared != nil {
+		if decoded, err := decodeCustomFrames(*store.Shared); err != nil {
+			log.Printf("Skipping stored custom content: %v", err)
+		} else {
+			source := store.Shared.Source
+			isCustomMode = true
+			isGifMode = store.Shared.IsGifMode
+			frames = decoded
+			index = 0
+			customSource = &source
+			restored++
+		}
+	}
+
+	ids := make([]string, 0, len(store.Devices))
+	for id := range store.Devices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		stored := store.Devices[id]
+		if !isValidDeviceID(id) {
+			log.Printf("Skipping stored custom content for invalid device id %q", id)
+			continue
+		}
+		decoded, err := decodeCustomFrames(stored)
+		if err != nil {
+			log.Printf("Skipping stored custom content for %s: %v", id, err)
+			continue
+		}
+		source := stored.Source
+		dev := lookupDevice(id)
+		if dev == nil {
+			log.Printf("Skipping stored custom content for %s: device registry is full", id)
+			continue
+		}
+		dev.IsCustomMode = true
+		dev.IsGifMode = stored.IsGifMode
+		dev.Frames = decoded
+		dev.Index = 0
+		dev.CustomSource = &source
+		restored++
+	}
+	return restored
+}
+
+func loadCustomContent() {
+	data, err := os.ReadFile(customContentFile)
+	if err != nil {
+		return
+	}
+	var store CustomContentFile
+	if err := json.Unmarshal(data, &store); err != nil {
+		log.Printf("Error decoding %s: %v, starting without custom content", customContentFile, err)
+		return
+	}
+
+	mutex.Lock()
+	restored := restoreCustomContent(store)
+	mutex.Unlock()
+
+	if restored > 0 {
+		log.Printf("Restored custom content for %d display(s)", restored)
+	}
+}
+
+// writeCustomContent replaces the sidecar file, or removes it when no
+// display shows custom content.
+func writeCustomContent(store CustomContentFile) {
+	if store.Shared == nil && len(store.Devices) == 0 {
+		if err := os.Remove(customContentFile); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing %s: %v", customContentFile, err)
+		}
+		return
+	}
+
+	data, err := json.Marshal(store)
+	if err != nil {
+		log.Printf("Error encoding custom content: %v", err)
+		return
+	}
+	tempFile := customContentFile + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0600); err != nil {
+		log.Printf("Error writing custom content: %v", err)
+		return
+	}
+	if err := os.Rename(tempFile, customContentFile); err != nil {
+		log.Printf("Error renaming custom content file: %v", err)
+		os.Remove(tempFile)
+	}
+}
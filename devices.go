@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const maxDevices = 32
+
+// getDeviceID returns the device identifier sent in the X-Device-ID header
+// or the "device" query parameter. An empty string means the shared display.
+func getDeviceID(r *http.Request) string {
+	id := strings.TrimSpace(r.Header.Get("X-Device-ID"))
+	if id == "" {
+		id = strings.TrimSpace(r.URL.Query().Get("device"))
+	}
+	if !isValidDeviceID(id) {
+		return ""
+	}
+	return id
+}
+
+func isValidDeviceID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// hasStoredState reports whether a device carries overrides or custom
+// content that would be lost if it were dropped from the registry.
+func (dev *DeviceState) hasStoredState() bool {
+	return dev.IsCustomMode || dev.Overrides != (DeviceOverrides{})
+}
+
+// lookupDevice returns the registered device for id, creating it on first
+// sight. When the registry is full the longest unseen device without
+// overrides or custom content makes room; if every device has something
+// stored, nil is returned and the new id is refused. The caller must hold
+// mutex.
+func lookupDevice(id string) *DeviceState {
+	if dev, ok := devices[id]; ok {
+		return dev
+	}
+
+	if len(devices) >= maxDevices {
+		var oldestID string
+		var oldest time.Time
+		for devID, dev := range devices {
+			if dev.hasStoredState() {
+				continue
+			}
+			if oldestID == "" || dev.LastSeen.Before(oldest) {
+				oldestID = devID
+				oldest = dev.LastSeen
+			}
+		}
+		if oldestID == "" {
+			log.Printf("📟 Device registry full, refusing %s", id)
+			return nil
+		}
+		delete(devices, oldestID)
+		log.Printf("📟 Device registry full, evicted %s", oldestID)
+	}
+
+	now := time.Now()
+	dev := &DeviceState{ID: id, FirstSeen: now, LastSeen: now}
+	devices[id] = dev
+	log.Printf("📟 New device registered: %s", id)
+	return dev
+}
+
+// resolveDevice maps a request to its device state, or nil for the shared
+// display. A device the full registry refuses also gets the shared display.
+// The caller must hold mutex.
+func resolveDevice(r *http.Request) *DeviceState {
+	id := getDeviceID(r)
+	if id == "" {
+		return nil
+	}
+	dev := lookupDevice(id)
+	if dev == nil {
+		return nil
+	}
+	dev.LastSeen = time.Now()
+	return dev
+}
+
+func activeFrames(dev *DeviceState) []Frame {
+	if dev != nil && dev.IsCustomMode {
+		return dev.Frames
+	}
+	return frames
+}
+
+func activeGifMode(dev *DeviceState) bool {
+	if dev != nil && dev.IsCustomMode {
+		return dev.IsGifMode
+	}
+	return isGifMode
+}
+
+func frameCursor(dev *DeviceState) *int {
+	if dev != nil {
+		return &dev.Index
+	}
+	return &index
+}
+
+// setDisplayFrames replaces the custom content of a device, or of the shared
+// display when dev is nil, and queues it for the sidecar file. The caller
+// must hold mutex.
+func setDisplayFrames(dev *DeviceState, newFrames []Frame, gifMode bool, source CustomSource) {
+	customContentDirty = true
+	go saveConfig()
+	if dev == nil {
+		isCustomMode = true
+		isGifMode = gifMode
+		frames = newFrames
+		index = 0
+		customSource = &source
+		publishCustomFrames("", newFrames)
+		return
+	}
+	dev.IsCustomMode = true
+	dev.IsGifMode = gifMode
+	dev.Frames = newFrames
+	dev.Index = 0
+	dev.CustomSource = &source
+	publishCustomFrames(dev.ID, newFrames)
+}
+
+// clearSharedCustomMode hands the shared display back to the cycle. The
+// caller must hold mutex.
+func clearSharedCustomMode() {
+	if isCustomMode {
+		customContentDirty = true
+	}
+	isCustomMode = false
+	isGifMode = false
+	index = 0
+	customSource = nil
+}
+
+func clearDeviceCustomMode(dev *DeviceState) {
+	if dev.IsCustomMode {
+		customContentDirty = true
+	}
+	dev.IsCustomMode = false
+	dev.IsGifMode = false
+	dev.Frames = nil
+	dev.Index = 0
+	dev.CustomSource = nil
+}
+
+// resolveFrameSettings returns the display and LED settings for a device,
+// applying its overrides on top of the global values and night mode on top
+// of both. The caller must hold mutex.
+func resolveFrameSettings(dev *DeviceState) FrameSettings {
+	fs := FrameSettings{
+		EspRefreshDuration: espRefreshDuration,
+		GifFps:             gifFps,
+		DisplayRotation:    displayRotation,
+		LedBrightness:      ledBrightness,
+		LedBeaconEnabled:   ledBeaconEnabled,
+		LedEffectMode:      ledEffectMode,
+		LedCustomColor:     ledCustomColor,
+		LedFlashSpeed:      ledFlashSpeed,
+		LedPulseSpeed:      ledPulseSpeed,
+	}
+	if dev == nil {
+		applyNightMode(&fs)
+		return fs
+	}
+
+	o := dev.Overrides
+	if o.EspRefreshDuration != nil {
+		fs.EspRefreshDuration = *o.EspRefreshDuration
+	}
+	if o.GifFps != nil {
+		fs.GifFps = *o.GifFps
+	}
+	if o.DisplayRotation != nil {
+		fs.DisplayRotation = *o.DisplayRotation
+	}
+	if o.LedBrightness != nil {
+		fs.LedBrightness = *o.LedBrightness
+	}
+	if o.LedBeaconEnabled != nil {
+		fs.LedBeaconEnabled = *o.LedBeaconEnabled
+	}
+	if o.LedEffectMode != nil {
+		fs.LedEffectMode = *o.LedEffectMode
+	}
+	if o.LedCustomColor != nil {
+		fs.LedCustomColor = *o.LedCustomColor
+	}
+	if o.LedFlashSpeed != nil {
+		fs.LedFlashSpeed = *o.LedFlashSpeed
+	}
+	if o.LedPulseSpeed != nil {
+		fs.LedPulseSpeed = *o.LedPulseSpeed
+	}
+	applyNightMode(&fs)
+	return fs
+}
+
+// validateDeviceOverrides checks override values against the same limits
+// handleSettings enforces for the global settings.
+func validateDeviceOverrides(o DeviceOverrides) error {
+	if o.EspRefreshDuration != nil && (*o.EspRefreshDuration < 500 || *o.EspRefreshDuration > 30000) {
+		return fmt.Errorf("espRefreshDuration must be between 500 and 30000")
+	}
+	if o.GifFps != nil && (*o.GifFps < 0 || *o.GifFps > 30) {
+		return fmt.Errorf("gifFps must be between 0 and 30")
+	}
+	if o.DisplayRotation != nil && *o.DisplayRotation != 0 && *o.DisplayRotation != 2 {
+		return fmt.Errorf("displayRotation must be 0 or 2")
+	}
+	if o.LedBrightness != nil && (*o.LedBrightness < 0 || *o.LedBrightness > 100) {
+		return fmt.Errorf("ledBrightness must be between 0 and 100")
+	}
+	if o.LedEffectMode != nil {
+		validModes := map[string]bool{"auto": true, "static": true, "flash": true, "pulse": true, "rainbow": true}
+		if !validModes[*o.LedEffectMode] {
+			return fmt.Errorf("invalid ledEffectMode: %s", *o.LedEffectMode)
+		}
+	}
+	if o.LedCustomColor != nil && (len(*o.LedCustomColor) != 7 || (*o.LedCustomColor)[0] != '#') {
+		return fmt.Errorf("ledCustomColor must be in #RRGGBB format")
+	}
+	if o.LedFlashSpeed != nil && (*o.LedFlashSpeed < 100 || *o.LedFlashSpeed > 2000) {
+		return fmt.Errorf("ledFlashSpeed must be between 100 and 2000")
+	}
+	if o.LedPulseSpeed != nil && (*o.LedPulseSpeed < 500 || *o.LedPulseSpeed > 3000) {
+		return fmt.Errorf("ledPulseSpeed must be between 500 and 3000")
+	}
+	return nil
+}
+
+func deviceList() []DeviceState {
+	list := make([]DeviceState, 0, len(devices))
+	for _, dev := range devices {
+		list = append(list, *dev)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func handleDevices(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodGet {
+		mutex.Lock()
+		list := deviceList()
+		mutex.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"devices": list})
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req struct {
+			ID          string           `json:"id"`
+			Overrides   *DeviceOverrides `json:"overrides,omitempty"`
+			ClearCustom bool             `json:"clearCustom,omitempty"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !isValidDeviceID(req.ID) {
+			jsonError(w, "Invalid device id", http.StatusBadRequest)
+			return
+		}
+		if req.Overrides != nil {
+			if err := validateDeviceOverrides(*req.Overrides); err != nil {
+				jsonError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		mutex.Lock()
+		dev := lookupDevice(req.ID)
+		if dev == nil {
+			mutex.Unlock()
+			jsonError(w, "Device registry is full", http.StatusConflict)
+			return
+		}
+		if req.Overrides != nil {
+			dev.Overrides = *req.Overrides
+			noteConfigChange("device " + req.ID + " overrides updated")
+		}
+		if req.ClearCustom {
+			clearDeviceCustomMode(dev)
+		}
+		response := *dev
+		mutex.Unlock()
+
+		if req.Overrides != nil || req.ClearCustom {
+			go saveConfig()
+		}
+
+		log.Printf("📟 Device %s updated (clearCustom=%v)", req.ID, req.ClearCustom)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		id := r.URL.Query().Get("id")
+		mutex.Lock()
+		dev, exists := devices[id]
+		delete(devices, id)
+		if exists {
+			noteConfigChange("device " + id + " removed")
+			if dev.IsCustomMode {
+				customContentDirty = true
+			}
+		}
+		mutex.Unlock()
+
+		if !exists {
+			jsonError(w, "Device not found", http.StatusNotFound)
+			return
+		}
+
+		go saveConfig()
+
+		log.Printf("📟 Device removed: %s", id)
+		json.NewEncoder(w).Encode(map[string]string{"status": "deleted", "id": id})
+		return
+	}
+
+	jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+const (
+	ditherThreshold      = "threshold"
+	ditherFloydSteinberg = "floyd-steinberg"
+	ditherAtkinson       = "atkinson"
+	ditherOrdered        = "ordered"
+)
+
+// ditherOptions control how an image is turned into 1-bit pixels. Tone
+// adjustments are applied to the luminance before dithering.
+type ditherOptions struct {
+	Algorithm  string
+	Brightness int     // -100..100, added to luminance
+	Contrast   int     // -100..100, scales around mid grey
+	Gamma      float64 // 0.1..5, above 1 lifts the shadows
+	Invert     bool
+	Threshold  int // 1..254, cut-off between off and lit
+}
+
+// defaultDitherOptions reproduce the classic conversion: a plain threshold
+// at 128 with no adjustments.
+func defaultDitherOptions() ditherOptions {
+	return ditherOptions{Algorithm: ditherThreshold, Gamma: 1, Threshold: 128}
+}
+
+// parseDitherOptions reads dither, brightness, contrast, gamma, invert and
+// threshold form values, keeping the defaults for any that are absent.
+func parseDitherOptions(r *http.Request) (ditherOptions, error) {
+	opts := defaultDitherOptions()
+	if v := r.FormValue("dither"); v != "" {
+		validAlgorithms := map[string]bool{ditherThreshold: true, ditherFloydSteinberg: true, ditherAtkinson: true, ditherOrdered: true}
+		if !validAlgorithms[v] {
+			return opts, fmt.Errorf("invalid dither: %s", v)
+		}
+		opts.Algorithm = v
+	}
+
+	intValue := func(key string, min, max int, dst *int) error {
+		v := r.FormValue(key)
+		if v == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < min || n > max {
+			return fmt.Errorf("%s must be between %d and %d", key, min, max)
+		}
+		*dst = n
+		return nil
+	}
+	if err := intValue("brightness", -100, 100, &opts.Brightness); err != nil {
+		return opts, err
+	}
+	if err := intValue("contrast", -100, 100, &opts.Contrast); err != nil {
+		return opts, err
+	}
+	if err := intValue("threshold", 1, 254, &opts.Threshold); err != nil {
+		return opts, err
+	}
+	if v := r.FormValue("gamma"); v != "" {
+		g, err := strconv.ParseFloat(v, 64)
+		if err != nil || g < 0.1 || g > 5 {
+			return opts, fmt.Errorf("gamma must be between 0.1 and 5")
+		}
+		opts.Gamma = g
+	}
+	if v := r.FormValue("invert"); v != "" {
+		invert, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invert must be true or false")
+		}
+		opts.Invert = invert
+	}
+	return opts, nil
+}
+
+// adjust applies the tone settings to a 0-255 luminance.
+func (o ditherOptions) adjust(lum float64) float64 {
+	v := lum + float64(o.Brightness)*255/100
+	v = (v-128)*float64(100+o.Contrast)/100 + 128
+	v = math.Max(0, math.Min(255, v))
+	if o.Gamma > 0 && o.Gamma != 1 {
+		v = 255 * math.Pow(v/255, 1/o.Gamma)
+	}
+	if o.Invert {
+		v = 255 - v
+	}
+	return v
+}
+
+// bayer8 is the 8x8 ordered dither matrix.
+var bayer8 = [8][8]float64{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// ditherGray turns a w x h buffer of adjusted luminance into lit pixels.
+// The buffer is used as scratch space by the error-diffusion algorithms.
+func ditherGray(gray []float64, w, h int, opts ditherOptions) []bool {
+	lit := make([]bool, len(gray))
+	threshold := float64(opts.Threshold)
+
+	// spread pushes quantisation error onto a neighbour if it exists.
+	spread := func(x, y int, amount float64) {
+		if x >= 0 && x < w && y < h {
+			gray[y*w+x] += amount
+		}
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*w + x
+			v := gray[i]
+			switch opts.Algorithm {
+			case ditherOrdered:
+				lit[i] = v > (bayer8[y%8][x%8]+0.5)*4
+				continue
+			case ditherThreshold:
+				lit[i] = v > threshold
+				continue
+			}
+
+			lit[i] = v > threshold
+			quantised := 0.0
+			if lit[i] {
+				quantised = 255
+			}
+			err := v - quantised
+			if opts.Algorithm == ditherAtkinson {
+				e := err / 8
+				spread(x+1, y, e)
+				spread(x+2, y, e)
+				spread(x-1, y+1, e)
+				spread(x, y+1, e)
+				spread(x+1, y+1, e)
+				spread(x, y+2, e)
+			} else {
+				spread(x+1, y, err*7/16)
+				spread(x-1, y+1, err*3/16)
+				spread(x, y+1, err*5/16)
+				spread(x+1, y+1, err*1/16)
+			}
+		}
+	}
+	return lit
+}
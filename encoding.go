@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	bitmapEncodingBase64 = "base64"
+	bitmapEncodingHex    = "hex"
+)
+
+// getBitmapEncoding returns the compact bitmap encoding a client opted into
+// with the X-Bitmap-Encoding header or the "encoding" query parameter. An
+// empty string keeps the classic integer arrays.
+func getBitmapEncoding(r *http.Request) string {
+	enc := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Bitmap-Encoding")))
+	if enc == "" {
+		enc = strings.ToLower(strings.TrimSpace(r.URL.Query().Get("encoding")))
+	}
+	switch enc {
+	case bitmapEncodingBase64, bitmapEncodingHex:
+		return enc
+	}
+	return ""
+}
+
+// packBitmap packs a bitmap byte array into a string in the given encoding.
+func packBitmap(bitmap []int, encoding string) string {
+	raw := make([]byte, len(bitmap))
+	for i, b := range bitmap {
+		raw[i] = byte(b)
+	}
+	if encoding == bitmapEncodingHex {
+		return hex.EncodeToString(raw)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// encodeFrameBitmaps returns a copy of frame whose bitmap elements carry
+// packed Data in place of the Bitmap array. The original frame is not modified.
+func encodeFrameBitmaps(frame Frame, encoding string) Frame {
+	if encoding == "" {
+		return frame
+	}
+	elements := make([]Element, len(frame.Elements))
+	for i, el := range frame.Elements {
+		if el.Type == "bitmap" && len(el.Bitmap) > 0 {
+			el.Data = packBitmap(el.Bitmap, encoding)
+			el.Encoding = encoding
+			el.Bitmap = nil
+		}
+		elements[i] = el
+	}
+	frame.Elements = elements
+	return frame
+}
+
+// decodeFrameBitmaps is the inverse of encodeFrameBitmaps: it unpacks Data
+// back into Bitmap arrays.
+func decodeFrameBitmaps(frame Frame) (Frame, error) {
+	elements := make([]Element, len(frame.Elements))
+	for i, el := range frame.Elements {
+		if el.Type == "bitmap" && el.Data != "" {
+			raw, err := elementBitmapBytes(el)
+			if err != nil {
+				return frame, err
+			}
+			el.Bitmap = make([]int, len(raw))
+			for j, b := range raw {
+				el.Bitmap[j] = int(b)
+			}
+			el.Data = ""
+			el.Encoding = ""
+		}
+		elements[i] = el
+	}
+	frame.Elements = elements
+	return frame, nil
+}
+
+// acceptsGzip reports whether the client explicitly lists gzip with a
+// non-zero quality in Accept-Encoding.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(part, ";")
+		if strings.ToLower(strings.TrimSpace(params[0])) != "gzip" {
+			continue
+		}
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if q, err := strconv.ParseFloat(strings.TrimPrefix(p, "q="), 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// writePayload sends an already encoded JSON body, gzipped when the client
+// advertises support for it.
+func writePayload(w http.ResponseWriter, r *http.Request, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Add("Vary", "Accept-Encoding, X-Bitmap-Encoding")
+
+	if acceptsGzip(r) {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(body)
+		gz.Close()
+		body = buf.Bytes()
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	eventBufferSize   = 16
+	eventKeepalive    = 25 * time.Second
+	maxEventListeners = 64
+)
+
+// ServerEvent is a typed state change pushed to dashboard subscribers.
+type ServerEvent struct {
+	Type string
+	Data interface{}
+}
+
+var (
+	eventMutex       sync.Mutex
+	eventSubscribers = make(map[chan ServerEvent]struct{})
+
+	lastFramesFingerprint uint64
+)
+
+func subscribeEvents() (chan ServerEvent, bool) {
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+	if len(eventSubscribers) >= maxEventListeners {
+		return nil, false
+	}
+	ch := make(chan ServerEvent, eventBufferSize)
+	eventSubscribers[ch] = struct{}{}
+	return ch, true
+}
+
+func unsubscribeEvents(ch chan ServerEvent) {
+	eventMutex.Lock()
+	delete(eventSubscribers, ch)
+	eventMutex.Unlock()
+}
+
+func hasEventSubscribers() bool {
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+	return len(eventSubscribers) > 0
+}
+
+// publishEvent fans an event out to every subscriber. Sends never block:
+// a subscriber whose buffer is full misses the event rather than stalling
+// the caller, which may be holding mutex.
+func publishEvent(eventType string, data interface{}) {
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+	ev := ServerEvent{Type: eventType, Data: data}
+	for ch := range eventSubscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// publishFramesChanged emits a "frames" event when the rotation content
+// differs from the last one announced, so the 100ms update loop only
+// produces an event when something visible actually changed.
+func publishFramesChanged(newFrames []Frame) {
+	if !hasEventSubscribers() {
+		return
+	}
+	data, err := json.Marshal(newFrames)
+	if err != nil {
+		return
+	}
+	h := fnv.New64a()
+	h.Write(data)
+	sum := h.Sum64()
+
+	eventMutex.Lock()
+	changed := sum != lastFramesFingerprint
+	lastFramesFingerprint = sum
+	eventMutex.Unlock()
+
+	if changed {
+		publishEvent("frames", map[string]interface{}{"frameCount": len(newFrames), "custom": false})
+	}
+}
+
+// publishCustomFrames announces custom content pushed to a device or to the
+// shared display, and forgets the auto fingerprint so the return to the
+// cycle is announced too.
+func publishCustomFrames(deviceID string, newFrames []Frame) {
+	eventMutex.Lock()
+	lastFramesFingerprint = 0
+	eventMutex.Unlock()
+
+	data := map[string]interface{}{"frameCount": len(newFrames), "custom": true}
+	if deviceID != "" {
+		data["device"] = deviceID
+	}
+	publishEvent("frames", data)
+}
+
+// pomodoroEventData snapshots the timer for a "pomodoro" event. The caller
+// must hold mutex.
+func pomodoroEventData() map[string]interface{} {
+	return map[string]interface{}{
+		"session":  pomodoroSession,
+		"settings": pomodoroSettings,
+	}
+}
+
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		jsonError(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch, ok := subscribeEvents()
+	if !ok {
+		jsonError(w, "Too many event listeners", http.StatusServiceUnavailable)
+		return
+	}
+	defer unsubscribeEvents(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	fmt.Fprintf(w, "retry: 3000\nevent: ready\ndata: {}\n\n")
+	flusher.Flush()
+
+	log.Printf("📡 Event stream opened from %s", r.RemoteAddr)
+	defer log.Printf("📡 Event stream closed from %s", r.RemoteAddr)
+
+	keepalive := time.NewTicker(eventKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprintf(w, ": keepalive\n\n")
+			flusher.Flush()
+		case ev := <-ch:
+			payload, err := json.Marshal(ev.Data)
+			if err != nil {
+				log.Printf("Error encoding %s event: %v", ev.Type, err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, payload)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	builtinFontName  = "5x7"
+	maxFontNameLen   = 32
+	maxFontGlyphs    = 8192
+	maxFontGlyphSize = 64
+)
+
+// bdfGlyph is one character of a BDF font. Rows hold Height rows of
+// (Width+7)/8 bytes, most significant bit first. XOff and YOff place the
+// bitmap's bottom-left corner relative to the origin on the baseline.
+type bdfGlyph struct {
+	Width, Height int
+	XOff, YOff    int
+	Advance       int
+	Rows          [][]byte
+}
+
+// BitmapFont is a font loaded from a BDF file.
+type BitmapFont struct {
+	Name    string
+	Family  string
+	Ascent  int
+	Descent int
+	Glyphs  map[rune]*bdfGlyph
+	Default rune
+}
+
+// glyph returns the glyph for r, falling back to the font's DEFAULT_CHAR
+// and then '?'. It returns nil when neither exists.
+func (f *BitmapFont) glyph(r rune) *bdfGlyph {
+	for _, c := range []rune{r, f.Default, '?'} {
+		if g, ok := f.Glyphs[c]; ok {
+			return g
+		}
+	}
+	return nil
+}
+
+// LineHeight is the height of one line of text at size 1.
+func (f *BitmapFont) LineHeight() int {
+	return f.Ascent + f.Descent
+}
+
+// Measure is the width value takes at size, the sum of its glyph advances.
+func (f *BitmapFont) Measure(value string, size int) int {
+	if size <= 0 {
+		size = 1
+	}
+	width := 0
+	for _, r := range value {
+		if g := f.glyph(r); g != nil {
+			width += g.Advance
+		}
+	}
+	return width * size
+}
+
+func (f *BitmapFont) info() FontInfo {
+	return FontInfo{Name: f.Name, Family: f.Family, Ascent: f.Ascent, Descent: f.Descent, Height: f.LineHeight(), Glyphs: len(f.Glyphs)}
+}
+
+// DrawFontText draws value in a BDF font with the top of the line at y, the
+// same anchor DrawText uses, and returns the area the line covers.
+func (c *Canvas) DrawFontText(f *BitmapFont, x, y, size int, value string) image.Rectangle {
+	if size <= 0 {
+		size = 1
+	}
+	baseline := y + f.Ascent*size
+	cursorX := x
+	for _, r := range value {
+		g := f.glyph(r)
+		if g == nil {
+			continue
+		}
+		top := baseline - (g.YOff+g.Height)*size
+		for row, bits := range g.Rows {
+			for col := 0; col < g.Width; col++ {
+				if col/8 < len(bits) && bits[col/8]&(0x80>>(col%8)) != 0 {
+					c.FillRect(cursorX+(g.XOff+col)*size, top+row*size, size, size)
+				}
+			}
+		}
+		cursorX += g.Advance * size
+	}
+	return image.Rect(x, y, cursorX, y+f.LineHeight()*size)
+}
+
+// parseBDF reads a font in the Glyph Bitmap Distribution Format. Glyphs
+// without a Unicode encoding are skipped.
+func parseBDF(r io.Reader) (*BitmapFont, error) {
+	font := &BitmapFont{Glyphs: make(map[rune]*bdfGlyph), Default: -1}
+	var boxHeight, boxYOff int
+	ascent, descent := -1, -1
+
+	scanner := bufio.NewScanner(r)
+	var glyph *bdfGlyph
+	encoding := -1
+	inBitmap := false
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		ints := func(n int) ([]int, error) {
+			if len(fields) < n+1 {
+				return nil, fmt.Errorf("line %d: %s needs %d values", line, fields[0], n)
+			}
+			values := make([]int, n)
+			for i := range values {
+				v, err := strconv.Atoi(fields[i+1])
+				if err != nil {
+					return nil, fmt.Errorf("line %d: bad %s value %q", line, fields[0], fields[i+1])
+				}
+				values[i] = v
+			}
+			return values, nil
+		}
+
+		if inBitmap {
+			if fields[0] == "ENDCHAR" {
+				inBitmap = false
+				if len(glyph.Rows) != glyph.Height {
+					return nil, fmt.Errorf("line %d: glyph has %d rows, BBX says %d", line, len(glyph.Rows), glyph.Height)
+				}
+				if encoding >= 0 {
+					if len(font.Glyphs) >= maxFontGlyphs {
+						return nil, fmt.Errorf("more than %d glyphs", maxFontGlyphs)
+					}
+					font.Glyphs[rune(encoding)] = glyph
+				}
+				glyph = nil
+				continue
+			}
+			row, err := hex.DecodeString(fields[0])
+			if err != nil || len(row) < (glyph.Width+7)/8 {
+				return nil, fmt.Errorf("line %d: bad bitmap row %q", line, fields[0])
+			}
+			glyph.Rows = append(glyph.Rows, row)
+			continue
+		}
+
+		switch fields[0] {
+		case "FAMILY_NAME":
+			font.Family = strings.Trim(strings.Join(fields[1:], " "), `"`)
+		case "FONTBOUNDINGBOX":
+			v, err := ints(4)
+			if err != nil {
+				return nil, err
+			}
+			boxHeight, boxYOff = v[1], v[3]
+		case "FONT_ASCENT", "FONT_DESCENT", "DEFAULT_CHAR":
+			v, err := ints(1)
+			if err != nil {
+				return nil, err
+			}
+			switch fields[0] {
+			case "FONT_ASCENT":
+				ascent = v[0]
+			case "FONT_DESCENT":
+				descent = v[0]
+			default:
+				font.Default = rune(v[0])
+			}
+		case "STARTCHAR":
+			glyph = &bdfGlyph{}
+			encoding = -1
+		case "ENCODING":
+			v, err := ints(1)
+			if err != nil {
+				return nil, err
+			}
+			encoding = v[0]
+		case "DWIDTH":
+			if glyph == nil {
+				continue
+			}
+			v, err := ints(1)
+			if err != nil {
+				return nil, err
+			}
+			glyph.Advance = v[0]
+		case "BBX":
+			if glyph == nil {
+				return nil, fmt.Errorf("line %d: BBX outside a glyph", line)
+			}
+			v, err := ints(4)
+			if err != nil {
+				return nil, err
+			}
+			if v[0] < 0 || v[1] < 0 || v[0] > maxFontGlyphSize || v[1] > maxFontGlyphSize {
+				return nil, fmt.Errorf("line %d: glyph must be at most %dx%d", line, maxFontGlyphSize, maxFontGlyphSize)
+			}
+			glyph.Width, glyph.Height, glyph.XOff, glyph.YOff = v[0], v[1], v[2], v[3]
+		case "BITMAP":
+			if glyph == nil {
+				return nil, fmt.Errorf("line %d: BITMAP outside a glyph", line)
+			}
+			inBitmap = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if inBitmap {
+		return nil, fmt.Errorf("unexpected end of file inside a glyph")
+	}
+	if len(font.Glyphs) == 0 {
+		return nil, fmt.Errorf("no glyphs")
+	}
+
+	// Fonts without FONT_ASCENT/FONT_DESCENT fall back to the bounding box.
+	if descent < 0 {
+		descent = max(0, -boxYOff)
+	}
+	if ascent < 0 {
+		ascent = max(1, boxHeight+boxYOff)
+	}
+	font.Ascent, font.Descent = ascent, descent
+	return font, nil
+}
+
+// fontNameFromFile turns "fonts/Terminus-12.bdf" into "terminus-12".
+func fontNameFromFile(path string) string {
+	return strings.ToLower(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+}
+
+func validateFontName(name string) error {
+	if name == "" || name == builtinFontName {
+		return nil
+	}
+	if len(name) > maxFontNameLen {
+		return fmt.Errorf("font name must be at most %d characters", maxFontNameLen)
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return fmt.Errorf("invalid font name %q", name)
+		}
+	}
+	return nil
+}
+
+// loadFonts reads every .bdf file in the fonts directory. It runs once at
+// startup; the fonts are read-only afterwards, so renderers use them
+// without holding mutex.
+func loadFonts() {
+	paths, err := filepath.Glob(filepath.Join(fontsDir, "*.bdf"))
+	if err != nil || len(paths) == 0 {
+		return
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		name := fontNameFromFile(path)
+		if err := validateFontName(name); err != nil || name == builtinFontName {
+			log.Printf("Skipping font %s: invalid name", path)
+			continue
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			log.Printf("Skipping font %s: %v", path, err)
+			continue
+		}
+		font, err := parseBDF(file)
+		file.Close()
+		if err != nil {
+			log.Printf("Skipping font %s: %v", path, err)
+			continue
+		}
+		font.Name = name
+		bitmapFonts[name] = font
+	}
+	log.Printf("🔤 Loaded %d BDF font(s) from %s/", len(bitmapFonts), fontsDir)
+}
+
+// lookupFont returns the loaded font for name, or nil for the built-in
+// 5x7 font and unknown names.
+func lookupFont(name string) *BitmapFont {
+	if name == "" {
+		return nil
+	}
+	return bitmapFonts[name]
+}
+
+// measureElementText is the width and height a text element covers.
+func measureElementText(el Element) (int, int) {
+	size := max(el.Size, 1)
+	if font := lookupFont(el.Font); font != nil {
+		return font.Measure(el.Value, size), font.LineHeight() * size
+	}
+	return measureText(el.Value, size), 8 * size
+}
+
+// deviceFonts lists the fonts a device draws itself, sent as a comma
+// separated X-ESP32-Fonts header.
+func deviceFonts(r *http.Request) map[string]bool {
+	supported := make(map[string]bool)
+	for _, name := range strings.Split(r.Header.Get("X-ESP32-Fonts"), ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			supported[name] = true
+		}
+	}
+	return supported
+}
+
+// rasterizeFontText replaces text elements in fonts the device does not
+// draw itself with bitmaps of the rendered text, clipped to the screen.
+// The frame is returned unchanged when there is nothing to replace.
+func rasterizeFontText(frame Frame, supported map[string]bool) Frame {
+	var elements []Element
+	for i, el := range frame.Elements {
+		font := lookupFont(el.Font)
+		if el.Type != "text" || font == nil || supported[el.Font] {
+			if elements != nil {
+				elements = append(elements, el)
+			}
+			continue
+		}
+		if elements == nil {
+			elements = append(make([]Element, 0, len(frame.Elements)), frame.Elements[:i]...)
+		}
+
+		width, height := measureElementText(el)
+		area := image.Rect(el.X, el.Y, el.X+width, el.Y+height).Intersect(image.Rect(0, 0, oledWidth, oledHeight))
+		if area.Empty() {
+			continue
+		}
+		canvas := newCanvas(area.Dx(), area.Dy())
+		canvas.DrawFontText(font, el.X-area.Min.X, el.Y-area.Min.Y, el.Size, el.Value)
+		elements = append(elements, Element{Type: "bitmap", X: area.Min.X, Y: area.Min.Y, Width: area.Dx(), Height: area.Dy(), Bitmap: canvas.Pix})
+	}
+	if elements == nil {
+		return frame
+	}
+	frame.Elements = elements
+	return frame
+}
+
+func handleFonts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list := []FontInfo{{Name: builtinFontName, Family: "Built-in", Ascent: 7, Descent: 1, Height: 8, Glyphs: len(font5x7), Builtin: true}}
+	names := make([]string, 0, len(bitmapFonts))
+	for name := range bitmapFonts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		list = append(list, bitmapFonts[name].info())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"fonts": list})
+}
@@ -2,96 +2,163 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"hash/fnv"
 	"net/http"
+	"strings"
 )
 
+func buildFrameResponse(frame Frame, gifMode bool, fs FrameSettings) map[string]interface{} {
+	return map[string]interface{}{
+		"version":          frame.Version,
+		"duration":         frame.Duration,
+		"clear":            frame.Clear,
+		"elements":         frame.Elements,
+		"isGifMode":        gifMode,
+		"displayRotation":  fs.DisplayRotation,
+		"ledBrightness":    fs.LedBrightness,
+		"ledBeaconEnabled": fs.LedBeaconEnabled,
+		"ledEffectMode":    fs.LedEffectMode,
+		"ledCustomColor":   fs.LedCustomColor,
+		"ledFlashSpeed":    fs.LedFlashSpeed,
+		"ledPulseSpeed":    fs.LedPulseSpeed,
+		"displayContrast":  fs.DisplayContrast,
+		"nightMode":        fs.NightMode,
+	}
+}
+
+// frameETag derives a strong validator from the encoded frame response, which
+// already carries the LED and rotation metadata.
+func frameETag(body []byte) string {
+	h := fnv.New64a()
+	h.Write(body)
+	return fmt.Sprintf("\"%016x\"", h.Sum64())
+}
+
+func etagMatches(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFrameJSON sends a frame response with an ETag and answers a matching
+// If-None-Match with 304 so unchanged frames cost neither download nor redraw.
+func writeFrameJSON(w http.ResponseWriter, r *http.Request, response interface{}) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		jsonError(w, "Failed to encode frame", http.StatusInternalServerError)
+		return
+	}
+	body = append(body, '\n')
+
+	etag := frameETag(body)
+	if acceptsGzip(r) {
+		etag = strings.TrimSuffix(etag, "\"") + "-gz\""
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r, etag) {
+		w.Header().Set("Vary", "Accept-Encoding, X-Bitmap-Encoding")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writePayload(w, r, body)
+}
+
 func currentFrame(w http.ResponseWriter, r *http.Request) {
+	ensureFrames()
+
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	if len(frames) == 0 {
-		http.Error(w, "No frames available", http.StatusServiceUnavailable)
+	dev := resolveDevice(r)
+	if writeNotificationFrame(w, r, resolveFrameSettings(dev)) {
 		return
 	}
+	deviceFrames := activeFrames(dev)
+	cursor := frameCursor(dev)
 
-	if index < 0 || index >= len(frames) {
-		index = 0
+	if len(deviceFrames) == 0 {
+		http.Error(w, "No frames available", http.StatusServiceUnavailable)
+		return
 	}
-	frame := frames[index]
-	frame.Duration = espRefreshDuration
 
-	w.Header().Set("Content-Type", "application/json")
+	if *cursor < 0 || *cursor >= len(deviceFrames) {
+		*cursor = 0
+	}
+	fs := resolveFrameSettings(dev)
+	frame := encodeFrameBitmaps(rasterizeFontText(deviceFrames[*cursor], deviceFonts(r)), getBitmapEncoding(r))
+	if !frame.OwnTiming {
+		frame.Duration = fs.EspRefreshDuration
+	}
 
-	response := map[string]interface{}{
-		"version":          frame.Version,
-		"duration":         frame.Duration,
-		"clear":            frame.Clear,
-		"elements":         frame.Elements,
-		"isGifMode":        isGifMode,
-		"displayRotation":  displayRotation,
-		"ledBrightness":    ledBrightness,
-		"ledBeaconEnabled": ledBeaconEnabled,
-		"ledEffectMode":    ledEffectMode,
-		"ledCustomColor":   ledCustomColor,
-		"ledFlashSpeed":    ledFlashSpeed,
-		"ledPulseSpeed":    ledPulseSpeed,
-	}
-	json.NewEncoder(w).Encode(response)
+	writeFrameJSON(w, r, buildFrameResponse(frame, activeGifMode(dev), fs))
 }
 
 func nextFrame(w http.ResponseWriter, r *http.Request) {
+	ensureFrames()
+
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	if len(frames) == 0 {
+	dev := resolveDevice(r)
+	if writeNotificationFrame(w, r, resolveFrameSettings(dev)) {
 		return
 	}
+	deviceFrames := activeFrames(dev)
+	cursor := frameCursor(dev)
 
-	if index < 0 || index >= len(frames) {
-		index = 0
+	if len(deviceFrames) == 0 {
+		return
 	}
-	index = (index + 1) % len(frames)
 
-	frame := frames[index]
-	frame.Duration = espRefreshDuration
+	if *cursor < 0 || *cursor >= len(deviceFrames) {
+		*cursor = 0
+	}
+	*cursor = (*cursor + 1) % len(deviceFrames)
 
-	w.Header().Set("Content-Type", "application/json")
+	fs := resolveFrameSettings(dev)
+	frame := encodeFrameBitmaps(rasterizeFontText(deviceFrames[*cursor], deviceFonts(r)), getBitmapEncoding(r))
+	if !frame.OwnTiming {
+		frame.Duration = fs.EspRefreshDuration
+	}
 
-	response := map[string]interface{}{
-		"version":          frame.Version,
-		"duration":         frame.Duration,
-		"clear":            frame.Clear,
-		"elements":         frame.Elements,
-		"isGifMode":        isGifMode,
-		"displayRotation":  displayRotation,
-		"ledBrightness":    ledBrightness,
-		"ledBeaconEnabled": ledBeaconEnabled,
-		"ledEffectMode":    ledEffectMode,
-		"ledCustomColor":   ledCustomColor,
-		"ledFlashSpeed":    ledFlashSpeed,
-		"ledPulseSpeed":    ledPulseSpeed,
-	}
-	json.NewEncoder(w).Encode(response)
+	writeFrameJSON(w, r, buildFrameResponse(frame, activeGifMode(dev), fs))
 }
 
 func prevFrame(w http.ResponseWriter, r *http.Request) {
+	ensureFrames()
+
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	if len(frames) == 0 {
+	dev := resolveDevice(r)
+	deviceFrames := activeFrames(dev)
+	cursor := frameCursor(dev)
+
+	if len(deviceFrames) == 0 {
 		return
 	}
 
-	if index < 0 || index >= len(frames) {
-		index = 0
+	if *cursor < 0 || *cursor >= len(deviceFrames) {
+		*cursor = 0
 	}
-	index = index - 1
-	if index < 0 {
-		index = len(frames) - 1
+	*cursor = *cursor - 1
+	if *cursor < 0 {
+		*cursor = len(deviceFrames) - 1
 	}
 
-	frame := frames[index]
-	frame.Duration = espRefreshDuration
+	frame := deviceFrames[*cursor]
+	frame.Duration = resolveFrameSettings(dev).EspRefreshDuration
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(frame)
@@ -99,10 +166,12 @@ func prevFrame(w http.ResponseWriter, r *http.Request) {
 
 func handleFrames(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
+		ensureFrames()
+
 		mutex.Lock()
 		defer mutex.Unlock()
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(frames)
+		json.NewEncoder(w).Encode(activeFrames(resolveDevice(r)))
 		return
 	}
 
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+)
+
+// gifFrameDelay is how long frame i is shown, in milliseconds. Like
+// browsers, delays under 20ms play as 100ms; many GIFs leave them at 0.
+func gifFrameDelay(g *gif.GIF, i int) int {
+	delay := 0
+	if i < len(g.Delay) {
+		delay = g.Delay[i] * 10
+	}
+	if delay < 20 {
+		delay = 100
+	}
+	return delay
+}
+
+// sampleGIFFrames picks at most maxFrames frames by playback time rather
+// than by frame number, so frames with long delays are not skipped in
+// favour of bursts of short ones. It returns the chosen frame indices and
+// how long each should be shown; the durations add up to the original
+// running time.
+func sampleGIFFrames(delays []int, maxFrames int) ([]int, []int) {
+	if len(delays) <= maxFrames {
+		indices := make([]int, len(delays))
+		durations := make([]int, len(delays))
+		for i, d := range delays {
+			indices[i] = i
+			durations[i] = d
+		}
+		return indices, durations
+	}
+
+	starts := make([]int, len(delays))
+	total := 0
+	for i, d := range delays {
+		starts[i] = total
+		total += d
+	}
+
+	var indices, durations []int
+	frame := 0
+	for k := 0; k < maxFrames; k++ {
+		t := k * total / maxFrames
+		end := (k + 1) * total / maxFrames
+		for frame+1 < len(starts) && starts[frame+1] <= t {
+			frame++
+		}
+		if n := len(indices); n > 0 && indices[n-1] == frame {
+			durations[n-1] += end - t
+			continue
+		}
+		indices = append(indices, frame)
+		durations = append(durations, end-t)
+	}
+	return indices, durations
+}
+
+// gifBackground is the colour disposal-to-background restores. A background
+// index outside the global palette, or one that is transparent, leaves the
+// canvas transparent.
+func gifBackground(g *gif.GIF) color.Color {
+	if palette, ok := g.Config.ColorModel.(color.Palette); ok && int(g.BackgroundIndex) < len(palette) {
+		return palette[g.BackgroundIndex]
+	}
+	return color.Transparent
+}
+
+// compositeGIF renders the frames listed in indices (ascending) as they
+// appear on screen. Frames are drawn in order onto a persistent canvas the
+// size of the GIF's logical screen, respecting each frame's bounds and
+// transparent pixels, and disposed of as g.Disposal says before the next
+// frame is drawn. visit is called with each wanted frame as it is drawn;
+// the canvas is reused afterwards, so visit must convert it before
+// returning rather than keep it.
+func compositeGIF(g *gif.GIF, indices []int, visit func(image.Image)) {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		for _, frame := range g.Image {
+			bounds = bounds.Union(frame.Bounds())
+		}
+	}
+	canvas := image.NewRGBA(bounds)
+	background := image.NewUniform(gifBackground(g))
+	draw.Draw(canvas, bounds, background, image.Point{}, draw.Src)
+
+	wanted := make(map[int]bool, len(indices))
+	last := -1
+	for _, i := range indices {
+		wanted[i] = true
+		if i > last {
+			last = i
+		}
+	}
+
+	var previous *image.RGBA
+	for i := 0; i <= last && i < len(g.Image); i++ {
+		frame := g.Image[i]
+		disposal := byte(gif.DisposalNone)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		if wanted[i] {
+			visit(canvas)
+		}
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), background, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+}
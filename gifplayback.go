@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+const (
+	minGifSpeed     = 0.1
+	maxGifSpeed     = 10
+	maxGifLoopCount = 1000
+	minGifFrameMs   = 20
+)
+
+// parseGifPlayback reads speed, reverse, pingPong, trimStart, trimEnd and
+// loopCount form values. It returns nil when none are given.
+func parseGifPlayback(r *http.Request) (*GifPlayback, error) {
+	var p GifPlayback
+	given := false
+	if v := r.FormValue("speed"); v != "" {
+		speed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("speed must be a number")
+		}
+		p.Speed = speed
+		given = true
+	}
+	for _, field := range []struct {
+		key string
+		dst *bool
+	}{{"reverse", &p.Reverse}, {"pingPong", &p.PingPong}} {
+		if v := r.FormValue(field.key); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be true or false", field.key)
+			}
+			*field.dst = b
+			given = true
+		}
+	}
+	for _, field := range []struct {
+		key string
+		dst *int
+	}{{"trimStart", &p.TrimStart}, {"trimEnd", &p.TrimEnd}, {"loopCount", &p.LoopCount}} {
+		if v := r.FormValue(field.key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an integer", field.key)
+			}
+			*field.dst = n
+			given = true
+		}
+	}
+	if !given {
+		return nil, nil
+	}
+	if err := validateGifPlayback(p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func validateGifPlayback(p GifPlayback) error {
+	if p.Speed != 0 && (p.Speed < minGifSpeed || p.Speed > maxGifSpeed) {
+		return fmt.Errorf("speed must be between %g and %g", minGifSpeed, float64(maxGifSpeed))
+	}
+	if p.TrimStart < 0 || p.TrimEnd < 0 {
+		return fmt.Errorf("trimStart and trimEnd must not be negative")
+	}
+	if p.LoopCount < 0 || p.LoopCount > maxGifLoopCount {
+		return fmt.Errorf("loopCount must be between 0 and %d", maxGifLoopCount)
+	}
+	return nil
+}
+
+// playbackOrder lists the frame indices of one loop of an n-frame
+// animation. Ping-pong plays forward then back without repeating the end
+// frames, so the loop joins up smoothly.
+func playbackOrder(n int, p *GifPlayback) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+		if p != nil && p.Reverse {
+			order[i] = n - 1 - i
+		}
+	}
+	if p != nil && p.PingPong && n > 2 {
+		for i := n - 2; i > 0; i-- {
+			order = append(order, order[i])
+		}
+	}
+	return order
+}
+
+// playbackDuration is how long a frame shows at the animation's speed.
+func playbackDuration(duration int, p *GifPlayback) int {
+	if p == nil || p.Speed <= 0 || p.Speed == 1 {
+		return duration
+	}
+	scaled := int(math.Round(float64(duration) / p.Speed))
+	if scaled < minGifFrameMs {
+		scaled = minGifFrameMs
+	}
+	return scaled
+}
+
+// activePlayback returns the playback options of the animation a device, or
+// the shared display when dev is nil, is showing. The caller must hold mutex.
+func activePlayback(dev *DeviceState) *GifPlayback {
+	source := customSource
+	if dev != nil && dev.IsCustomMode {
+		source = dev.CustomSource
+	} else if !isCustomMode {
+		return nil
+	}
+	if source == nil {
+		return nil
+	}
+	return source.Playback
+}
+
+// finishGifLoops hands the display back to the cycle once a device reports
+// that it has played the loop count of the animation it shows. The device
+// counts the loops; the server only passes loopCount on. It reports whether
+// the shared display changed. The caller must hold mutex.
+func finishGifLoops(dev *DeviceState) bool {
+	if p := activePlayback(dev); p == nil || p.LoopCount == 0 {
+		return false
+	}
+	if dev != nil && dev.IsCustomMode {
+		if dev.IsGifMode {
+			clearDeviceCustomMode(dev)
+			log.Printf("🎬 Animation on %s finished its loops, resuming the cycle", dev.ID)
+		}
+		return false
+	}
+	if !isGifMode {
+		return false
+	}
+	clearSharedCustomMode()
+	log.Printf("🎬 Animation finished its loops, resuming the cycle")
+	return true
+}
+
+// handleGifPlayback reads or changes the playback options of the animation
+// on screen. A POST changes only the fields it gives; the rest keep their
+// current values. Trimming happens before frames are sampled, so it can
+// only be set when uploading.
+func handleGifPlayback(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		mutex.Lock()
+		playback := activePlayback(resolveDevice(r))
+		mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"playback": playback})
+
+	case http.MethodPost:
+		var req struct {
+			Speed     *float64 `json:"speed"`
+			Reverse   *bool    `json:"reverse"`
+			PingPong  *bool    `json:"pingPong"`
+			LoopCount *int     `json:"loopCount"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		mutex.Lock()
+		dev := resolveDevice(r)
+		if dev != nil && !dev.IsCustomMode {
+			dev = nil
+		}
+		if !activeGifMode(dev) {
+			mutex.Unlock()
+			jsonError(w, "No animation is playing", http.StatusConflict)
+			return
+		}
+		source := customSource
+		if dev != nil {
+			source = dev.CustomSource
+		}
+		var playback GifPlayback
+		if source != nil && source.Playback != nil {
+			playback = *source.Playback
+		}
+		if req.Speed != nil {
+			playback.Speed = *req.Speed
+		}
+		if req.Reverse != nil {
+			playback.Reverse = *req.Reverse
+		}
+		if req.PingPong != nil {
+			playback.PingPong = *req.PingPong
+		}
+		if req.LoopCount != nil {
+			playback.LoopCount = *req.LoopCount
+		}
+		if err := validateGifPlayback(playback); err != nil {
+			mutex.Unlock()
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var updated CustomSource
+		if source != nil {
+			updated = *source
+		}
+		updated.Playback = &playback
+		setDisplayFrames(dev, activeFrames(dev), true, updated)
+		mutex.Unlock()
+
+		log.Printf("🎬 Playback updated: speed=%g reverse=%v pingPong=%v loops=%d", playback.Speed, playback.Reverse, playback.PingPong, playback.LoopCount)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "updated", "playback": playback})
+
+	default:
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -7,10 +7,17 @@ import (
 
 const configFile = "config.json"
 
+const customContentFile = "custom_content.json"
+
+const mediaDir = "media"
+
+const fontsDir = "fonts"
+
 var (
 	frames             []Frame
 	index              int
 	mutex              sync.Mutex
+	devices            = make(map[string]*DeviceState)
 	startTime          time.Time
 	isCustomMode       bool   = false
 	isGifMode          bool   = false
@@ -36,6 +43,28 @@ var (
 	analogShowSeconds bool = false
 	analogShowRoman   bool = false
 
+	nightMode = defaultNightMode()
+
+	notifications        []Notification
+	notificationCounter  int
+	activeNotificationID string
+
+	profiles      []Profile
+	activeProfile string
+
+	configHistory        []ConfigSnapshot
+	configHistoryCounter int
+	pendingConfigChanges []string
+
+	customSource       *CustomSource
+	customContentDirty bool
+
+	mediaAssets  = make(map[string]*MediaAsset)
+	mediaCounter int
+
+	// bitmapFonts is filled by loadFonts at startup and read-only after.
+	bitmapFonts = make(map[string]*BitmapFont)
+
 	cycleItems = []CycleItem{
 		{ID: "time-1", Type: "time", Label: "🕐 Time", Enabled: true, Duration: 3000},
 		{ID: "bcd-1", Type: "bcd", Label: "🔢 BCD Clock", Enabled: true, Duration: 3000},
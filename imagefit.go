@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+const (
+	fitContain = "fit"
+	fitFill    = "fill"
+	fitStretch = "stretch"
+	fitNative  = "native"
+	fitCrop    = "crop"
+)
+
+// imageAnchors maps an anchor name to its horizontal and vertical position
+// in halves: 0 is the left or top edge, 1 the centre, 2 the right or bottom.
+var imageAnchors = map[string][2]int{
+	"top-left":     {0, 0},
+	"top":          {1, 0},
+	"top-right":    {2, 0},
+	"left":         {0, 1},
+	"center":       {1, 1},
+	"right":        {2, 1},
+	"bottom-left":  {0, 2},
+	"bottom":       {1, 2},
+	"bottom-right": {2, 2},
+}
+
+// imageLayout describes how an image is scaled into a bitmap of Width x
+// Height and where that bitmap sits on the screen. Crop is in source pixels
+// and only used by the crop mode.
+type imageLayout struct {
+	Fit              string
+	Anchor           string
+	OffsetX, OffsetY int
+	Crop             image.Rectangle
+	X, Y             int
+	Width, Height    int
+}
+
+// defaultImageLayout letterboxes into the whole screen, centred.
+func defaultImageLayout() imageLayout {
+	return imageLayout{Fit: fitContain, Anchor: "center", Width: oledWidth, Height: oledHeight}
+}
+
+// parseImageLayout reads fit, anchor, offsetX/offsetY, the crop rectangle
+// and the bitmap's x, y, width and height from form values.
+func parseImageLayout(r *http.Request) (imageLayout, error) {
+	layout := defaultImageLayout()
+	if v := r.FormValue("fit"); v != "" {
+		validFits := map[string]bool{fitContain: true, fitFill: true, fitStretch: true, fitNative: true, fitCrop: true}
+		if !validFits[v] {
+			return layout, fmt.Errorf("invalid fit: %s", v)
+		}
+		layout.Fit = v
+	}
+	if v := r.FormValue("anchor"); v != "" {
+		if _, ok := imageAnchors[v]; !ok {
+			return layout, fmt.Errorf("invalid anchor: %s", v)
+		}
+		layout.Anchor = v
+	}
+
+	intValue := func(key string, min, max int, dst *int) error {
+		v := r.FormValue(key)
+		if v == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < min || n > max {
+			return fmt.Errorf("%s must be between %d and %d", key, min, max)
+		}
+		*dst = n
+		return nil
+	}
+	var cropX, cropY, cropW, cropH int
+	for _, field := range []struct {
+		key      string
+		min, max int
+		dst      *int
+	}{
+		{"offsetX", -oledWidth, oledWidth, &layout.OffsetX},
+		{"offsetY", -oledHeight, oledHeight, &layout.OffsetY},
+		{"width", 1, oledWidth, &layout.Width},
+		{"height", 1, oledHeight, &layout.Height},
+		{"cropX", 0, math.MaxInt32, &cropX},
+		{"cropY", 0, math.MaxInt32, &cropY},
+		{"cropWidth", 1, math.MaxInt32, &cropW},
+		{"cropHeight", 1, math.MaxInt32, &cropH},
+	} {
+		if err := intValue(field.key, field.min, field.max, field.dst); err != nil {
+			return layout, err
+		}
+	}
+	if err := intValue("x", 0, oledWidth-layout.Width, &layout.X); err != nil {
+		return layout, err
+	}
+	if err := intValue("y", 0, oledHeight-layout.Height, &layout.Y); err != nil {
+		return layout, err
+	}
+
+	if layout.Fit == fitCrop {
+		if cropW == 0 || cropH == 0 {
+			return layout, fmt.Errorf("crop requires cropWidth and cropHeight")
+		}
+		layout.Crop = image.Rect(cropX, cropY, cropX+cropW, cropY+cropH)
+	}
+	return layout, nil
+}
+
+// validateFor checks the crop rectangle against the source image size.
+func (l imageLayout) validateFor(width, height int) error {
+	if l.Fit == fitCrop && !l.Crop.In(image.Rect(0, 0, width, height)) {
+		return fmt.Errorf("crop rectangle must lie within the %dx%d image", width, height)
+	}
+	return nil
+}
+
+// place maps a source region of sw x sh pixels onto the bitmap. It returns
+// the destination rectangle, which may extend past the bitmap when the
+// image is cropped by fill or native mode.
+func (l imageLayout) place(sw, sh int) image.Rectangle {
+	width, height := l.Width, l.Height
+	dw, dh := width, height
+	switch l.Fit {
+	case fitStretch:
+	case fitNative:
+		dw, dh = sw, sh
+	case fitFill:
+		scale := math.Max(float64(width)/float64(sw), float64(height)/float64(sh))
+		dw = int(math.Ceil(float64(sw) * scale))
+		dh = int(math.Ceil(float64(sh) * scale))
+	default:
+		ratioSrc := float64(sw) / float64(sh)
+		ratioDst := float64(width) / float64(height)
+		if ratioSrc > ratioDst {
+			dh = int(float64(width) / ratioSrc)
+		} else {
+			dw = int(float64(height) * ratioSrc)
+		}
+	}
+
+	anchor, ok := imageAnchors[l.Anchor]
+	if !ok {
+		anchor = imageAnchors["center"]
+	}
+	x := (width-dw)*anchor[0]/2 + l.OffsetX
+	y := (height-dh)*anchor[1]/2 + l.OffsetY
+	return image.Rect(x, y, x+dw, y+dh)
+}
+
+// sourceRect is the part of the image the layout draws from.
+func (l imageLayout) sourceRect(bounds image.Rectangle) image.Rectangle {
+	if l.Fit == fitCrop {
+		return l.Crop.Add(bounds.Min).Intersect(bounds)
+	}
+	return bounds
+}
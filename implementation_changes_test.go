@@ -1,11 +1,21 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -393,3 +403,2002 @@ func TestApplyAutoFramesReplacesWhenNotCustomMode(t *testing.T) {
 		t.Fatalf("expected index clamped to 0, got %d", index)
 	}
 }
+
+func TestDevicesKeepIndependentCursors(t *testing.T) {
+	oldFrames := frames
+	oldIndex := index
+	oldDevices := devices
+	defer func() {
+		frames = oldFrames
+		index = oldIndex
+		devices = oldDevices
+	}()
+
+	frames = []Frame{
+		{Version: 1, Duration: 100, Clear: true, Elements: []Element{{Type: "text", Value: "1"}}},
+		{Version: 1, Duration: 100, Clear: true, Elements: []Element{{Type: "text", Value: "2"}}},
+		{Version: 1, Duration: 100, Clear: true, Elements: []Element{{Type: "text", Value: "3"}}},
+	}
+	index = 0
+	devices = make(map[string]*DeviceState)
+
+	advance := func(deviceID string) {
+		req := httptest.NewRequest(http.MethodGet, "/frame/next", nil)
+		req.Header.Set("X-Device-ID", deviceID)
+		nextFrame(httptest.NewRecorder(), req)
+	}
+
+	advance("desk-a")
+	advance("desk-a")
+	advance("desk-b")
+
+	if devices["desk-a"].Index != 2 {
+		t.Fatalf("expected desk-a at index 2, got %d", devices["desk-a"].Index)
+	}
+	if devices["desk-b"].Index != 1 {
+		t.Fatalf("expected desk-b at index 1, got %d", devices["desk-b"].Index)
+	}
+	if index != 0 {
+		t.Fatalf("expected shared index untouched, got %d", index)
+	}
+}
+
+func TestDeviceRegistryKeepsStoredDevices(t *testing.T) {
+	oldDevices := devices
+	defer func() { devices = oldDevices }()
+	devices = make(map[string]*DeviceState)
+
+	dim := 10
+	for i := 0; i < maxDevices; i++ {
+		dev := lookupDevice(fmt.Sprintf("desk-%d", i))
+		dev.Overrides.LedBrightness = &dim
+		dev.LastSeen = time.Now().Add(-time.Hour)
+	}
+	if dev := lookupDevice("intruder"); dev != nil || len(devices) != maxDevices {
+		t.Fatalf("expected a full registry of configured devices to refuse new ids, got %v", dev)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/frame/current", nil)
+	req.Header.Set("X-Device-ID", "intruder")
+	if resolveDevice(req) != nil {
+		t.Fatal("expected a refused device to get the shared display")
+	}
+
+	devices["desk-0"].Overrides = DeviceOverrides{}
+	if dev := lookupDevice("newcomer"); dev == nil || devices["desk-0"] != nil || devices["desk-1"] == nil {
+		t.Fatal("expected only the device without stored state to be evicted")
+	}
+}
+
+func TestDeviceCustomContentAndOverrides(t *testing.T) {
+	oldFrames := frames
+	oldCustomMode := isCustomMode
+	oldDevices := devices
+	oldBrightness := ledBrightness
+	defer func() {
+		frames = oldFrames
+		isCustomMode = oldCustomMode
+		devices = oldDevices
+		ledBrightness = oldBrightness
+	}()
+
+	frames = []Frame{{Version: 1, Duration: 100, Clear: true, Elements: []Element{{Type: "text", Value: "shared"}}}}
+	isCustomMode = false
+	ledBrightness = 100
+	devices = make(map[string]*DeviceState)
+	dim := 10
+	lookupDevice("desk-a").Overrides.LedBrightness = &dim
+
+	req := httptest.NewRequest(http.MethodPost, "/api/custom/text?device=desk-a", strings.NewReader(`{"text":"Hello"}`))
+	handleCustomText(httptest.NewRecorder(), req)
+
+	if isCustomMode {
+		t.Fatal("expected shared display to stay in auto mode")
+	}
+	if !hasTextElement(frames[0].Elements, "shared") {
+		t.Fatal("expected shared frames untouched")
+	}
+
+	rr := httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/frame/current", nil)
+	req.Header.Set("X-Device-ID", "desk-a")
+	currentFrame(rr, req)
+
+	var payload struct {
+		Elements      []Element `json:"elements"`
+		LedBrightness int       `json:"ledBrightness"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if !hasTextElement(payload.Elements, "Hello") {
+		t.Fatal("expected device to receive its custom text")
+	}
+	if payload.LedBrightness != 10 {
+		t.Fatalf("expected overridden brightness 10, got %d", payload.LedBrightness)
+	}
+}
+
+func TestFramesEventOnlyOnContentChange(t *testing.T) {
+	oldFrames := frames
+	oldIndex := index
+	defer func() {
+		frames = oldFrames
+		index = oldIndex
+	}()
+
+	ch, ok := subscribeEvents()
+	if !ok {
+		t.Fatal("expected to subscribe")
+	}
+	defer unsubscribeEvents(ch)
+
+	clock := []Frame{{Version: 1, Duration: 100, Clear: true, Elements: []Element{{Type: "text", Value: "12:00"}}}}
+	applyAutoFrames(clock, false)
+	applyAutoFrames(clock, false)
+
+	select {
+	case ev := <-ch:
+		if ev.Type != "frames" {
+			t.Fatalf("expected frames event, got %s", ev.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a frames event")
+	}
+	select {
+	case ev := <-ch:
+		t.Fatalf("expected no event for unchanged frames, got %s", ev.Type)
+	default:
+	}
+
+	applyAutoFrames([]Frame{{Version: 1, Duration: 100, Clear: true, Elements: []Element{{Type: "text", Value: "12:01"}}}}, false)
+	select {
+	case <-ch:
+	default:
+		t.Fatal("expected a frames event after content changed")
+	}
+}
+
+func TestFrameETagAnswersNotModified(t *testing.T) {
+	oldFrames := frames
+	oldIndex := index
+	oldCustomMode := isCustomMode
+	oldBrightness := ledBrightness
+	defer func() {
+		frames = oldFrames
+		index = oldIndex
+		isCustomMode = oldCustomMode
+		ledBrightness = oldBrightness
+	}()
+
+	frames = []Frame{{Version: 1, Duration: 100, Clear: true, Elements: []Element{{Type: "text", Value: "static"}}}}
+	index = 0
+	isCustomMode = false
+	ledBrightness = 50
+
+	rr := httptest.NewRecorder()
+	currentFrame(rr, httptest.NewRequest(http.MethodGet, "/frame/current", nil))
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with ETag, got %d %q", rr.Code, etag)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/frame/next", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	nextFrame(rr, req)
+	if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Fatalf("expected empty 304 for unchanged frame, got %d", rr.Code)
+	}
+
+	ledBrightness = 80
+	req = httptest.NewRequest(http.MethodGet, "/frame/current", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	currentFrame(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 after LED metadata changed, got %d", rr.Code)
+	}
+}
+
+func TestGifFullCompactEncodingAndGzip(t *testing.T) {
+	oldFrames := frames
+	oldCustomMode := isCustomMode
+	oldGifMode := isGifMode
+	oldFps := gifFps
+	defer func() {
+		frames = oldFrames
+		isCustomMode = oldCustomMode
+		isGifMode = oldGifMode
+		gifFps = oldFps
+	}()
+
+	bitmap := make([]int, 1024)
+	for i := range bitmap {
+		bitmap[i] = i % 256
+	}
+	frames = []Frame{{Version: 1, Duration: 100, Clear: true, Elements: []Element{{Type: "bitmap", Width: 128, Height: 64, Bitmap: bitmap}}}}
+	isCustomMode = true
+	isGifMode = true
+	gifFps = 0
+
+	req := httptest.NewRequest(http.MethodGet, "/api/gif/full?encoding=base64", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handleGifFull(rr, req)
+
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("expected gzip response")
+	}
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("invalid gzip: %v", err)
+	}
+	var resp GifFullResponse
+	if err := json.NewDecoder(zr).Decode(&resp); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+
+	el := resp.Frames[0].Elements[0]
+	if el.Bitmap != nil || el.Encoding != "base64" {
+		t.Fatalf("expected packed bitmap, got encoding %q", el.Encoding)
+	}
+	raw, err := base64.StdEncoding.DecodeString(el.Data)
+	if err != nil || len(raw) != 1024 || raw[255] != 255 {
+		t.Fatalf("packed bitmap did not round-trip: %v", err)
+	}
+	if len(frames[0].Elements[0].Bitmap) != 1024 {
+		t.Fatal("expected stored frame to keep its int bitmap")
+	}
+}
+
+func TestWidgetRegistryRendersAndValidates(t *testing.T) {
+	for _, widgetType := range []string{"time", "weather", "uptime", "text", "image", "pomodoro", "countdown", "qr", "bcd", "analog", "spotify", "moonphase", "wordclock", "snake"} {
+		if _, ok := lookupWidget(widgetType); !ok {
+			t.Fatalf("expected widget %q to be registered", widgetType)
+		}
+	}
+
+	ctx := WidgetContext{Now: time.Date(2025, 1, 1, 12, 30, 0, 0, time.UTC), Location: time.UTC}
+	got := buildCycleFrames(ctx, []CycleItem{
+		{Type: "text", Text: "Hi", Enabled: true},
+		{Type: "uptime", Enabled: false},
+		{Type: "unknown", Enabled: true},
+	}, renderWidget)
+	if len(got) != 1 || !hasTextElement(got[0].Elements, "Hi") || got[0].Duration != 3000 {
+		t.Fatalf("expected only the text frame with default duration, got %+v", got)
+	}
+
+	got = buildCycleFrames(ctx, nil, renderWidget)
+	if len(got) != 1 || !hasTextElement(got[0].Elements, "12:30") {
+		t.Fatalf("expected time fallback for an empty cycle, got %+v", got)
+	}
+
+	oldItems := cycleItems
+	defer func() { cycleItems = oldItems }()
+
+	for _, body := range []string{
+		`{"cycleItems":[{"type":"nope","enabled":true}]}`,
+		`{"cycleItems":[{"type":"countdown","targetDate":"soon","enabled":true}]}`,
+	} {
+		rr := httptest.NewRecorder()
+		handleSettings(rr, httptest.NewRequest(http.MethodPost, "/api/settings", strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", body, rr.Code)
+		}
+	}
+	if len(cycleItems) != len(oldItems) {
+		t.Fatal("expected rejected cycle to leave settings untouched")
+	}
+}
+
+func TestEnsureFramesCachesUntilInvalidated(t *testing.T) {
+	oldFrames := frames
+	oldIndex := index
+	oldCustomMode := isCustomMode
+	oldItems := cycleItems
+	oldStarted := rendererStarted
+	defer func() {
+		frames = oldFrames
+		index = oldIndex
+		isCustomMode = oldCustomMode
+		cycleItems = oldItems
+		rendererStarted = oldStarted
+		renderCache = make(map[string]renderCacheEntry)
+	}()
+
+	rendererStarted = true
+	renderCache = make(map[string]renderCacheEntry)
+	isCustomMode = false
+	cycleItems = []CycleItem{{ID: "t", Type: "text", Text: "first", Enabled: true}}
+
+	ensureFrames()
+	if len(frames) != 1 || !hasTextElement(frames[0].Elements, "first") {
+		t.Fatalf("expected rendered text frame, got %+v", frames)
+	}
+
+	cycleItems = []CycleItem{{ID: "t", Type: "text", Text: "second", Enabled: true}}
+	ensureFrames()
+	if !hasTextElement(frames[0].Elements, "first") {
+		t.Fatal("expected cached frame to be served until invalidated")
+	}
+
+	invalidateRenderCache()
+	ensureFrames()
+	if !hasTextElement(frames[0].Elements, "second") {
+		t.Fatal("expected frame re-rendered after invalidation")
+	}
+
+	isCustomMode = true
+	frames = []Frame{{Version: 1, Duration: 100, Clear: true, Elements: []Element{{Type: "text", Value: "custom"}}}}
+	ensureFrames()
+	if !hasTextElement(frames[0].Elements, "custom") {
+		t.Fatal("expected custom content to survive lazy rendering")
+	}
+}
+
+func TestPreviewPNGRasterizesFrames(t *testing.T) {
+	oldFrames := frames
+	oldIndex := index
+	oldCustomMode := isCustomMode
+	oldItems := cycleItems
+	defer func() {
+		frames = oldFrames
+		index = oldIndex
+		isCustomMode = oldCustomMode
+		cycleItems = oldItems
+	}()
+
+	frames = []Frame{
+		{Version: 1, Duration: 100, Clear: true, Elements: []Element{{Type: "text", Value: "A"}}},
+		{Version: 1, Duration: 100, Clear: true, Elements: []Element{{Type: "line", X: 0, Y: 10, Width: 128}}},
+	}
+	index = 1
+	isCustomMode = true
+	cycleItems = []CycleItem{{ID: "note", Type: "text", Text: "Hi", Enabled: false}}
+
+	rr := httptest.NewRecorder()
+	handlePreview(rr, httptest.NewRequest(http.MethodGet, "/api/preview.png?scale=2", nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/png" || rr.Header().Get("X-Frame-Index") != "1" {
+		t.Fatalf("expected PNG of the current frame, got %d %v", rr.Code, rr.Header())
+	}
+	img, err := png.Decode(rr.Body)
+	if err != nil {
+		t.Fatalf("invalid png: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 256 || b.Dy() != 128 {
+		t.Fatalf("expected 256x128 image at scale 2, got %v", b)
+	}
+	if r, _, _, _ := img.At(255, 21).RGBA(); r == 0 {
+		t.Fatal("expected line pixels to be lit")
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r != 0 {
+		t.Fatal("expected background pixels to be dark")
+	}
+
+	// "A" has its apex at column 2, row 0 of the glyph.
+	canvas, _ := rasterizeFrame(frames[0])
+	if !canvas.Pixel(2, 0) || canvas.Pixel(0, 0) {
+		t.Fatal("expected font5x7 glyph rendered at the origin")
+	}
+
+	rr = httptest.NewRecorder()
+	handlePreview(rr, httptest.NewRequest(http.MethodGet, "/api/preview.png?item=note", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected disabled cycle item to preview, got %d", rr.Code)
+	}
+
+	for _, query := range []string{"item=missing", "frame=5", "scale=0"} {
+		rr = httptest.NewRecorder()
+		handlePreview(rr, httptest.NewRequest(http.MethodGet, "/api/preview.png?"+query, nil))
+		if rr.Code == http.StatusOK {
+			t.Fatalf("expected error for %s", query)
+		}
+	}
+}
+
+func TestRasterizerDrawsBitmapsAndReportsClipping(t *testing.T) {
+	// 10x2 bitmap: two bytes per row, every pixel lit
+	bitmap := []int{0xFF, 0xC0, 0xFF, 0xC0}
+	frame := Frame{Elements: []Element{
+		{Type: "bitmap", X: 124, Y: 0, Width: 10, Height: 2, Bitmap: bitmap},
+		{Type: "bitmap", X: 0, Y: 10, Width: 10, Height: 2, Data: packBitmap(bitmap, bitmapEncodingHex), Encoding: bitmapEncodingHex},
+		{Type: "line", X: 200, Y: 0, Width: 5, Height: 1},
+		{Type: "bitmap", X: 0, Y: 20, Width: 16, Height: 16, Bitmap: bitmap},
+		{Type: "graph"},
+	}}
+
+	canvas, clipped := rasterizeFrame(frame)
+	if !canvas.Pixel(127, 1) || canvas.Pixel(123, 0) {
+		t.Fatal("expected clipped bitmap drawn with its own row stride")
+	}
+	if !canvas.Pixel(9, 11) || canvas.Pixel(10, 11) {
+		t.Fatal("expected packed partial-width bitmap drawn at its position")
+	}
+
+	want := []ClippedElement{
+		{Index: 0, Type: "bitmap", Reason: "clipped"},
+		{Index: 2, Type: "line", Reason: "offscreen"},
+		{Index: 3, Type: "bitmap", Reason: "invalid"},
+		{Index: 4, Type: "graph", Reason: "unsupported"},
+	}
+	if len(clipped) != len(want) {
+		t.Fatalf("expected %d reported elements, got %+v", len(want), clipped)
+	}
+	for i := range want {
+		if clipped[i] != want[i] {
+			t.Fatalf("report %d: expected %+v, got %+v", i, want[i], clipped[i])
+		}
+	}
+
+	flat := convertFrameToBitmap(frame)
+	if len(flat.Elements) != 1 || flat.Elements[0].Bitmap[10*16]&0x80 == 0 {
+		t.Fatal("expected flattened frame to keep bitmap elements")
+	}
+}
+
+func TestVectorPrimitivesAndClockPorts(t *testing.T) {
+	canvas, clipped := rasterizeFrame(Frame{Elements: []Element{
+		{Type: "segment", X1: 0, Y1: 0, X2: 9, Y2: 9},
+		{Type: "circle", X: 30, Y: 30, Radius: 5},
+		{Type: "circle", X: 60, Y: 30, Radius: 5, Filled: true},
+		{Type: "arc", X: 90, Y: 30, Radius: 5, EndAngle: 90},
+		{Type: "rect", X: 100, Y: 50, Width: 10, Height: 10, Radius: 3},
+		{Type: "polygon", Points: []int{0, 63, 10, 50, 20, 63}, Filled: true},
+	}})
+	if len(clipped) != 0 {
+		t.Fatalf("expected every primitive on-screen, got %+v", clipped)
+	}
+	checks := []struct {
+		x, y int
+		lit  bool
+		what string
+	}{
+		{5, 5, true, "segment diagonal"},
+		{35, 30, true, "circle outline"},
+		{30, 30, false, "hollow circle centre"},
+		{60, 30, true, "filled circle centre"},
+		{90, 25, true, "arc at 12 o'clock"},
+		{95, 30, true, "arc at 3 o'clock"},
+		{85, 30, false, "arc outside its sweep"},
+		{100, 50, false, "rounded rect corner"},
+		{105, 50, true, "rounded rect edge"},
+		{10, 60, true, "filled polygon"},
+	}
+	for _, c := range checks {
+		if canvas.Pixel(c.x, c.y) != c.lit {
+			t.Fatalf("%s: expected pixel (%d,%d) lit=%v", c.what, c.x, c.y, c.lit)
+		}
+	}
+
+	analog := generateAnalogFrame(1000, time.UTC, false, true, false)
+	if len(analog.Elements) > 40 {
+		t.Fatalf("expected analog clock built from vector elements, got %d elements", len(analog.Elements))
+	}
+	bcd := generateBCDFrame(1000, time.UTC, false, true, true)
+	for _, el := range bcd.Elements {
+		if el.Type != "circle" {
+			t.Fatalf("expected BCD LEDs drawn as circles, got %q", el.Type)
+		}
+	}
+	if _, clipped := rasterizeFrame(analog); len(clipped) != 0 {
+		t.Fatalf("expected analog clock to fit the screen, got %+v", clipped)
+	}
+}
+
+func TestCycleItemSchedules(t *testing.T) {
+	wednesdayNoon := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	morning := CycleItem{ID: "wx", Type: "text", Text: "Morning", Enabled: true, Schedule: []ScheduleRule{
+		{Days: []string{"mon", "tue", "wed", "thu", "fri"}, StartTime: "06:00", EndTime: "09:00"},
+	}}
+	overnight := CycleItem{ID: "late", Type: "text", Text: "Late", Enabled: true, Schedule: []ScheduleRule{
+		{Days: []string{"wed"}, StartTime: "22:00", EndTime: "02:00"},
+	}}
+	spring := CycleItem{ID: "spring", Type: "text", Text: "Spring", Enabled: true, Schedule: []ScheduleRule{
+		{StartDate: "2025-03-01", EndDate: "2025-05-31"},
+	}}
+
+	if isScheduledActive(morning, wednesdayNoon) {
+		t.Fatal("expected morning window to be closed at noon")
+	}
+	if next, ok := nextScheduledActive(morning, wednesdayNoon); !ok || !next.Equal(time.Date(2025, 1, 2, 6, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected next morning at Thursday 06:00, got %v", next)
+	}
+	if !isScheduledActive(overnight, time.Date(2025, 1, 2, 1, 30, 0, 0, time.UTC)) {
+		t.Fatal("expected Wednesday's overnight window to run past midnight")
+	}
+	if isScheduledActive(overnight, time.Date(2025, 1, 3, 1, 30, 0, 0, time.UTC)) {
+		t.Fatal("expected Thursday night to stay off")
+	}
+	if next, ok := nextScheduledActive(spring, wednesdayNoon); !ok || !next.Equal(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected spring item to start on March 1, got %v", next)
+	}
+
+	ctx := WidgetContext{Now: wednesdayNoon, Location: time.UTC}
+	got := buildCycleFrames(ctx, []CycleItem{morning, {Type: "text", Text: "Always", Enabled: true}}, renderWidget)
+	if len(got) != 1 || !hasTextElement(got[0].Elements, "Always") {
+		t.Fatalf("expected only the unscheduled item in the cycle, got %+v", got)
+	}
+
+	oldItems := cycleItems
+	oldLocation := displayLocation
+	defer func() {
+		cycleItems = oldItems
+		displayLocation = oldLocation
+	}()
+	displayLocation = time.UTC
+
+	rr := httptest.NewRecorder()
+	handleSettings(rr, httptest.NewRequest(http.MethodPost, "/api/settings", strings.NewReader(`{"cycleItems":[{"type":"time","enabled":true,"schedule":[{"days":["someday"]}]}]}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown weekday, got %d", rr.Code)
+	}
+
+	cycleItems = []CycleItem{spring}
+	rr = httptest.NewRecorder()
+	handleSettings(rr, httptest.NewRequest(http.MethodGet, "/api/settings", nil))
+	var settings Settings
+	if err := json.NewDecoder(rr.Body).Decode(&settings); err != nil {
+		t.Fatalf("invalid settings json: %v", err)
+	}
+	if len(settings.CycleItemStatus) != 1 || settings.CycleItemStatus[0].ID != "spring" {
+		t.Fatalf("expected a status for the scheduled item, got %+v", settings.CycleItemStatus)
+	}
+}
+
+func TestNightModeSwapsCycleAndQuietsLed(t *testing.T) {
+	oldFrames := frames
+	oldIndex := index
+	oldCustomMode := isCustomMode
+	oldItems := cycleItems
+	oldStarted := rendererStarted
+	oldNight := nightMode
+	oldLocation := displayLocation
+	oldBeacon := ledBeaconEnabled
+	defer func() {
+		frames = oldFrames
+		index = oldIndex
+		isCustomMode = oldCustomMode
+		cycleItems = oldItems
+		rendererStarted = oldStarted
+		nightMode = oldNight
+		displayLocation = oldLocation
+		ledBeaconEnabled = oldBeacon
+		renderCache = make(map[string]renderCacheEntry)
+	}()
+
+	displayLocation = time.UTC
+	now := time.Now().UTC()
+	rendererStarted = true
+	renderCache = make(map[string]renderCacheEntry)
+	isCustomMode = false
+	ledBeaconEnabled = true
+	cycleItems = []CycleItem{{ID: "t", Type: "text", Text: "busy", Enabled: true}}
+	nightMode = defaultNightMode()
+	nightMode.Enabled = true
+	nightMode.StartTime = now.Add(-time.Hour).Format("15:04")
+	nightMode.EndTime = now.Add(time.Hour).Format("15:04")
+
+	rr := httptest.NewRecorder()
+	currentFrame(rr, httptest.NewRequest(http.MethodGet, "/frame/current", nil))
+	var resp struct {
+		Elements         []Element `json:"elements"`
+		LedBeaconEnabled bool      `json:"ledBeaconEnabled"`
+		DisplayContrast  int       `json:"displayContrast"`
+		NightMode        bool      `json:"nightMode"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("invalid frame json: %v", err)
+	}
+	if !resp.NightMode || resp.LedBeaconEnabled || resp.DisplayContrast != nightMode.Contrast {
+		t.Fatalf("expected quiet night response, got %+v", resp)
+	}
+	if len(frames) != 1 || hasTextElement(resp.Elements, "busy") {
+		t.Fatalf("expected the cycle replaced by the night clock, got %+v", frames)
+	}
+
+	rr = httptest.NewRecorder()
+	handleNightMode(rr, httptest.NewRequest(http.MethodPost, "/api/settings/night", strings.NewReader(`{"enabled":false}`)))
+	if rr.Code != http.StatusOK || nightMode.Enabled || nightMode.StartTime == "" {
+		t.Fatalf("expected partial update to disable night mode, got %d %+v", rr.Code, nightMode)
+	}
+
+	rr = httptest.NewRecorder()
+	currentFrame(rr, httptest.NewRequest(http.MethodGet, "/frame/current", nil))
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("invalid frame json: %v", err)
+	}
+	if resp.NightMode || !resp.LedBeaconEnabled || resp.DisplayContrast != normalDisplayContrast || !hasTextElement(frames[0].Elements, "busy") {
+		t.Fatalf("expected normal cycle after night mode, got %+v", resp)
+	}
+
+	rr = httptest.NewRecorder()
+	handleNightMode(rr, httptest.NewRequest(http.MethodPost, "/api/settings/night", strings.NewReader(`{"startTime":"25:00"}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad window, got %d", rr.Code)
+	}
+}
+
+func TestNotificationQueuePreemptsCycle(t *testing.T) {
+	oldFrames := frames
+	oldIndex := index
+	oldCustomMode := isCustomMode
+	oldItems := cycleItems
+	oldStarted := rendererStarted
+	oldNotifications := notifications
+	oldActive := activeNotificationID
+	defer func() {
+		frames = oldFrames
+		index = oldIndex
+		isCustomMode = oldCustomMode
+		cycleItems = oldItems
+		rendererStarted = oldStarted
+		notifications = oldNotifications
+		activeNotificationID = oldActive
+		renderCache = make(map[string]renderCacheEntry)
+	}()
+
+	rendererStarted = true
+	renderCache = make(map[string]renderCacheEntry)
+	isCustomMode = false
+	cycleItems = []CycleItem{{ID: "t", Type: "text", Text: "busy", Enabled: true}}
+	notifications = nil
+	activeNotificationID = ""
+
+	notify := func(body string) (int, string) {
+		rr := httptest.NewRecorder()
+		handleNotify(rr, httptest.NewRequest(http.MethodPost, "/api/notify", strings.NewReader(body)))
+		var resp struct {
+			ID string `json:"id"`
+		}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return rr.Code, resp.ID
+	}
+	type frameResp struct {
+		Duration         int       `json:"duration"`
+		Elements         []Element `json:"elements"`
+		LedBeaconEnabled bool      `json:"ledBeaconEnabled"`
+		LedEffectMode    string    `json:"ledEffectMode"`
+		LedCustomColor   string    `json:"ledCustomColor"`
+	}
+	poll := func() frameResp {
+		rr := httptest.NewRecorder()
+		currentFrame(rr, httptest.NewRequest(http.MethodGet, "/frame/current", nil))
+		var resp frameResp
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("invalid frame json: %v", err)
+		}
+		return resp
+	}
+
+	if code, _ := notify(`{"text":"build passed","priority":1}`); code != http.StatusOK {
+		t.Fatalf("expected low priority notification queued, got %d", code)
+	}
+	code, doorbell := notify(`{"text":"DOORBELL","priority":9,"duration":2000,"repeat":3,"ledColor":"#FF0000","ledEffect":"flash"}`)
+	if code != http.StatusOK {
+		t.Fatalf("expected doorbell queued, got %d", code)
+	}
+
+	resp := poll()
+	if !hasTextElement(resp.Elements, "DOORBELL") || resp.LedCustomColor != "#FF0000" || resp.LedEffectMode != "flash" || !resp.LedBeaconEnabled {
+		t.Fatalf("expected the high priority notification with its LED override, got %+v", resp)
+	}
+	if resp.Duration <= 0 || resp.Duration > 2000 {
+		t.Fatalf("expected the remaining showing time as duration, got %d", resp.Duration)
+	}
+
+	mutex.Lock()
+	n := notifications[0]
+	gap := notificationFrame(n, n.StartedAt.Add(2100*time.Millisecond))
+	mutex.Unlock()
+	if len(gap.Elements) != 0 || gap.Duration != 150 {
+		t.Fatalf("expected a blank blink between repeats, got %+v", gap)
+	}
+
+	rr := httptest.NewRecorder()
+	handleNotify(rr, httptest.NewRequest(http.MethodGet, "/api/notify", nil))
+	var list struct {
+		Notifications []NotificationStatus `json:"notifications"`
+		Active        string               `json:"active"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil {
+		t.Fatalf("invalid list json: %v", err)
+	}
+	if len(list.Notifications) != 2 || list.Active != doorbell || !list.Notifications[0].Active {
+		t.Fatalf("expected both notifications with the doorbell active, got %+v", list)
+	}
+
+	rr = httptest.NewRecorder()
+	handleNotify(rr, httptest.NewRequest(http.MethodDelete, "/api/notify?id="+doorbell, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected dismiss to succeed, got %d", rr.Code)
+	}
+	if resp = poll(); !hasTextElement(resp.Elements, "build passed") {
+		t.Fatalf("expected the next notification after dismissing, got %+v", resp)
+	}
+
+	mutex.Lock()
+	notifications[0].StartedAt = time.Now().Add(-time.Minute)
+	mutex.Unlock()
+	if resp = poll(); !hasTextElement(resp.Elements, "busy") {
+		t.Fatalf("expected the cycle to resume once the queue drained, got %+v", resp)
+	}
+	if len(notifications) != 0 || activeNotificationID != "" {
+		t.Fatalf("expected an empty queue, got %+v", notifications)
+	}
+
+	for _, body := range []string{`{}`, `{"text":"x","repeat":11}`, `{"text":"x","ledEffect":"strobe"}`, `{"bitmap":[1,2],"width":8,"height":8}`} {
+		if code, _ := notify(body); code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", body, code)
+		}
+	}
+}
+
+func TestTextItemTemplates(t *testing.T) {
+	now := time.Date(2026, 12, 20, 9, 30, 0, 0, time.UTC)
+	ctx := WidgetContext{
+		Now:       now,
+		Location:  time.UTC,
+		StartTime: now.Add(-90 * time.Second),
+		Weather:   WeatherData{City: "Pune", Temperature: "24°C"},
+	}
+
+	frame := renderTextFrame(ctx, CycleItem{Type: "text", Text: `{{.Weather.Temperature}} in {{.Weather.City}}`, Duration: 3000})
+	if !hasTextElement(frame.Elements, "24°C in Pune") {
+		t.Fatalf("expected weather fields expanded, got %+v", frame.Elements)
+	}
+	frame = renderTextFrame(ctx, CycleItem{Type: "text", Text: `{{daysUntil "2026-12-25"}} days to Xmas, up {{.Uptime}}`, Duration: 3000})
+	if !hasTextElement(frame.Elements, "5 days to Xmas, up 1m30s") {
+		t.Fatalf("expected daysUntil and uptime expanded, got %+v", frame.Elements)
+	}
+	frame = renderTextFrame(ctx, CycleItem{Type: "text", Text: "plain {{ not", Duration: 3000})
+	if !hasTextElement(frame.Elements, "template error") {
+		t.Fatalf("expected a short error for a broken template, got %+v", frame.Elements)
+	}
+
+	if err := validateCycleItems([]CycleItem{{ID: "t", Type: "text", Text: `{{.Spotify.Name}} {{upper .Moon.PhaseName}}`}}); err != nil {
+		t.Fatalf("expected valid template, got %v", err)
+	}
+	for _, text := range []string{`{{.Weather.Humidity}}`, `{{daysUntil "xmas"}}`, `{{.Time`, `{{shout .Time}}`} {
+		err := validateCycleItems([]CycleItem{{ID: "t", Type: "text", Text: text}})
+		if err == nil || !strings.Contains(err.Error(), "template") {
+			t.Fatalf("expected a template error for %s, got %v", text, err)
+		}
+	}
+
+	// Runaway loops are stopped by the output limit or, when they write
+	// nothing, by the iteration limit.
+	for _, text := range []string{`{{range 1000000000}}xxxxxxxx{{end}}`, `{{range 1000000000}}{{end}}`, `{{range 100}}{{range 100}}{{end}}{{end}}`} {
+		start := time.Now()
+		if err := validateTextTemplate(text); err == nil || time.Since(start) > time.Second {
+			t.Fatalf("expected %s to be rejected quickly, got %v after %v", text, err, time.Since(start))
+		}
+	}
+	if err := validateTextTemplate(`{{range 3}}{{$.Time}} {{end}}`); err != nil {
+		t.Fatalf("expected a short range to be accepted, got %v", err)
+	}
+	long := CycleItem{Type: "text", Text: `{{upper .Spotify.Name}}`, Duration: 3000}
+	ctx.SpotifyTrack = &SpotifyTrack{Name: strings.Repeat("la ", 400)}
+	if expanded := expandTextItem(ctx, long.Text); len([]rune(expanded)) != maxTemplateOutput {
+		t.Fatalf("expected long data cut to %d characters, got %q", maxTemplateOutput, expanded)
+	}
+
+	w, _ := lookupWidget("text")
+	if ttl := w.(itemTTLWidget).ItemCacheTTL(CycleItem{Text: "{{.Time}}"}); ttl != time.Second {
+		t.Fatalf("expected templated text to refresh every second, got %v", ttl)
+	}
+	if ttl := w.(itemTTLWidget).ItemCacheTTL(CycleItem{Text: "hello"}); ttl != 0 {
+		t.Fatalf("expected plain text cached until changed, got %v", ttl)
+	}
+}
+
+func TestProfilesCaptureActivateAndSchedule(t *testing.T) {
+	oldItems := cycleItems
+	oldHeaders := showHeaders
+	oldEffect := ledEffectMode
+	oldRoman := analogShowRoman
+	oldProfiles := profiles
+	oldActive := activeProfile
+	oldOpen := profileWindowOpen
+	defer func() {
+		cycleItems = oldItems
+		showHeaders = oldHeaders
+		ledEffectMode = oldEffect
+		analogShowRoman = oldRoman
+		profiles = oldProfiles
+		activeProfile = oldActive
+		profileWindowOpen = oldOpen
+	}()
+
+	profiles = nil
+	activeProfile = ""
+	profileWindowOpen = make(map[string]bool)
+	cycleItems = []CycleItem{{ID: "t", Type: "text", Text: "focus", Enabled: true}}
+	showHeaders = false
+	ledEffectMode = "static"
+	analogShowRoman = true
+
+	post := func(url, body string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodPost, url, strings.NewReader(body)))
+		return rr
+	}
+
+	if rr := post("/api/profiles", `{"name":"Work","capture":true}`, handleProfiles); rr.Code != http.StatusOK {
+		t.Fatalf("expected capture to succeed, got %d %s", rr.Code, rr.Body.String())
+	}
+	party := `{"name":"Party","cycleItems":[{"id":"p","type":"text","text":"dance","enabled":true}],"showHeaders":true,"displayScale":"large","ledBrightness":100,"ledBeaconEnabled":true,"ledEffectMode":"rainbow","ledCustomColor":"#FF00FF","ledFlashSpeed":300,"ledPulseSpeed":1000,"schedule":[{"days":["fri","sat"],"startTime":"20:00","endTime":"02:00"}]}`
+	if rr := post("/api/profiles", party, handleProfiles); rr.Code != http.StatusOK {
+		t.Fatalf("expected explicit profile to save, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := post("/api/profiles/activate", `{"name":"Party"}`, handleProfileActivate); rr.Code != http.StatusOK {
+		t.Fatalf("expected activation, got %d", rr.Code)
+	}
+	if activeProfile != "Party" || cycleItems[0].Text != "dance" || !showHeaders || ledEffectMode != "rainbow" || analogShowRoman {
+		t.Fatalf("expected Party settings live, got profile=%s items=%+v", activeProfile, cycleItems)
+	}
+
+	post("/api/profiles/activate", `{"name":"Work"}`, handleProfileActivate)
+	if cycleItems[0].Text != "focus" || showHeaders || ledEffectMode != "static" || !analogShowRoman {
+		t.Fatalf("expected Work settings restored, got %+v", cycleItems)
+	}
+
+	friday := time.Date(2026, 10, 16, 19, 59, 0, 0, time.UTC)
+	mutex.Lock()
+	checkProfileSchedules(friday)
+	before := activeProfile
+	checkProfileSchedules(friday.Add(2 * time.Minute))
+	opened := activeProfile
+	activeProfile = "Work"
+	checkProfileSchedules(friday.Add(3 * time.Minute))
+	stuck := activeProfile
+	mutex.Unlock()
+	if before != "Work" || opened != "Party" || stuck != "Work" {
+		t.Fatalf("expected the schedule to switch only when its window opens, got %s/%s/%s", before, opened, stuck)
+	}
+
+	// A window already open at startup is seeded as seen, so the first
+	// check keeps the profile loaded from config.json.
+	mutex.Lock()
+	profileWindowOpen = openProfileWindows(friday.Add(2 * time.Minute))
+	checkProfileSchedules(friday.Add(3 * time.Minute))
+	startup := activeProfile
+	mutex.Unlock()
+	if startup != "Work" {
+		t.Fatalf("expected a window open at startup not to switch profiles, got %s", startup)
+	}
+
+	for _, body := range []string{`{"name":""}`, `{"name":"Bad","cycleItems":[]}`, `{"name":"Bad","capture":true,"schedule":[{"days":["someday"]}]}`} {
+		if rr := post("/api/profiles", body, handleProfiles); rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", body, rr.Code)
+		}
+	}
+	if rr := post("/api/profiles/activate", `{"name":"Nope"}`, handleProfileActivate); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown profile, got %d", rr.Code)
+	}
+
+	rr := httptest.NewRecorder()
+	handleProfiles(rr, httptest.NewRequest(http.MethodDelete, "/api/profiles?name=Work", nil))
+	if rr.Code != http.StatusOK || len(profiles) != 1 || activeProfile != "" {
+		t.Fatalf("expected Work deleted and no active profile, got %d %+v %q", rr.Code, profiles, activeProfile)
+	}
+
+	// Activation restarts device rotations; editing a setting by hand
+	// leaves the profile.
+	oldDevices, oldAutoPlay := devices, autoPlay
+	defer func() { devices, autoPlay = oldDevices, oldAutoPlay }()
+	devices = map[string]*DeviceState{"desk-a": {ID: "desk-a", Index: 3}}
+	post("/api/profiles/activate", `{"name":"Party"}`, handleProfileActivate)
+	if activeProfile != "Party" || devices["desk-a"].Index != 0 {
+		t.Fatalf("expected Party active with device cursors reset, got %q %d", activeProfile, devices["desk-a"].Index)
+	}
+	if rr := post("/api/settings", `{"autoPlay":true}`, handleSettings); rr.Code != http.StatusOK || activeProfile != "Party" {
+		t.Fatalf("expected settings outside the profile to keep it, got %d %q", rr.Code, activeProfile)
+	}
+	if rr := post("/api/settings", `{"showHeaders":false}`, handleSettings); rr.Code != http.StatusOK || activeProfile != "" {
+		t.Fatalf("expected a hand edit to clear the active profile, got %d %q", rr.Code, activeProfile)
+	}
+}
+
+func TestConfigExportImportAndMigration(t *testing.T) {
+	oldItems := cycleItems
+	oldCity := currentCity
+	oldBeacon := ledBeaconEnabled
+	oldEffect := ledEffectMode
+	oldSecret := spotifyCredentials.ClientSecret
+	oldProfiles := profiles
+	oldActive := activeProfile
+	oldLocation := displayLocation
+	defer func() {
+		cycleItems = oldItems
+		currentCity = oldCity
+		ledBeaconEnabled = oldBeacon
+		ledEffectMode = oldEffect
+		spotifyCredentials.ClientSecret = oldSecret
+		profiles = oldProfiles
+		activeProfile = oldActive
+		displayLocation = oldLocation
+	}()
+
+	cycleItems = []CycleItem{{ID: "t", Type: "text", Text: "exported", Enabled: true}}
+	spotifyCredentials.ClientSecret = "shh"
+
+	rr := httptest.NewRecorder()
+	handleConfigExport(rr, httptest.NewRequest(http.MethodGet, "/api/config/export", nil))
+	exported := rr.Body.String()
+	if rr.Code != http.StatusOK || strings.Contains(exported, "shh") || !strings.Contains(exported, `"schemaVersion": 2`) {
+		t.Fatalf("expected a versioned export without secrets, got %d %s", rr.Code, exported)
+	}
+
+	cycleItems = []CycleItem{{ID: "other", Type: "time", Enabled: true}}
+	importConfig := func(body, query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handleConfigImport(rr, httptest.NewRequest(http.MethodPost, "/api/config/import"+query, strings.NewReader(body)))
+		return rr
+	}
+	if rr := importConfig(exported, "?dryRun=true"); rr.Code != http.StatusOK || cycleItems[0].ID != "other" {
+		t.Fatalf("expected dry run to validate without applying, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := importConfig(exported, ""); rr.Code != http.StatusOK || cycleItems[0].Text != "exported" || spotifyCredentials.ClientSecret != "shh" {
+		t.Fatalf("expected import to restore the cycle and keep secrets, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	var legacy map[string]interface{}
+	json.Unmarshal([]byte(exported), &legacy)
+	delete(legacy, "schemaVersion")
+	legacyJSON, _ := json.Marshal(legacy)
+	config, from, err := decodeConfig(legacyJSON)
+	if err != nil || from != 1 || config.SchemaVersion != currentConfigVersion || config.CycleItems[0].Text != "exported" {
+		t.Fatalf("expected an unversioned config read as v1 and upgraded, got from=%d err=%v %+v", from, err, config.CycleItems)
+	}
+
+	legacy["schemaVersion"] = 2
+	legacy["ledEffectMode"] = "disco"
+	legacy["frameDuration"] = 1
+	legacy["widgetTheme"] = "dark"
+	badJSON, _ := json.Marshal(legacy)
+	rr = importConfig(string(badJSON), "")
+	var report struct {
+		Errors []ConfigFieldError `json:"errors"`
+	}
+	json.NewDecoder(rr.Body).Decode(&report)
+	fields := map[string]bool{}
+	for _, e := range report.Errors {
+		fields[e.Field] = true
+	}
+	if rr.Code != http.StatusBadRequest || !fields["ledEffectMode"] || !fields["frameDuration"] || !fields["widgetTheme"] || ledEffectMode == "disco" {
+		t.Fatalf("expected a per-field report and nothing applied, got %d %+v", rr.Code, report)
+	}
+
+	if rr := importConfig(`{"schemaVersion": 99}`, ""); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "newer") {
+		t.Fatalf("expected a newer schema to be rejected, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestConfigImportResetsOverridesAndNightMode(t *testing.T) {
+	oldDevices := devices
+	oldNight := nightMode
+	oldItems := cycleItems
+	oldWD, _ := os.Getwd()
+	defer func() {
+		devices = oldDevices
+		nightMode = oldNight
+		cycleItems = oldItems
+		os.Chdir(oldWD)
+	}()
+	os.Chdir(t.TempDir())
+
+	refresh := 1500
+	devices = map[string]*DeviceState{"desk-a": {Overrides: DeviceOverrides{EspRefreshDuration: &refresh}}}
+	nightMode = NightMode{Enabled: true, StartTime: "20:00", EndTime: "06:00", Contrast: 1}
+
+	rr := httptest.NewRecorder()
+	handleConfigExport(rr, httptest.NewRequest(http.MethodGet, "/api/config/export", nil))
+	var exported map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&exported)
+	delete(exported, "deviceOverrides")
+	delete(exported, "nightMode")
+	body, _ := json.Marshal(exported)
+
+	rr = httptest.NewRecorder()
+	handleConfigImport(rr, httptest.NewRequest(http.MethodPost, "/api/config/import", bytes.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the import to succeed, got %d %s", rr.Code, rr.Body.String())
+	}
+	if devices["desk-a"].Overrides.EspRefreshDuration != nil {
+		t.Fatalf("expected overrides missing from the file to be cleared, got %+v", devices["desk-a"].Overrides)
+	}
+	if nightMode.Enabled || nightMode.StartTime != defaultNightMode().StartTime {
+		t.Fatalf("expected night mode reset to its defaults, got %+v", nightMode)
+	}
+}
+
+func TestConfigHistoryDiffAndRestore(t *testing.T) {
+	oldItems := cycleItems
+	oldHeaders := showHeaders
+	oldHistory := configHistory
+	oldCounter := configHistoryCounter
+	oldPending := pendingConfigChanges
+	oldSecret := spotifyCredentials.ClientSecret
+	oldDevices := devices
+	defer func() {
+		cycleItems = oldItems
+		showHeaders = oldHeaders
+		configHistory = oldHistory
+		configHistoryCounter = oldCounter
+		pendingConfigChanges = oldPending
+		spotifyCredentials.ClientSecret = oldSecret
+		devices = oldDevices
+	}()
+
+	devices = make(map[string]*DeviceState)
+	configHistory = nil
+	configHistoryCounter = 0
+	pendingConfigChanges = nil
+	spotifyCredentials.ClientSecret = "shh"
+	now := time.Now()
+
+	mutex.Lock()
+	cycleItems = []CycleItem{{ID: "t", Type: "text", Text: "careful work", Enabled: true}}
+	showHeaders = false
+	noteConfigChange("cycleItems=1 items")
+	first := appendConfigHistory(snapshotConfig(), now)
+	again := appendConfigHistory(snapshotConfig(), now.Add(time.Second))
+	cycleItems = []CycleItem{{ID: "time-1", Type: "time", Enabled: true}}
+	showHeaders = true
+	noteConfigChange("reset to defaults")
+	appendConfigHistory(snapshotConfig(), now.Add(2*time.Second))
+	mutex.Unlock()
+
+	if len(first) != 1 || again != nil || len(configHistory) != 2 {
+		t.Fatalf("expected unchanged saves to be skipped, got %d snapshots", len(configHistory))
+	}
+	if configHistory[0].Changes[0] != "cycleItems=1 items" || configHistory[0].Config.SpotifyClientSecret != "" {
+		t.Fatalf("expected change list kept and secrets stripped, got %+v", configHistory[0])
+	}
+
+	rr := httptest.NewRecorder()
+	handleConfigHistory(rr, httptest.NewRequest(http.MethodGet, "/api/config/history", nil))
+	var list struct {
+		Snapshots []struct {
+			ID      int      `json:"id"`
+			Changes []string `json:"changes"`
+		} `json:"snapshots"`
+	}
+	json.NewDecoder(rr.Body).Decode(&list)
+	if len(list.Snapshots) != 2 || list.Snapshots[0].ID != 2 {
+		t.Fatalf("expected newest snapshot first, got %+v", list)
+	}
+
+	rr = httptest.NewRecorder()
+	handleConfigHistoryDiff(rr, httptest.NewRequest(http.MethodGet, "/api/config/history/diff?from=1&to=2", nil))
+	var diff struct {
+		Changes []ConfigDiffEntry `json:"changes"`
+	}
+	json.NewDecoder(rr.Body).Decode(&diff)
+	paths := map[string]string{}
+	for _, c := range diff.Changes {
+		paths[c.Path] = c.Op
+	}
+	if paths["showHeaders"] != "changed" || paths["cycleItems[0].text"] != "removed" || paths["cycleItems[0].type"] != "changed" {
+		t.Fatalf("expected headers and cycle item differences, got %+v", diff.Changes)
+	}
+
+	// An override added after the snapshot is not part of it, so the
+	// restore drops it.
+	rotation := 180
+	devices["desk-a"] = &DeviceState{Overrides: DeviceOverrides{DisplayRotation: &rotation}}
+
+	rr = httptest.NewRecorder()
+	handleConfigHistoryRestore(rr, httptest.NewRequest(http.MethodPost, "/api/config/history/restore", strings.NewReader(`{"id":1}`)))
+	if rr.Code != http.StatusOK || cycleItems[0].Text != "careful work" || showHeaders || spotifyCredentials.ClientSecret != "shh" {
+		t.Fatalf("expected snapshot 1 restored with credentials kept, got %d %+v", rr.Code, cycleItems)
+	}
+	if devices["desk-a"].Overrides.DisplayRotation != nil {
+		t.Fatalf("expected the override added after the snapshot to be gone, got %+v", devices["desk-a"].Overrides)
+	}
+	if len(pendingConfigChanges) != 1 || pendingConfigChanges[0] != "restored snapshot 1" {
+		t.Fatalf("expected the restore noted for the next snapshot, got %v", pendingConfigChanges)
+	}
+
+	rr = httptest.NewRecorder()
+	handleConfigHistoryRestore(rr, httptest.NewRequest(http.MethodPost, "/api/config/history/restore", strings.NewReader(`{"id":99}`)))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown snapshot, got %d", rr.Code)
+	}
+
+	// A fresh deploy records the config it started with, so the first
+	// change can be rolled back.
+	oldWD, _ := os.Getwd()
+	defer os.Chdir(oldWD)
+	os.Chdir(t.TempDir())
+	configHistory, configHistoryCounter, pendingConfigChanges = nil, 0, nil
+	seedConfigHistory()
+	seedConfigHistory()
+	if len(configHistory) != 1 || configHistory[0].Changes[0] != "loaded at startup" || configHistory[0].Config.CycleItems[0].Text != "careful work" {
+		t.Fatalf("expected the startup config recorded once, got %+v", configHistory)
+	}
+	if _, err := os.Stat(configHistoryFile); err != nil {
+		t.Fatalf("expected the seeded history written: %v", err)
+	}
+}
+
+func TestCustomContentSurvivesRestart(t *testing.T) {
+	oldFrames, oldIndex := frames, index
+	oldCustom, oldGif, oldSource := isCustomMode, isGifMode, customSource
+	oldDevices := devices
+	oldDirty := customContentDirty
+	defer func() {
+		frames, index = oldFrames, oldIndex
+		isCustomMode, isGifMode, customSource = oldCustom, oldGif, oldSource
+		devices = oldDevices
+		customContentDirty = oldDirty
+	}()
+	devices = make(map[string]*DeviceState)
+	isCustomMode, customSource, customContentDirty = false, nil, false
+
+	rr := httptest.NewRecorder()
+	handleQRCode(rr, httptest.NewRequest(http.MethodPost, "/api/qrcode", strings.NewReader(`{"data":"https://example.com"}`)))
+	if rr.Code != http.StatusOK || !customContentDirty {
+		t.Fatalf("expected the QR code shown and queued for saving, got %d", rr.Code)
+	}
+
+	mutex.Lock()
+	marquee := []Frame{
+		{Version: 1, Duration: 50, Elements: []Element{{Type: "bitmap", Width: 8, Height: 2, Bitmap: []int{0x81, 0x7E}}}},
+		{Version: 1, Duration: 50, Elements: []Element{{Type: "bitmap", Width: 8, Height: 2, Bitmap: []int{0x7E, 0x81}}}},
+	}
+	setDisplayFrames(lookupDevice("desk-2"), marquee, true, CustomSource{Type: "marquee", Params: map[string]interface{}{"text": "hi"}})
+	wantShared := frames
+	data, err := json.Marshal(snapshotCustomContent(time.Now()))
+	mutex.Unlock()
+	if err != nil {
+		t.Fatalf("encoding custom content: %v", err)
+	}
+	if strings.Contains(string(data), `"bitmap":[`) {
+		t.Fatalf("expected packed bitmaps in the sidecar, got %s", data)
+	}
+
+	// Simulate a restart: nothing is in memory until the file is read back.
+	devices = make(map[string]*DeviceState)
+	isCustomMode, isGifMode, customSource = false, false, nil
+	frames = []Frame{{Duration: 1000, Elements: []Element{{Type: "text", Value: "BOOTING..."}}}}
+
+	var store CustomContentFile
+	if err := json.Unmarshal(data, &store); err != nil {
+		t.Fatalf("decoding custom content: %v", err)
+	}
+	mutex.Lock()
+	restored := restoreCustomContent(store)
+	mutex.Unlock()
+
+	if restored != 2 || !isCustomMode || isGifMode || customSource == nil || customSource.Type != "qr" || customSource.Params["data"] != "https://example.com" {
+		t.Fatalf("expected the shared QR code restored, got %d %v %+v", restored, isCustomMode, customSource)
+	}
+	if !reflect.DeepEqual(frames, wantShared) {
+		t.Fatalf("expected shared frames restored exactly")
+	}
+	dev := devices["desk-2"]
+	if dev == nil || !dev.IsCustomMode || !dev.IsGifMode || dev.CustomSource.Type != "marquee" || !reflect.DeepEqual(dev.Frames, marquee) {
+		t.Fatalf("expected the device marquee restored, got %+v", dev)
+	}
+
+	mutex.Lock()
+	customContentDirty = false
+	clearDeviceCustomMode(dev)
+	empty := snapshotCustomContent(time.Now())
+	mutex.Unlock()
+	if !customContentDirty || empty.Devices != nil || empty.Shared == nil {
+		t.Fatalf("expected clearing a device to drop only its content, got %+v", empty)
+	}
+}
+
+func TestMediaLibraryAssetsInCycle(t *testing.T) {
+	oldWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd failed: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("chdir tmp failed: %v", err)
+	}
+	oldAssets, oldCounter, oldItems := mediaAssets, mediaCounter, cycleItems
+	defer func() {
+		_ = os.Chdir(oldWD)
+		mediaAssets, mediaCounter, cycleItems = oldAssets, oldCounter, oldItems
+	}()
+	mediaAssets, mediaCounter = make(map[string]*MediaAsset), 0
+
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{}
+	for i := 0; i < 2; i++ {
+		img := image.NewPaletted(image.Rect(0, 0, 16, 8), palette)
+		img.SetColorIndex(i*8, 0, 1)
+		anim.Image = append(anim.Image, img)
+		anim.Delay = append(anim.Delay, 20)
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "blink.gif")
+	if err := gif.EncodeAll(part, anim); err != nil {
+		t.Fatalf("encoding gif: %v", err)
+	}
+	form.WriteField("name", "Blink")
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/media", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rr := httptest.NewRecorder()
+	handleMedia(rr, req)
+	var asset MediaAsset
+	json.NewDecoder(rr.Body).Decode(&asset)
+	if rr.Code != http.StatusOK || asset.ID != "asset-1" || asset.Name != "Blink" || !asset.Animated || asset.FrameCount != 2 || asset.Frames != nil {
+		t.Fatalf("expected an animated asset stored, got %d %+v", rr.Code, asset)
+	}
+	if _, err := os.Stat(filepath.Join(mediaDir, "asset-1.json")); err != nil {
+		t.Fatalf("expected the asset written to disk: %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	handleMediaThumbnail(rr, httptest.NewRequest(http.MethodGet, "/api/media/thumbnail?id=asset-1&frame=1&scale=2", nil))
+	thumb, err := png.Decode(rr.Body)
+	if rr.Code != http.StatusOK || err != nil || thumb.Bounds().Dx() != 256 {
+		t.Fatalf("expected a 256px thumbnail, got %d %v", rr.Code, err)
+	}
+
+	item := CycleItem{ID: "anim", Type: "image", AssetID: "asset-1", Enabled: true, Duration: 1000}
+	if err := validateCycleItems([]CycleItem{item}); err != nil {
+		t.Fatalf("expected an asset item to validate: %v", err)
+	}
+	mutex.Lock()
+	cycleItems = []CycleItem{item}
+	ctx := snapshotWidgetContext()
+	mutex.Unlock()
+	looped := renderWidget(ctx, "test", item)
+	if len(looped) != 6 || looped[0].Duration != 200 {
+		t.Fatalf("expected the animation looped to fill 1000ms, got %d frames", len(looped))
+	}
+
+	// The device is served each animation frame for its own duration, not
+	// the refresh interval.
+	oldFrames, oldIndex, oldCustom, oldRefresh := frames, index, isCustomMode, espRefreshDuration
+	defer func() { frames, index, isCustomMode, espRefreshDuration = oldFrames, oldIndex, oldCustom, oldRefresh }()
+	still := Frame{Version: 1, Duration: 5000, Clear: true, Elements: []Element{{Type: "text", Value: "still"}}}
+	frames, index, isCustomMode, espRefreshDuration = append([]Frame{still}, looped...), 0, false, 3000
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		nextFrame(rr, httptest.NewRequest(http.MethodGet, "/frame/next", nil))
+		var served struct {
+			Duration int `json:"duration"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &served)
+		if served.Duration != 200 {
+			t.Fatalf("expected animation frame %d served for 200ms, got %d", i, served.Duration)
+		}
+	}
+	index = 0
+	rr = httptest.NewRecorder()
+	currentFrame(rr, httptest.NewRequest(http.MethodGet, "/frame/current", nil))
+	if !strings.Contains(rr.Body.String(), `"duration":3000`) {
+		t.Fatalf("expected other cycle frames to keep the refresh interval, got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handleMedia(rr, httptest.NewRequest(http.MethodDelete, "/api/media?id=asset-1", nil))
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected deleting an asset in use to fail, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handleMediaRename(rr, httptest.NewRequest(http.MethodPost, "/api/media/rename", strings.NewReader(`{"id":"asset-1","name":"Heartbeat"}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected rename to succeed, got %d", rr.Code)
+	}
+
+	want := mediaAssets["asset-1"].Frames
+	mediaAssets, mediaCounter = make(map[string]*MediaAsset), 0
+	loadMediaLibrary()
+	reloaded := mediaAssets["asset-1"]
+	if reloaded == nil || reloaded.Name != "Heartbeat" || mediaCounter != 1 || !reflect.DeepEqual(reloaded.Frames, want) {
+		t.Fatalf("expected the renamed asset reloaded from disk, got %+v", reloaded)
+	}
+
+	cycleItems = nil
+	rr = httptest.NewRecorder()
+	handleMedia(rr, httptest.NewRequest(http.MethodDelete, "/api/media?id=asset-1", nil))
+	if _, err := os.Stat(filepath.Join(mediaDir, "asset-1.json")); rr.Code != http.StatusOK || !os.IsNotExist(err) {
+		t.Fatalf("expected the asset deleted, got %d %v", rr.Code, err)
+	}
+
+	// A restore or import can bring back an item whose asset is gone.
+	statuses := cycleItemStatuses([]CycleItem{{ID: "img", Type: "image", AssetID: "asset-1", Enabled: true}}, time.Now())
+	if statuses[0].Problem == "" {
+		t.Fatal("expected an item with a missing asset to report a problem")
+	}
+}
+
+func TestDitheringAlgorithms(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 128, 64))
+	for i := range gray.Pix {
+		gray.Pix[i] = 100
+	}
+	litShare := func(bitmap []int) float64 {
+		on := 0
+		for _, b := range bitmap {
+			for bit := 0; bit < 8; bit++ {
+				on += b >> bit & 1
+			}
+		}
+		return float64(on) / (128 * 64)
+	}
+
+	opts := defaultDitherOptions()
+	if share := litShare(processImageToBitmap(gray, defaultImageLayout(), opts)); share != 0 {
+		t.Fatalf("expected the default threshold to leave grey 100 dark, got %.2f lit", share)
+	}
+	for _, algorithm := range []string{ditherFloydSteinberg, ditherAtkinson, ditherOrdered} {
+		opts.Algorithm = algorithm
+		share := litShare(processImageToBitmap(gray, defaultImageLayout(), opts))
+		if share < 0.25 || share > 0.55 {
+			t.Fatalf("expected %s to light about 40%% of the pixels, got %.2f", algorithm, share)
+		}
+	}
+
+	opts = defaultDitherOptions()
+	opts.Invert = true
+	if share := litShare(processImageToBitmap(gray, defaultImageLayout(), opts)); share != 1 {
+		t.Fatalf("expected invert to light every pixel, got %.2f", share)
+	}
+	opts.Invert = false
+	opts.Brightness = 20
+	if share := litShare(processImageToBitmap(gray, defaultImageLayout(), opts)); share != 1 {
+		t.Fatalf("expected brightness to lift grey over the threshold, got %.2f", share)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/upload?dither=sharpie", nil)
+	rr := httptest.NewRecorder()
+	handleUpload(rr, req)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "invalid dither") {
+		t.Fatalf("expected an unknown dither to be rejected, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestImageFitModesAndPlacement(t *testing.T) {
+	// 256x64: white on the left half, black on the right.
+	wide := image.NewGray(image.Rect(0, 0, 256, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 128; x++ {
+			wide.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	lit := func(bitmap []int, width, x, y int) bool {
+		return bitmap[y*((width+7)/8)+x/8]&(0x80>>(x%8)) != 0
+	}
+	dither := defaultDitherOptions()
+
+	layout := defaultImageLayout()
+	fitted := processImageToBitmap(wide, layout, dither)
+	if lit(fitted, 128, 10, 0) || !lit(fitted, 128, 10, 20) || lit(fitted, 128, 100, 20) {
+		t.Fatalf("expected fit to letterbox the wide image vertically")
+	}
+
+	layout.Fit = fitFill
+	layout.Anchor = "left"
+	if filled := processImageToBitmap(wide, layout, dither); !lit(filled, 128, 127, 0) || !lit(filled, 128, 0, 63) {
+		t.Fatalf("expected fill anchored left to cover the screen with the white half")
+	}
+	layout.Anchor = "right"
+	if filled := processImageToBitmap(wide, layout, dither); lit(filled, 128, 0, 0) {
+		t.Fatalf("expected fill anchored right to show the black half")
+	}
+
+	layout.Fit = fitStretch
+	if stretched := processImageToBitmap(wide, layout, dither); !lit(stretched, 128, 0, 0) || !lit(stretched, 128, 63, 63) || lit(stretched, 128, 64, 0) {
+		t.Fatalf("expected stretch to squeeze the white half into the left 64 columns")
+	}
+
+	layout = defaultImageLayout()
+	layout.Fit, layout.Anchor, layout.OffsetX = fitNative, "top-left", 4
+	if native := processImageToBitmap(wide, layout, dither); lit(native, 128, 3, 0) || !lit(native, 128, 4, 0) || !lit(native, 128, 127, 63) {
+		t.Fatalf("expected native size shifted 4 pixels right")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/upload?fit=crop&cropX=120&cropY=0&cropWidth=16&cropHeight=16&width=32&height=16&x=96&y=48", nil)
+	layout, err := parseImageLayout(req)
+	if err != nil {
+		t.Fatalf("parsing layout: %v", err)
+	}
+	if err := layout.validateFor(256, 64); err != nil {
+		t.Fatalf("expected the crop to fit the image: %v", err)
+	}
+	small := processImageToBitmap(wide, layout, dither)
+	if len(small) != 4*16 || !lit(small, 32, 8, 0) || lit(small, 32, 23, 0) {
+		t.Fatalf("expected a 32x16 bitmap of the white/black edge, got %d bytes", len(small))
+	}
+	if err := layout.validateFor(100, 10); err == nil {
+		t.Fatalf("expected a crop outside the image to be rejected")
+	}
+	if _, err := parseImageLayout(httptest.NewRequest(http.MethodPost, "/api/upload?width=64&x=80", nil)); err == nil {
+		t.Fatalf("expected a bitmap past the right edge to be rejected")
+	}
+}
+
+func TestGifFullPagesWithinDeviceBudget(t *testing.T) {
+	oldFrames := frames
+	oldCustomMode := isCustomMode
+	oldGifMode := isGifMode
+	oldFps := gifFps
+	defer func() {
+		frames = oldFrames
+		isCustomMode = oldCustomMode
+		isGifMode = oldGifMode
+		gifFps = oldFps
+	}()
+
+	frames = make([]Frame, 30)
+	for i := range frames {
+		bitmap := make([]int, 1024)
+		bitmap[0] = i
+		frames[i] = Frame{Version: 1, Duration: 100, Clear: true, Elements: []Element{{Type: "bitmap", Width: 128, Height: 64, Bitmap: bitmap}}}
+	}
+	frames[3] = Frame{Version: 1, Duration: 100, Clear: true, Elements: []Element{{Type: "bitmap", X: 8, Y: 8, Width: 8, Height: 8, Bitmap: []int{255, 255, 255, 255, 255, 255, 255, 255}}}}
+	isCustomMode = true
+	isGifMode = true
+	gifFps = 0
+
+	fetch := func(query string, header map[string]string) GifFullResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/gif/full"+query, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		handleGifFull(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", query, rr.Code, rr.Body.String())
+		}
+		var resp GifFullResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: invalid json: %v", query, err)
+		}
+		return resp
+	}
+
+	device := map[string]string{"X-ESP32-Max-Frames": "12"}
+	var seen []int
+	offset := 0
+	for page := 0; ; page++ {
+		resp := fetch(fmt.Sprintf("?offset=%d", offset), device)
+		if resp.Offset != offset || resp.TotalFrames != 30 || resp.FrameCount != len(resp.Frames) || resp.FrameCount > 12 {
+			t.Fatalf("page %d: unexpected window %+v", page, resp)
+		}
+		for _, frame := range resp.Frames {
+			seen = append(seen, frame.Elements[0].Bitmap[0])
+		}
+		if !resp.HasMore {
+			if resp.NextOffset != 0 {
+				t.Fatalf("expected last window to point back to 0, got %d", resp.NextOffset)
+			}
+			break
+		}
+		offset = resp.NextOffset
+	}
+	if len(seen) != 30 || seen[29] != 29 {
+		t.Fatalf("expected all 30 frames across the windows, got %d", len(seen))
+	}
+
+	flat := fetch("?offset=3&limit=1", device).Frames[0].Elements
+	if len(flat) != 1 || flat[0].Width != 128 || flat[0].Height != 64 || flat[0].Bitmap[8*16+1] != 255 {
+		t.Fatalf("expected placed bitmap to be flattened to full screen, got %+v", flat)
+	}
+
+	if resp := fetch("?limit=5", nil); resp.FrameCount != 5 || resp.NextOffset != 5 {
+		t.Fatalf("expected limit to cap the window, got %d frames", resp.FrameCount)
+	}
+	if resp := fetch("", map[string]string{"X-ESP32-Max-Frames": "60", "X-ESP32-Max-Payload": "8192"}); resp.FrameCount == 0 || resp.FrameCount >= 30 {
+		t.Fatalf("expected payload budget to cap the window, got %d frames", resp.FrameCount)
+	}
+	if resp := fetch("?offset=99", device); resp.Offset != 0 {
+		t.Fatalf("expected an offset past the end to restart, got %d", resp.Offset)
+	}
+}
+
+func TestGifFramesCompositeWithDisposal(t *testing.T) {
+	palette := color.Palette{color.Black, color.White, color.Transparent}
+	frame := func(rect image.Rectangle, index uint8) *image.Paletted {
+		img := image.NewPaletted(rect, palette)
+		for i := range img.Pix {
+			img.Pix[i] = index
+		}
+		return img
+	}
+	first := frame(image.Rect(0, 0, 16, 8), 0)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			first.SetColorIndex(x, y, 1)
+		}
+	}
+	right := image.Rect(8, 0, 16, 8)
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			first,
+			frame(right, 1),
+			frame(image.Rect(0, 0, 4, 4), 2),
+			frame(right, 1),
+			frame(image.Rect(0, 0, 1, 1), 2),
+		},
+		Delay:    []int{10, 10, 10, 10, 10},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalNone, gif.DisposalPrevious, gif.DisposalNone},
+		Config:   image.Config{ColorModel: palette, Width: 16, Height: 8},
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatalf("encode gif: %v", err)
+	}
+
+	opts := uploadOptions{MaxFrames: 10, Dither: defaultDitherOptions(), Layout: defaultImageLayout()}
+	converted, err := convertImage(&buf, "gif", opts)
+	if err != nil || len(converted) != 5 {
+		t.Fatalf("expected 5 frames, got %d (%v)", len(converted), err)
+	}
+	// Row 32 of the 128-pixel bitmap: byte 2 is in the left half, byte 12 in the right.
+	want := [][2]int{{255, 0}, {255, 255}, {255, 0}, {255, 255}, {255, 0}}
+	for i, frame := range converted {
+		bitmap := frame.Elements[0].Bitmap
+		if got := [2]int{bitmap[32*16+2], bitmap[32*16+12]}; got != want[i] {
+			t.Fatalf("frame %d: expected halves %v, got %v", i, want[i], got)
+		}
+	}
+
+	indices, durations := sampleGIFFrames([]int{1000, 100, 100, 100, 100, 100}, 3)
+	if !reflect.DeepEqual(indices, []int{0, 1}) || !reflect.DeepEqual(durations, []int{1000, 500}) {
+		t.Fatalf("expected sampling by playback time, got %v %v", indices, durations)
+	}
+
+	// A one-pixel GIF may declare a huge logical screen; it is refused
+	// before anything is allocated for it.
+	huge := &gif.GIF{
+		Image:  []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black, color.White})},
+		Delay:  []int{10},
+		Config: image.Config{Width: 60000, Height: 60000},
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "huge.gif")
+	if err := gif.EncodeAll(part, huge); err != nil {
+		t.Fatalf("encoding gif: %v", err)
+	}
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rr := httptest.NewRecorder()
+	if _, _, _, ok := readUploadedImage(rr, req, uploadOptions{Layout: defaultImageLayout(), MaxFrames: 10}); ok || rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected an oversized logical screen to be rejected, got %d", rr.Code)
+	}
+}
+
+func TestGifPlaybackOptions(t *testing.T) {
+	oldWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd failed: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("chdir tmp failed: %v", err)
+	}
+	oldFrames, oldCustomMode, oldGifMode, oldFps := frames, isCustomMode, isGifMode, gifFps
+	oldSource := customSource
+	defer func() {
+		_ = os.Chdir(oldWD)
+		frames, isCustomMode, isGifMode, gifFps = oldFrames, oldCustomMode, oldGifMode, oldFps
+		customSource = oldSource
+	}()
+	gifFps = 0
+
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{}
+	for i := 0; i < 6; i++ {
+		img := image.NewPaletted(image.Rect(0, 0, 16, 8), palette)
+		img.SetColorIndex(i, 0, 1)
+		anim.Image = append(anim.Image, img)
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatalf("encoding gif: %v", err)
+	}
+	opts := uploadOptions{MaxFrames: 10, Dither: defaultDitherOptions(), Layout: defaultImageLayout(), Playback: &GifPlayback{TrimStart: 1, TrimEnd: 1}}
+	trimmed, err := convertImage(bytes.NewReader(buf.Bytes()), "gif", opts)
+	if err != nil || len(trimmed) != 4 {
+		t.Fatalf("expected trimming to keep 4 frames, got %d (%v)", len(trimmed), err)
+	}
+	opts.Playback = &GifPlayback{TrimStart: 3, TrimEnd: 3}
+	if _, err := convertImage(bytes.NewReader(buf.Bytes()), "gif", opts); err == nil {
+		t.Fatal("expected trimming every frame to fail")
+	}
+
+	content := make([]Frame, 4)
+	for i := range content {
+		content[i] = Frame{Version: 1, Duration: 100, Clear: true, Elements: []Element{{Type: "bitmap", Width: 128, Height: 64, Bitmap: []int{i}}}}
+	}
+	mutex.Lock()
+	setDisplayFrames(nil, content, true, CustomSource{Type: "upload", Playback: &GifPlayback{Speed: 2, Reverse: true, PingPong: true, LoopCount: 2}})
+	mutex.Unlock()
+
+	fetch := func() GifFullResponse {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handleGifFull(rr, httptest.NewRequest(http.MethodGet, "/api/gif/full?limit=10", nil))
+		var resp GifFullResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid json: %v", err)
+		}
+		return resp
+	}
+	resp := fetch()
+	var order []int
+	for _, frame := range resp.Frames {
+		order = append(order, frame.Elements[0].Bitmap[0])
+		if frame.Duration != 50 {
+			t.Fatalf("expected speed 2 to halve the delay, got %d", frame.Duration)
+		}
+	}
+	if !reflect.DeepEqual(order, []int{3, 2, 1, 0, 1, 2}) || resp.TotalFrames != 6 || resp.LoopCount != 2 {
+		t.Fatalf("expected reversed ping-pong order, got %v (total %d, loops %d)", order, resp.TotalFrames, resp.LoopCount)
+	}
+
+	// Fields left out of an update keep their values.
+	rr := httptest.NewRecorder()
+	handleGifPlayback(rr, httptest.NewRequest(http.MethodPost, "/api/gif/playback", strings.NewReader(`{"loopCount":5}`)))
+	if p := customSource.Playback; rr.Code != http.StatusOK || p.Speed != 2 || !p.Reverse || !p.PingPong || p.LoopCount != 5 {
+		t.Fatalf("expected a partial update to keep the other options, got %d %+v", rr.Code, *p)
+	}
+
+	rr = httptest.NewRecorder()
+	handleGifPlayback(rr, httptest.NewRequest(http.MethodPost, "/api/gif/playback", strings.NewReader(`{"speed":0.5,"reverse":false,"pingPong":false,"loopCount":1}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("playback update failed: %d %s", rr.Code, rr.Body.String())
+	}
+	resp = fetch()
+	if len(resp.Frames) != 4 || resp.Frames[0].Duration != 200 || resp.Frames[0].Elements[0].Bitmap[0] != 0 {
+		t.Fatalf("expected updated playback to apply, got %d frames", len(resp.Frames))
+	}
+	if customSource.Playback.Reverse || customSource.Playback.LoopCount != 1 {
+		t.Fatalf("expected the update to change the stored options, got %+v", *customSource.Playback)
+	}
+
+	// The device counts the loops itself; the server only reports them
+	// and keeps serving the animation.
+	if resp := fetch(); !resp.IsGifMode || resp.LoopCount != 1 || !isCustomMode {
+		t.Fatalf("expected the animation kept with its loop count reported, got gif=%v loops=%d", resp.IsGifMode, resp.LoopCount)
+	}
+
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/gif/full", nil)
+	req.Header.Set("X-ESP32-Loops-Done", "1")
+	handleGifFull(rr, req)
+	if strings.Contains(rr.Body.String(), `"isGifMode":true`) || isCustomMode || customSource != nil {
+		t.Fatalf("expected the device's report to hand the display back to the cycle, got %s", rr.Body.String())
+	}
+}
+
+func TestMarqueeSmoothModesAndLines(t *testing.T) {
+	oldWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd failed: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("chdir tmp failed: %v", err)
+	}
+	oldFrames, oldCustomMode, oldGifMode, oldSource := frames, isCustomMode, isGifMode, customSource
+	oldDevices := devices
+	defer func() {
+		_ = os.Chdir(oldWD)
+		frames, isCustomMode, isGifMode, customSource = oldFrames, oldCustomMode, oldGifMode, oldSource
+		devices = oldDevices
+	}()
+	devices = make(map[string]*DeviceState)
+
+	if got := measureText("héllo", 1); got != 30 {
+		t.Fatalf("expected rune-correct width 30, got %d", got)
+	}
+
+	post := func(body string, device string) map[string]interface{} {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/custom/marquee", strings.NewReader(body))
+		if device != "" {
+			req.Header.Set("X-Device-ID", device)
+		}
+		rr := httptest.NewRecorder()
+		handleMarquee(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", body, rr.Code, rr.Body.String())
+		}
+		var resp map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp
+	}
+	totalDuration := func(content []Frame) int {
+		total := 0
+		for _, frame := range content {
+			total += frame.Duration
+		}
+		return total
+	}
+
+	// "Hi" at size 1 travels 128+12 pixels at 1px per 50ms.
+	post(`{"text":"Hi","size":1,"speed":1,"maxFrames":60}`, "")
+	if len(frames) < 50 || len(frames) > 60 || totalDuration(frames) != 7000 {
+		t.Fatalf("expected about 60 frames over 7000ms, got %d over %dms", len(frames), totalDuration(frames))
+	}
+
+	// Without maxFrames a device gets the budget it reported.
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/gif/full", nil)
+	req.Header.Set("X-Device-ID", "desk-1")
+	req.Header.Set("X-ESP32-Max-Frames", "8")
+	handleGifFull(rr, req)
+	if resp := post(`{"text":"Hello"}`, "desk-1"); resp["frameBudget"] != float64(8) || len(devices["desk-1"].Frames) > 8 {
+		t.Fatalf("expected the device budget of 8 frames, got %v", resp)
+	}
+
+	// Pause mode holds at both ends, merged into single long frames.
+	post(`{"text":"Hi","size":1,"speed":2,"mode":"pause","pause":1500,"maxFrames":30}`, "")
+	if frames[0].Duration < 1500 || frames[len(frames)-1].Duration < 1000 || len(frames) > 30 {
+		t.Fatalf("expected pauses at both ends, got %d frames starting with %dms", len(frames), frames[0].Duration)
+	}
+
+	// The bottom line scrolls twice as fast, so halfway through the loop it
+	// is back where it started while the top line is not.
+	post(`{"lines":[{"text":"ABCD","size":1,"speed":2},{"text":"ABCD","size":1,"speed":4}],"maxFrames":20}`, "")
+	if len(frames) != 20 {
+		t.Fatalf("expected 20 frames, got %d", len(frames))
+	}
+	first, middle := frames[0].Elements[0].Bitmap, frames[10].Elements[0].Bitmap
+	if reflect.DeepEqual(first[:32*16], middle[:32*16]) || !reflect.DeepEqual(first[32*16:], middle[32*16:]) {
+		t.Fatal("expected the lines to scroll at independent speeds")
+	}
+
+	post(`{"text":"ONE\nTWO","direction":"up","mode":"pingpong","maxFrames":12}`, "")
+	lit := false
+	for _, b := range frames[0].Elements[0].Bitmap {
+		lit = lit || b != 0
+	}
+	if !lit || len(frames) > 12 {
+		t.Fatalf("expected vertical ping-pong frames, got %d", len(frames))
+	}
+
+	rr = httptest.NewRecorder()
+	handleMarquee(rr, httptest.NewRequest(http.MethodPost, "/api/custom/marquee", strings.NewReader(`{"lines":[{"text":"a","direction":"up"}]}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected vertical lines to be rejected, got %d", rr.Code)
+	}
+}
+
+const testBDF = `STARTFONT 2.1
+FONT -test-tiny
+FONTBOUNDINGBOX 3 4 0 -1
+STARTPROPERTIES 3
+FAMILY_NAME "Tiny"
+FONT_ASCENT 3
+FONT_DESCENT 1
+ENDPROPERTIES
+CHARS 3
+STARTCHAR I
+ENCODING 73
+DWIDTH 2 0
+BBX 1 3 0 0
+BITMAP
+80
+80
+80
+ENDCHAR
+STARTCHAR W
+ENCODING 87
+DWIDTH 4 0
+BBX 3 3 0 0
+BITMAP
+A0
+A0
+E0
+ENDCHAR
+STARTCHAR unmapped
+ENCODING -1
+DWIDTH 4 0
+BBX 1 1 0 0
+BITMAP
+80
+ENDCHAR
+ENDFONT
+`
+
+func TestBDFFontsRasterizeForDevice(t *testing.T) {
+	oldFonts, oldFrames, oldIndex, oldCustomMode := bitmapFonts, frames, index, isCustomMode
+	oldWD, _ := os.Getwd()
+	defer func() {
+		bitmapFonts, frames, index, isCustomMode = oldFonts, oldFrames, oldIndex, oldCustomMode
+		os.Chdir(oldWD)
+	}()
+	os.Chdir(t.TempDir())
+	os.Mkdir(fontsDir, 0755)
+	os.WriteFile(filepath.Join(fontsDir, "Tiny.bdf"), []byte(testBDF), 0644)
+	os.WriteFile(filepath.Join(fontsDir, "broken.bdf"), []byte("STARTFONT 2.1\nENDFONT\n"), 0644)
+	bitmapFonts = make(map[string]*BitmapFont)
+	loadFonts()
+
+	font := bitmapFonts["tiny"]
+	if len(bitmapFonts) != 1 || font == nil {
+		t.Fatalf("expected only the tiny font to load, got %v", bitmapFonts)
+	}
+	if font.Family != "Tiny" || font.LineHeight() != 4 || len(font.Glyphs) != 2 {
+		t.Fatalf("unexpected font metrics: %+v", font)
+	}
+	if got := font.Measure("IWI", 2); got != 16 {
+		t.Fatalf("expected proportional width 16, got %d", got)
+	}
+
+	rr := httptest.NewRecorder()
+	handleFonts(rr, httptest.NewRequest(http.MethodGet, "/api/fonts", nil))
+	var list struct {
+		Fonts []FontInfo `json:"fonts"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list.Fonts) != 2 || !list.Fonts[0].Builtin || list.Fonts[1].Name != "tiny" || list.Fonts[1].Height != 4 {
+		t.Fatalf("unexpected font list: %+v", list.Fonts)
+	}
+
+	// "IW" at 10,20: the I is a 1px column, the W starts two pixels later.
+	canvas := newCanvas(oledWidth, oledHeight)
+	canvas.DrawFontText(font, 10, 20, 1, "IW")
+	if !canvas.Pixel(10, 20) || canvas.Pixel(11, 20) || !canvas.Pixel(12, 20) || !canvas.Pixel(14, 22) || canvas.Pixel(13, 20) {
+		t.Fatal("expected glyphs drawn at their advances")
+	}
+
+	frames = []Frame{{Version: 1, Duration: 100, Clear: true, Elements: []Element{
+		{Type: "text", X: 10, Y: 20, Size: 1, Value: "IW", Font: "tiny"},
+		{Type: "text", X: 0, Y: 0, Size: 1, Value: "plain"},
+	}}}
+	index = 0
+	isCustomMode = true
+
+	fetch := func(supported string) []Element {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/frame/current", nil)
+		if supported != "" {
+			req.Header.Set("X-ESP32-Fonts", supported)
+		}
+		rr := httptest.NewRecorder()
+		currentFrame(rr, req)
+		var payload struct {
+			Elements []Element `json:"elements"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("invalid json: %v", err)
+		}
+		return payload.Elements
+	}
+
+	elements := fetch("")
+	if len(elements) != 2 || elements[0].Type != "bitmap" || elements[0].X != 10 || elements[0].Y != 20 || elements[0].Width != 6 || elements[0].Height != 4 {
+		t.Fatalf("expected the font text as a 6x4 bitmap at 10,20, got %+v", elements)
+	}
+	if !hasTextElement(elements, "plain") {
+		t.Fatal("expected built-in font text to stay text")
+	}
+	data, err := elementBitmapBytes(elements[0])
+	if err != nil || data[0] != 0xA8 {
+		t.Fatalf("expected the top row I.W.W, got %v %v", data, err)
+	}
+	if elements = fetch("tiny, other"); elements[0].Type != "text" || elements[0].Font != "tiny" {
+		t.Fatalf("expected a device with the font to get text, got %+v", elements[0])
+	}
+
+	// Time items pick up the font and centre with its widths.
+	frame := renderTimeFrame(WidgetContext{Now: time.Date(2024, 1, 1, 11, 11, 0, 0, time.UTC), Fonts: bitmapFonts}, CycleItem{Font: "tiny", Duration: 1000})
+	if el := frame.Elements[0]; el.Font != "tiny" || el.X != (oledWidth-font.Measure(el.Value, el.Size))/2 {
+		t.Fatalf("expected the clock in the tiny font, centred, got %+v", el)
+	}
+	if err := validateFontItem(CycleItem{Font: "../etc"}); err == nil {
+		t.Fatal("expected an invalid font name to be rejected")
+	}
+}
+
+func TestUploadSavesToLibraryOnlyOnRequest(t *testing.T) {
+	oldWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd failed: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("chdir tmp failed: %v", err)
+	}
+	oldAssets, oldCounter := mediaAssets, mediaCounter
+	oldFrames, oldCustom, oldGif, oldSource, oldDirty := frames, isCustomMode, isGifMode, customSource, customContentDirty
+	defer func() {
+		_ = os.Chdir(oldWD)
+		mediaAssets, mediaCounter = oldAssets, oldCounter
+		frames, isCustomMode, isGifMode, customSource, customContentDirty = oldFrames, oldCustom, oldGif, oldSource, oldDirty
+	}()
+	mediaAssets, mediaCounter = make(map[string]*MediaAsset), 0
+
+	upload := func(url string) map[string]interface{} {
+		t.Helper()
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", "dot.png")
+		png.Encode(part, image.NewGray(image.Rect(0, 0, 16, 16)))
+		form.Close()
+		req := httptest.NewRequest(http.MethodPost, url, &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rr := httptest.NewRecorder()
+		handleUpload(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("upload failed: %d %s", rr.Code, rr.Body.String())
+		}
+		var resp map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp
+	}
+
+	resp := upload("/api/upload")
+	if len(mediaAssets) != 0 || resp["assetId"] != nil {
+		t.Fatalf("expected a plain upload to stay out of the library, got %d assets", len(mediaAssets))
+	}
+	if resp["bitmap"] == nil || resp["width"] != float64(128) || resp["height"] != float64(64) {
+		t.Fatalf("expected the bitmap fields in the upload response, got %v", resp)
+	}
+
+	if resp := upload("/api/upload?save=true"); len(mediaAssets) != 1 || resp["assetId"] != "asset-1" {
+		t.Fatalf("expected save=true to add the upload to the library, got %v", resp["assetId"])
+	}
+}
+
+func TestMediaAssetKeepsPlayback(t *testing.T) {
+	oldWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd failed: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("chdir tmp failed: %v", err)
+	}
+	oldAssets, oldCounter := mediaAssets, mediaCounter
+	oldFrames, oldCustom, oldGif, oldSource, oldDirty := frames, isCustomMode, isGifMode, customSource, customContentDirty
+	defer func() {
+		_ = os.Chdir(oldWD)
+		mediaAssets, mediaCounter = oldAssets, oldCounter
+		frames, isCustomMode, isGifMode, customSource, customContentDirty = oldFrames, oldCustom, oldGif, oldSource, oldDirty
+	}()
+	mediaAssets, mediaCounter = make(map[string]*MediaAsset), 0
+
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{}
+	for i := 0; i < 3; i++ {
+		img := image.NewPaletted(image.Rect(0, 0, 8, 8), palette)
+		img.SetColorIndex(i, 0, 1)
+		anim.Image = append(anim.Image, img)
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "spin.gif")
+	gif.EncodeAll(part, anim)
+	form.WriteField("speed", "2")
+	form.WriteField("loopCount", "3")
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/media", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rr := httptest.NewRecorder()
+	handleMedia(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("storing the asset failed: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// The options survive a restart with the asset file.
+	loadMediaLibrary()
+	if p := mediaAssets["asset-1"].Playback; p == nil || p.Speed != 2 || p.LoopCount != 3 {
+		t.Fatalf("expected the playback options stored with the asset, got %+v", p)
+	}
+
+	rr = httptest.NewRecorder()
+	handleMediaShow(rr, httptest.NewRequest(http.MethodPost, "/api/media/show", strings.NewReader(`{"id":"asset-1"}`)))
+	if rr.Code != http.StatusOK || customSource == nil || customSource.Playback == nil || customSource.Playback.Speed != 2 || customSource.Playback.LoopCount != 3 {
+		t.Fatalf("expected showing the asset to keep its playback options, got %d %+v", rr.Code, customSource)
+	}
+}
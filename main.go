@@ -49,6 +49,10 @@ func main() {
 	loadEnvFile()
 
 	loadConfig()
+	loadConfigHistory()
+	seedConfigHistory()
+	loadMediaLibrary()
+	loadFonts()
 	startConfigSaver()
 
 	dashboardPassword = os.Getenv("DASHBOARD_PASSWORD")
@@ -69,7 +73,10 @@ func main() {
 	initMoonPhase()
 	startMoonPhaseFetcher()
 
+	startProfileScheduler()
+
 	frames = []Frame{{Duration: 1000, Clear: true, Elements: []Element{{Type: "text", X: 20, Y: 25, Size: 2, Value: "BOOTING..."}}}}
+	loadCustomContent()
 
 	go updateLoop()
 
@@ -91,6 +98,12 @@ func main() {
 	http.HandleFunc("/api/custom/text", loggingMiddleware(authMiddleware(handleCustomText)))
 	http.HandleFunc("/api/custom/marquee", loggingMiddleware(authMiddleware(handleMarquee)))
 	http.HandleFunc("/api/upload", loggingMiddleware(authMiddleware(handleUpload)))
+	http.HandleFunc("/api/gif/playback", loggingMiddleware(authMiddleware(handleGifPlayback)))
+	http.HandleFunc("/api/media", loggingMiddleware(authMiddleware(handleMedia)))
+	http.HandleFunc("/api/fonts", loggingMiddleware(authMiddleware(handleFonts)))
+	http.HandleFunc("/api/media/rename", loggingMiddleware(authMiddleware(handleMediaRename)))
+	http.HandleFunc("/api/media/thumbnail", loggingMiddleware(authMiddleware(handleMediaThumbnail)))
+	http.HandleFunc("/api/media/show", loggingMiddleware(authMiddleware(handleMediaShow)))
 	http.HandleFunc("/api/reset", loggingMiddleware(authMiddleware(handleReset)))
 	http.HandleFunc("/api/settings/toggle-headers", loggingMiddleware(authMiddleware(handleToggleHeaders)))
 	http.HandleFunc("/api/settings/headers-state", loggingMiddleware(authMiddleware(handleGetHeadersState)))
@@ -101,10 +114,23 @@ func main() {
 	http.HandleFunc("/api/settings/bcd", loggingMiddleware(authMiddleware(handleBCDSettings)))
 	http.HandleFunc("/api/settings/time", loggingMiddleware(authMiddleware(handleTimeSettings)))
 	http.HandleFunc("/api/settings/analog", loggingMiddleware(authMiddleware(handleAnalogSettings)))
+	http.HandleFunc("/api/settings/night", loggingMiddleware(authMiddleware(handleNightMode)))
 	http.HandleFunc("/api/settings/spotify", loggingMiddleware(authMiddleware(handleSpotifySettings)))
 	http.HandleFunc("/api/spotify/auth", loggingMiddleware(authMiddleware(handleSpotifyAuth)))
 	http.HandleFunc("/api/spotify/callback", loggingMiddleware(handleSpotifyCallback))
 	http.HandleFunc("/api/moonphase/refresh", loggingMiddleware(authMiddleware(handleMoonPhaseRefresh)))
+	http.HandleFunc("/api/devices", loggingMiddleware(authMiddleware(handleDevices)))
+	http.HandleFunc("/api/events", loggingMiddleware(authMiddleware(handleEvents)))
+	http.HandleFunc("/api/widgets", loggingMiddleware(authMiddleware(handleWidgets)))
+	http.HandleFunc("/api/preview.png", loggingMiddleware(authMiddleware(handlePreview)))
+	http.HandleFunc("/api/notify", loggingMiddleware(authMiddleware(handleNotify)))
+	http.HandleFunc("/api/profiles", loggingMiddleware(authMiddleware(handleProfiles)))
+	http.HandleFunc("/api/profiles/activate", loggingMiddleware(authMiddleware(handleProfileActivate)))
+	http.HandleFunc("/api/config/export", loggingMiddleware(authMiddleware(handleConfigExport)))
+	http.HandleFunc("/api/config/import", loggingMiddleware(authMiddleware(handleConfigImport)))
+	http.HandleFunc("/api/config/history", loggingMiddleware(authMiddleware(handleConfigHistory)))
+	http.HandleFunc("/api/config/history/diff", loggingMiddleware(authMiddleware(handleConfigHistoryDiff)))
+	http.HandleFunc("/api/config/history/restore", loggingMiddleware(authMiddleware(handleConfigHistoryRestore)))
 
 	port := os.Getenv("PORT")
 	if port == "" {
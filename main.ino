@@ -5,6 +5,7 @@
 #include <ArduinoJson.h>
 #include <Adafruit_GFX.h>
 #include <Adafruit_SSD1306.h>
+#include <mbedtls/base64.h>
 
 // ===== NETWORK ERROR HANDLING =====
 static int networkRetryCount = 0;
@@ -33,11 +34,22 @@ const char* FRAME_CURRENT_URL = "https://vqxh0hd3-3000.inc1.devtunnels.ms/frame/
 const char* FRAME_NEXT_URL    = "https://vqxh0hd3-3000.inc1.devtunnels.ms/frame/next";
 const char* GIF_FULL_URL      = "https://vqxh0hd3-3000.inc1.devtunnels.ms/api/gif/full";
 
+// ===== DEVICE IDENTITY =====
+// Sent as X-Device-ID so several desks can share one backend with their own
+// frame cursor and settings. Leave empty to derive it from the WiFi MAC address.
+String deviceId = "";
+
+// ===== CONDITIONAL POLLING =====
+// ETag of the frame on screen; the server answers 304 when it is unchanged
+String lastFrameETag = "";
+int lastFrameDuration = 3000;
+
 // ===== OLED =====
 #define SCREEN_WIDTH 128
 #define SCREEN_HEIGHT 64
 #define OLED_RESET    -1
 #define OLED_ADDRESS  0x3C
+#define MAX_POLYGON_POINTS 16  // Keep in sync with maxPolygonPoints in raster.go
 
 // ===== STATUS LED =====
 #define LED_PIN 2  // Built-in LED on most ESP32 boards (GPIO 2)
@@ -58,6 +70,7 @@ bool rgbPwmInitialized = false;
 
 // RGB Beacon state
 uint8_t ledBrightness = 128;        // 0-255, controlled from web UI
+int displayContrast = 0xCF;         // SSD1306 default after begin(); lowered by night mode
 bool ledBeaconEnabled = true;       // Can be toggled from web UI
 unsigned long lastBeaconTime = 0;
 const unsigned long BEACON_INTERVAL = 2500;  // Flash every 2.5 seconds
@@ -84,12 +97,18 @@ Adafruit_SSD1306 display(SCREEN_WIDTH, SCREEN_HEIGHT, &Wire, OLED_RESET);
 // memory when not in GIF mode, but risks heap fragmentation on ESP32.
 #define MAX_GIF_FRAMES 10       // Limit to ~10KB of RAM for bitmaps (reduced for memory safety)
 #define BYTES_PER_FRAME 1024    // 128x64 / 8 = 1024 bytes per frame
+#define MAX_GIF_PAYLOAD 32768   // Frame JSON per window, keeps the JSON buffer well under 98KB
 
 uint8_t gifFrames[MAX_GIF_FRAMES][BYTES_PER_FRAME];
 int gifDurations[MAX_GIF_FRAMES];
 bool gifClearFlags[MAX_GIF_FRAMES];  // Per-frame clear flag
 int gifFrameCount = 0;
 bool isGifMode = false;
+bool gifPaged = false;    // Animation is longer than one window of frames
+int gifNextOffset = 0;    // Where the next window starts (server's nextOffset)
+int gifLoopCount = 0;     // Loops to play before the cycle resumes (0 = forever)
+int gifLoopsPlayed = 0;
+bool gifLoopsDone = false;  // Tell the server on the next fetch so the cycle resumes
 int displayRotation = 0;  // 0 = normal, 2 = 180 degrees (for upside-down mounting)
 unsigned long lastGifCheck = 0;
 
@@ -253,6 +272,18 @@ void parseLedSettings(JsonDocument& doc) {
   }
 }
 
+// ===== PARSE DISPLAY CONTRAST FROM JSON =====
+// The server lowers contrast during night mode and restores it afterwards.
+void parseDisplayContrast(JsonDocument& doc) {
+  int serverContrast = doc["displayContrast"] | -1;
+  if (serverContrast >= 0 && serverContrast <= 255 && serverContrast != displayContrast) {
+    displayContrast = serverContrast;
+    display.ssd1306_command(SSD1306_SETCONTRAST);
+    display.ssd1306_command((uint8_t)displayContrast);
+    Serial.printf("Display contrast changed to: %d\n", displayContrast);
+  }
+}
+
 // ===== LED EFFECT STATE MACHINE =====
 // Handles configurable LED effects from web dashboard
 void updateLedEffect() {
@@ -337,6 +368,121 @@ void drawBitmapFromBuffer(const uint8_t* bitmap) {
   display.display();
 }
 
+// ===== FUNCTION: DECODE BITMAP ELEMENT =====
+// Bitmaps arrive either as a JSON int array ("bitmap") or, because we request
+// X-Bitmap-Encoding: base64, packed into a string ("data" + "encoding").
+// Returns the number of bytes written to out, or 0 on error/overflow.
+int decodeBitmap(JsonObject el, uint8_t* out, int maxLen) {
+  const char* data = el["data"] | "";
+  if (strlen(data) > 0) {
+    const char* encoding = el["encoding"] | "base64";
+    if (strcmp(encoding, "hex") == 0) {
+      int len = strlen(data) / 2;
+      if (len > maxLen) return 0;
+      for (int i = 0; i < len; i++) {
+        char byteStr[3] = {data[i * 2], data[i * 2 + 1], 0};
+        out[i] = (uint8_t)strtol(byteStr, nullptr, 16);
+      }
+      return len;
+    }
+    size_t written = 0;
+    int rc = mbedtls_base64_decode(out, maxLen, &written, (const unsigned char*)data, strlen(data));
+    return rc == 0 ? (int)written : 0;
+  }
+
+  JsonArray arr = el["bitmap"];
+  int len = arr.size();
+  if (len <= 0 || len > maxLen) return 0;
+  for (int i = 0; i < len; i++) {
+    out[i] = (uint8_t)arr[i].as<int>();
+  }
+  return len;
+}
+
+// ===== FUNCTION: DRAW ARC =====
+// Plots the drawCircle pixels whose angle (degrees clockwise from 12 o'clock)
+// lies on the clockwise sweep from start to end. Mirrors DrawArc in raster.go.
+void plotArcPoint(int cx, int cy, int x, int y, int start, int sweep) {
+  float angle = atan2f((float)(x - cx), (float)(cy - y)) * 180.0f / PI;
+  if (angle < 0) angle += 360.0f;
+  float rel = angle - start;
+  if (rel < 0) rel += 360.0f;
+  if (rel <= sweep) display.drawPixel(x, y, SSD1306_WHITE);
+}
+
+void drawArc(int cx, int cy, int r, int start, int end) {
+  int sweep = ((end - start) % 360 + 360) % 360;
+  if (sweep == 0 && end != start) sweep = 360;
+  start = (start % 360 + 360) % 360;
+
+  int f = 1 - r;
+  int ddF_x = 1;
+  int ddF_y = -2 * r;
+  int x = 0;
+  int y = r;
+  plotArcPoint(cx, cy, cx, cy + r, start, sweep);
+  plotArcPoint(cx, cy, cx, cy - r, start, sweep);
+  plotArcPoint(cx, cy, cx + r, cy, start, sweep);
+  plotArcPoint(cx, cy, cx - r, cy, start, sweep);
+  while (x < y) {
+    if (f >= 0) {
+      y--;
+      ddF_y += 2;
+      f += ddF_y;
+    }
+    x++;
+    ddF_x += 2;
+    f += ddF_x;
+    plotArcPoint(cx, cy, cx + x, cy + y, start, sweep);
+    plotArcPoint(cx, cy, cx - x, cy + y, start, sweep);
+    plotArcPoint(cx, cy, cx + x, cy - y, start, sweep);
+    plotArcPoint(cx, cy, cx - x, cy - y, start, sweep);
+    plotArcPoint(cx, cy, cx + y, cy + x, start, sweep);
+    plotArcPoint(cx, cy, cx - y, cy + x, start, sweep);
+    plotArcPoint(cx, cy, cx + y, cy - x, start, sweep);
+    plotArcPoint(cx, cy, cx - y, cy - x, start, sweep);
+  }
+}
+
+// ===== FUNCTION: DRAW POLYGON =====
+// Closed outline through n points, optionally filled with even-odd
+// scanlines. Mirrors DrawPolygon in raster.go.
+void drawPolygon(const int* px, const int* py, int n, bool filled) {
+  if (filled) {
+    int minY = py[0], maxY = py[0];
+    for (int i = 1; i < n; i++) {
+      if (py[i] < minY) minY = py[i];
+      if (py[i] > maxY) maxY = py[i];
+    }
+    int nodes[MAX_POLYGON_POINTS];
+    for (int y = minY; y <= maxY; y++) {
+      int count = 0;
+      for (int i = 0, j = n - 1; i < n; j = i++) {
+        if ((py[i] < y && py[j] >= y) || (py[j] < y && py[i] >= y)) {
+          nodes[count++] = px[i] + (y - py[i]) * (px[j] - px[i]) / (py[j] - py[i]);
+        }
+      }
+      // Insertion sort: at most MAX_POLYGON_POINTS crossings
+      for (int i = 1; i < count; i++) {
+        int v = nodes[i];
+        int k = i - 1;
+        while (k >= 0 && nodes[k] > v) {
+          nodes[k + 1] = nodes[k];
+          k--;
+        }
+        nodes[k + 1] = v;
+      }
+      for (int k = 0; k + 1 < count; k += 2) {
+        display.drawFastHLine(nodes[k], y, nodes[k + 1] - nodes[k] + 1, SSD1306_WHITE);
+      }
+    }
+  }
+  for (int i = 0; i < n; i++) {
+    int j = (i + 1) % n;
+    display.drawLine(px[i], py[i], px[j], py[j], SSD1306_WHITE);
+  }
+}
+
 // ===== FUNCTION: DRAW FRAME FROM JSON =====
 void drawFrame(JsonDocument& doc) {
   if (doc["clear"] == true) {
@@ -372,24 +518,16 @@ void drawFrame(JsonDocument& doc) {
       int w = el["width"] | 0;
       int h = el["height"] | 0;
       
-      // Screen boundary check (Rule #8)
-      if (x < 0) x = 0;
-      if (y < 0) y = 0;
-      // Clamp dimensions to screen bounds
-      if (x + w > 128) w = 128 - x;
-      if (y + h > 64) h = 64 - y;
+      // Screen boundary check (Rule #8): skip bitmaps that are entirely
+      // off-screen. Partly visible ones keep their real width so the row
+      // stride stays (w + 7) / 8; drawBitmap clips them per pixel.
       if (w <= 0 || h <= 0) continue;
+      if (x >= 128 || y >= 64 || x + w <= 0 || y + h <= 0) continue;
       
-      // Copy data from JSON array to byte buffer
-      JsonArray data = el["bitmap"];
-      int len = data.size();
-      
-      // Safety check: max 1KB buffer for bitmaps
-      if (len > 0 && len <= 1024) {
-        uint8_t bmp[1024]; 
-        for(int i=0; i<len; i++) {
-          bmp[i] = (uint8_t)data[i].as<int>();
-        }
+      // Decode packed or array bitmap into byte buffer (max 1KB)
+      uint8_t bmp[1024];
+      int len = decodeBitmap(el, bmp, sizeof(bmp));
+      if (len > 0 && len >= ((w + 7) / 8) * h) {
         display.drawBitmap(x, y, bmp, w, h, SSD1306_WHITE);
       }
     }
@@ -409,15 +547,58 @@ void drawFrame(JsonDocument& doc) {
       // Draw filled rectangle for line
       display.fillRect(x, y, w, h, SSD1306_WHITE);
     }
+    // Vector primitives. Adafruit GFX clips these per pixel, so no
+    // boundary clamping is needed (or wanted: it would distort the shape).
+    else if (strcmp(type, "segment") == 0) {
+      display.drawLine(el["x1"] | 0, el["y1"] | 0, el["x2"] | 0, el["y2"] | 0, SSD1306_WHITE);
+    }
+    else if (strcmp(type, "rect") == 0) {
+      int x = el["x"] | 0;
+      int y = el["y"] | 0;
+      int w = el["width"] | 0;
+      int h = el["height"] | 0;
+      int r = el["radius"] | 0;
+      bool filled = el["filled"] | false;
+      if (w <= 0 || h <= 0) continue;
+
+      if (filled && r > 0) display.fillRoundRect(x, y, w, h, r, SSD1306_WHITE);
+      else if (filled) display.fillRect(x, y, w, h, SSD1306_WHITE);
+      else if (r > 0) display.drawRoundRect(x, y, w, h, r, SSD1306_WHITE);
+      else display.drawRect(x, y, w, h, SSD1306_WHITE);
+    }
+    else if (strcmp(type, "circle") == 0) {
+      int r = el["radius"] | 0;
+      if (r < 0) continue;
+      if (el["filled"] | false) display.fillCircle(el["x"] | 0, el["y"] | 0, r, SSD1306_WHITE);
+      else display.drawCircle(el["x"] | 0, el["y"] | 0, r, SSD1306_WHITE);
+    }
+    else if (strcmp(type, "arc") == 0) {
+      int r = el["radius"] | 0;
+      if (r < 0) continue;
+      drawArc(el["x"] | 0, el["y"] | 0, r, el["startAngle"] | 0, el["endAngle"] | 360);
+    }
+    else if (strcmp(type, "polygon") == 0) {
+      JsonArray pts = el["points"];
+      int n = pts.size() / 2;
+      if (n < 2 || n > MAX_POLYGON_POINTS || pts.size() % 2 != 0) continue;
+      int px[MAX_POLYGON_POINTS];
+      int py[MAX_POLYGON_POINTS];
+      for (int i = 0; i < n; i++) {
+        px[i] = pts[i * 2].as<int>();
+        py[i] = pts[i * 2 + 1].as<int>();
+      }
+      drawPolygon(px, py, n, el["filled"] | false);
+    }
   }
 
   display.display();
 }
 
 // ===== FUNCTION: FETCH FULL GIF =====
-// Downloads all GIF frames at once and stores them in RAM for local playback
+// Downloads one window of GIF frames starting at offset and stores them in RAM
+// for local playback. Animations longer than MAX_GIF_FRAMES arrive in windows.
 // Returns: 1 = GIF loaded successfully, 0 = no GIF available (server says isGifMode=false), -1 = network/parse error
-int fetchFullGifWithStatus() {
+int fetchGifWindow(int offset) {
   digitalWrite(LED_PIN, HIGH);
   
   // Log available heap before allocation
@@ -432,9 +613,13 @@ int fetchFullGifWithStatus() {
   http.setFollowRedirects(HTTPC_STRICT_FOLLOW_REDIRECTS);  // Follow redirects
   http.setReuse(false);  // Don't reuse connection
   
-  Serial.printf("Connecting to: %s\n", GIF_FULL_URL);
+  String url = String(GIF_FULL_URL);
+  if (offset > 0) {
+    url += "?offset=" + String(offset);
+  }
+  Serial.printf("Connecting to: %s\n", url.c_str());
   
-  if (!http.begin(client, GIF_FULL_URL)) {
+  if (!http.begin(client, url)) {
     Serial.println("ERROR: http.begin() failed");
     digitalWrite(LED_PIN, LOW);
     return -1;
@@ -444,6 +629,12 @@ int fetchFullGifWithStatus() {
   
   // Add header to request limited frames for ESP32 memory constraints
   http.addHeader("X-ESP32-Max-Frames", String(MAX_GIF_FRAMES));
+  http.addHeader("X-ESP32-Max-Payload", String(MAX_GIF_PAYLOAD));
+  http.addHeader("X-Device-ID", deviceId);
+  http.addHeader("X-Bitmap-Encoding", "base64");  // ~3x smaller than int arrays
+  if (gifLoopsDone) {
+    http.addHeader("X-ESP32-Loops-Done", "1");
+  }
   
   Serial.println("Sending HTTP GET request...");
   int code = http.GET();
@@ -456,6 +647,7 @@ int fetchFullGifWithStatus() {
     digitalWrite(LED_PIN, LOW);
     return -1;  // Network error - don't change GIF mode state
   }
+  gifLoopsDone = false;  // Server has the report
 
   // Get response size
   int contentLength = http.getSize();
@@ -519,6 +711,7 @@ int fetchFullGifWithStatus() {
   // ===== PARSE LED SETTINGS FROM GIF RESPONSE =====
   // Always parse LED settings even if not in GIF mode - this keeps beacon in sync
   parseLedSettings(*doc);
+  parseDisplayContrast(*doc);
 
   if (!gifMode || frameCount == 0) {
     Serial.println("Server says: Not in GIF mode or no frames");
@@ -526,10 +719,20 @@ int fetchFullGifWithStatus() {
     digitalWrite(LED_PIN, LOW);
     isGifMode = false;
     gifFrameCount = 0;
+    gifPaged = false;
+    gifNextOffset = 0;
     return 0;  // Server explicitly says no GIF mode
   }
 
-  Serial.printf("Server sent %d frames, processing...\n", frameCount);
+  int totalFrames = (*doc)["totalFrames"] | frameCount;
+  gifPaged = totalFrames > frameCount;
+  gifNextOffset = (*doc)["nextOffset"] | 0;
+  gifLoopCount = (*doc)["loopCount"] | 0;
+  if (offset == 0 && !isGifMode) {
+    gifLoopsPlayed = 0;
+  }
+  Serial.printf("Server sent %d of %d frames (offset %d), processing...\n",
+                frameCount, totalFrames, (int)((*doc)["offset"] | 0));
 
   // Limit frames to our buffer size
   if (frameCount > MAX_GIF_FRAMES) {
@@ -557,12 +760,8 @@ int fetchFullGifWithStatus() {
       JsonObject el = elements[0];
       const char* elType = el["type"] | "";
       if (strcmp(elType, "bitmap") == 0) {
-        JsonArray bitmap = el["bitmap"].as<JsonArray>();
-        int len = bitmap.size();
-        if (len > 0 && len <= BYTES_PER_FRAME) {
-          for (int i = 0; i < len; i++) {
-            gifFrames[gifFrameCount][i] = (uint8_t)bitmap[i].as<int>();
-          }
+        int len = decodeBitmap(el, gifFrames[gifFrameCount], BYTES_PER_FRAME);
+        if (len > 0) {
           // Zero out remaining bytes if bitmap is smaller
           for (int i = len; i < BYTES_PER_FRAME; i++) {
             gifFrames[gifFrameCount][i] = 0;
@@ -584,6 +783,11 @@ int fetchFullGifWithStatus() {
   return isGifMode ? 1 : 0;
 }
 
+// Fetches the start of the animation
+int fetchFullGifWithStatus() {
+  return fetchGifWindow(0);
+}
+
 // Wrapper for backward compatibility
 bool fetchFullGif() {
   return fetchFullGifWithStatus() == 1;
@@ -641,8 +845,24 @@ int fetchFrame(const char* url) {
   }
   
   http.setTimeout(10000);  // 10 second timeout for single frames
+  http.addHeader("X-Device-ID", deviceId);
+  http.addHeader("X-Bitmap-Encoding", "base64");
+  if (lastFrameETag.length() > 0) {
+    http.addHeader("If-None-Match", lastFrameETag);
+  }
+  const char* etagHeaders[] = {"ETag"};
+  http.collectHeaders(etagHeaders, 1);
   int code = http.GET();
 
+  // ===== NOT MODIFIED =====
+  // Frame on screen is still current - skip the download and the redraw
+  if (code == 304) {
+    http.end();
+    digitalWrite(LED_PIN, LOW);
+    networkRetryCount = 0;
+    return lastFrameDuration;
+  }
+
   if (code != 200) {
     String errorMsg = http.errorToString(code);
     Serial.printf("fetchFrame failed with HTTP code: %d (%s)\n", code, errorMsg.c_str());
@@ -664,6 +884,7 @@ int fetchFrame(const char* url) {
     payload.reserve(contentLen + 32);
   }
   payload = http.getString();
+  String frameETag = http.header("ETag");
   http.end();
   
   DeserializationError error = deserializeJson(doc, payload);
@@ -689,6 +910,7 @@ int fetchFrame(const char* url) {
   // ===== CHECK FOR LED SETTINGS =====
   // Parse LED brightness, effect mode, custom color, and timing settings
   parseLedSettings(doc);
+  parseDisplayContrast(doc);
 
   // ===== CHECK FOR GIF MODE HINT =====
   // Server indicates if GIF/Marquee mode is active via isGifMode field
@@ -723,6 +945,7 @@ int fetchFrame(const char* url) {
 
   // Draw the frame normally (polling mode)
   drawFrame(doc);
+  lastFrameETag = frameETag;
   
   digitalWrite(LED_PIN, LOW);
   
@@ -731,7 +954,8 @@ int fetchFrame(const char* url) {
 
   // Clamp duration to safe range (100ms - 60s)
   int duration = doc["duration"] | 3000;
-  return constrain(duration, 100, 60000);
+  lastFrameDuration = constrain(duration, 100, 60000);
+  return lastFrameDuration;
 }
 
 // ===== FUNCTION: CHECK GIF MODE =====
@@ -757,6 +981,7 @@ void checkForGifUpdate() {
     // Server explicitly says no GIF mode
     if (wasGifMode) {
       Serial.println("Exited GIF/Marquee mode, switching to polling");
+      lastFrameETag = "";  // Screen shows the animation, force a full redraw
       
       // ===== BUFFER CLEANUP =====
       // Zero out frame buffers - note: memory is statically allocated,
@@ -901,6 +1126,12 @@ void setup() {
   Serial.print("IP: ");
   Serial.println(WiFi.localIP());
 
+  if (deviceId.length() == 0) {
+    deviceId = "esp32-" + WiFi.macAddress();
+    deviceId.replace(":", "");
+  }
+  Serial.printf("Device ID: %s\n", deviceId.c_str());
+
   // Try to fetch full GIF/Marquee first
   if (fetchFullGif()) {
     Serial.println("Animation mode active - local playback enabled");
@@ -961,6 +1192,7 @@ void loop() {
     }
     
     // Re-fetch content after reconnection
+    lastFrameETag = "";  // Reconnection screen replaced the frame
     if (fetchFullGif()) {
       Serial.println("GIF mode restored after reconnection");
     } else {
@@ -978,7 +1210,29 @@ void loop() {
     
     // Only check for updates AFTER a complete playback cycle
     // This prevents blocking HTTP calls from interrupting smooth animation
-    checkForGifUpdate();
+    if (!gifPaged || gifNextOffset == 0) {
+      gifLoopsPlayed++;
+    }
+    if (gifLoopCount > 0 && gifLoopsPlayed >= gifLoopCount) {
+      // Loops done: report it now instead of waiting for the next
+      // interval, and the server hands the display back to the cycle
+      gifLoopsPlayed = 0;
+      gifLoopsDone = true;
+      lastGifCheck = millis() - getGifCheckInterval();
+      checkForGifUpdate();
+    } else if (gifPaged) {
+      // Long animation: stream the next window. Each fetch also picks up
+      // a replaced animation or the end of GIF mode.
+      int result = fetchGifWindow(gifNextOffset);
+      if (result == 0) {
+        Serial.println("Exited GIF/Marquee mode, switching to polling");
+        lastFrameETag = "";  // Screen shows the animation, force a full redraw
+      }
+      // result == -1: replay the current window and retry after it
+      lastGifCheck = millis();
+    } else {
+      checkForGifUpdate();
+    }
   } else {
     // ===== LEGACY POLLING MODE =====
     currentBeaconColor = COLOR_IDLE;  // Blue in normal mode
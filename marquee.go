@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	marqueeLoop     = "loop"
+	marqueePingPong = "pingpong"
+	marqueePause    = "pause"
+
+	maxMarqueeLines       = 2
+	maxMarqueeRunes       = 500
+	minMarqueeFrameMs     = 30
+	defaultMarqueePauseMs = 1000
+)
+
+// MarqueeLine is one independently scrolling line of a two-line marquee.
+type MarqueeLine struct {
+	Text      string `json:"text"`
+	Y         int    `json:"y"`
+	Size      int    `json:"size"`
+	Speed     int    `json:"speed"`
+	Direction string `json:"direction"`
+}
+
+// marqueeTrack is one block of text moving on its own. A horizontal track
+// moves a single line along x at height Fixed; a vertical track moves its
+// lines, each centred, along y. From and To are the ends of the movement.
+type marqueeTrack struct {
+	Lines    []string
+	Size     int
+	Fixed    int
+	Vertical bool
+	From, To int
+	Speed    float64 // pixels per ms
+	Mode     string
+	PauseMs  float64
+}
+
+// wrapMarqueeText splits text into lines that fit the screen width at size,
+// breaking on '\n' and counting runes so every character takes one cell.
+func wrapMarqueeText(text string, size int) []string {
+	perLine := oledWidth / (6 * size)
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		runes := []rune(strings.TrimRight(paragraph, "\r"))
+		if len(runes) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		for len(runes) > perLine {
+			lines = append(lines, string(runes[:perLine]))
+			runes = runes[perLine:]
+		}
+		lines = append(lines, string(runes))
+	}
+	return lines
+}
+
+// newMarqueeTrack lays out text moving in direction. speed is in pixels per
+// 50ms tick, the unit the dashboard has always used.
+func newMarqueeTrack(text string, y, size, speed int, direction, mode string, pauseMs int) marqueeTrack {
+	t := marqueeTrack{Size: size, Fixed: y, Speed: float64(speed) / 50, Mode: mode, PauseMs: float64(pauseMs)}
+
+	screen, length := oledWidth, 0
+	forward := direction == "right" || direction == "down"
+	if direction == "up" || direction == "down" {
+		t.Vertical = true
+		t.Lines = wrapMarqueeText(text, size)
+		screen, length = oledHeight, len(t.Lines)*8*size
+	} else {
+		t.Lines = []string{text}
+		length = measureText(text, size)
+	}
+
+	// Looping text enters at one edge and leaves at the other; the other
+	// modes stop where the first or last character meets the edge.
+	lo, hi := -length, screen
+	if mode != marqueeLoop {
+		lo, hi = min(0, screen-length), max(0, screen-length)
+	}
+	t.From, t.To = hi, lo
+	if forward {
+		t.From, t.To = lo, hi
+	}
+	return t
+}
+
+// travelMs is how long one pass from From to To takes.
+func (t marqueeTrack) travelMs() float64 {
+	return math.Abs(float64(t.To-t.From)) / t.Speed
+}
+
+// cycleMs is the length of one full cycle of the track, pauses included.
+func (t marqueeTrack) cycleMs() float64 {
+	switch t.Mode {
+	case marqueePingPong:
+		return 2*t.travelMs() + 2*t.PauseMs
+	case marqueePause:
+		return t.travelMs() + 2*t.PauseMs
+	}
+	return t.travelMs()
+}
+
+// pathPixels is how far the text moves in one cycle.
+func (t marqueeTrack) pathPixels() float64 {
+	distance := math.Abs(float64(t.To - t.From))
+	if t.Mode == marqueePingPong {
+		return 2 * distance
+	}
+	return distance
+}
+
+// position is the moving coordinate ms into a cycle. Ping-pong holds at
+// From, travels, holds at To and travels back; pause mode holds at both ends
+// and then starts over from From.
+func (t marqueeTrack) position(ms float64) int {
+	travel := t.travelMs()
+	along := func(elapsed float64, from, to int) int {
+		if travel == 0 {
+			return from
+		}
+		p := math.Min(1, math.Max(0, elapsed/travel))
+		return from + int(math.Round(p*float64(to-from)))
+	}
+
+	switch t.Mode {
+	case marqueePingPong, marqueePause:
+		switch {
+		case ms < t.PauseMs:
+			return t.From
+		case ms < t.PauseMs+travel:
+			return along(ms-t.PauseMs, t.From, t.To)
+		case ms < 2*t.PauseMs+travel || t.Mode == marqueePause:
+			return t.To
+		}
+		return along(ms-2*t.PauseMs-travel, t.To, t.From)
+	}
+	return along(ms, t.From, t.To)
+}
+
+// elements draws the track at a position.
+func (t marqueeTrack) elements(pos int) []Element {
+	if !t.Vertical {
+		return []Element{{Type: "text", X: pos, Y: t.Fixed, Size: t.Size, Value: t.Lines[0]}}
+	}
+	var elements []Element
+	for i, line := range t.Lines {
+		y := pos + i*8*t.Size
+		if line == "" || y <= -8*t.Size || y >= oledHeight {
+			continue
+		}
+		x := (oledWidth - measureText(line, t.Size)) / 2
+		elements = append(elements, Element{Type: "text", X: x, Y: y, Size: t.Size, Value: line})
+	}
+	return elements
+}
+
+// buildMarqueeFrames renders the tracks as the smoothest loop that fits in
+// budget frames. The animation lasts as long as the slowest track's cycle;
+// faster tracks fit in a whole number of their own cycles, so the loop
+// joins up seamlessly while each keeps close to its own speed. Ideally
+// every frame moves the fastest track by one pixel; with a smaller budget
+// frames are spread evenly over the loop, and runs of identical frames,
+// such as pauses, are merged into one longer frame to save budget.
+func buildMarqueeFrames(tracks []marqueeTrack, framed bool, budget int) []Frame {
+	total := 0.0
+	for _, t := range tracks {
+		total = math.Max(total, t.cycleMs())
+	}
+	if total == 0 {
+		return []Frame{renderMarqueeFrame(tracks, framed, 1000, func(i int, t marqueeTrack) int { return t.From })}
+	}
+
+	cycles := make([]float64, len(tracks))
+	ideal := 0.0
+	for i, t := range tracks {
+		cycles[i] = 1
+		if c := t.cycleMs(); c > 0 {
+			cycles[i] = math.Max(1, math.Round(total/c))
+		}
+		ideal = math.Max(ideal, cycles[i]*t.pathPixels())
+	}
+	limit := int(math.Min(math.Ceil(ideal), total/minMarqueeFrameMs))
+	limit = max(limit, 2)
+
+	render := func(n int) []Frame {
+		var result []Frame
+		for f := 0; f < n; f++ {
+			start := math.Round(float64(f) * total / float64(n))
+			end := math.Round(float64(f+1) * total / float64(n))
+			frame := renderMarqueeFrame(tracks, framed, int(end-start), func(i int, t marqueeTrack) int {
+				c := t.cycleMs()
+				if c == 0 {
+					return t.From
+				}
+				period := total / cycles[i]
+				return t.position(math.Mod(start, period) / period * c)
+			})
+			if last := len(result) - 1; last >= 0 && reflect.DeepEqual(result[last].Elements, frame.Elements) {
+				result[last].Duration += frame.Duration
+				continue
+			}
+			result = append(result, frame)
+		}
+		return result
+	}
+
+	n := min(budget, limit)
+	best := render(n)
+	// Merged frames leave budget over; spend it on more positions.
+	for attempt := 0; attempt < 6 && len(best) < budget && n < limit; attempt++ {
+		n = min(limit, n+budget-len(best))
+		candidate := render(n)
+		if len(candidate) > budget {
+			break
+		}
+		best = candidate
+	}
+	return best
+}
+
+// renderMarqueeFrame flattens one frame with each track at the position
+// the callback picks for it.
+func renderMarqueeFrame(tracks []marqueeTrack, framed bool, duration int, position func(int, marqueeTrack) int) Frame {
+	var elements []Element
+	if framed {
+		elements = append(elements,
+			Element{Type: "line", X: 0, Y: 0, Width: 128, Height: 1},
+			Element{Type: "line", X: 0, Y: 63, Width: 128, Height: 1},
+			Element{Type: "line", X: 0, Y: 0, Width: 1, Height: 64},
+			Element{Type: "line", X: 127, Y: 0, Width: 1, Height: 64},
+		)
+	}
+	for i, t := range tracks {
+		elements = append(elements, t.elements(position(i, t))...)
+	}
+	return convertFrameToBitmap(Frame{Version: 1, Duration: duration, Clear: true, Elements: elements})
+}
+
+// marqueeFrameBudget is how many frames a marquee may use: the requested
+// count, else what the device reported with X-ESP32-Max-Frames so it plays
+// from memory without paging. For the shared display the smallest budget
+// among known devices applies. The caller must hold mutex.
+func marqueeFrameBudget(dev *DeviceState, requested int) int {
+	budget := requested
+	if budget <= 0 && dev != nil {
+		budget = dev.MaxGifFrames
+	}
+	if budget <= 0 && dev == nil {
+		for _, d := range devices {
+			if d.MaxGifFrames > 0 && (budget <= 0 || d.MaxGifFrames < budget) {
+				budget = d.MaxGifFrames
+			}
+		}
+	}
+	if budget <= 0 {
+		budget = defaultGifMaxFrames
+	}
+	return min(max(budget, 2), maxGifPageFrames)
+}
+
+// validateMarqueeLine checks a line after defaults are filled in.
+func validateMarqueeLine(line MarqueeLine, vertical bool) error {
+	if line.Text == "" {
+		return fmt.Errorf("text is required")
+	}
+	if utf8.RuneCountInString(line.Text) > maxMarqueeRunes {
+		return fmt.Errorf("text must be at most %d characters", maxMarqueeRunes)
+	}
+	if line.Size < 1 || line.Size > 4 {
+		return fmt.Errorf("size must be between 1 and 4")
+	}
+	if line.Speed < 1 || line.Speed > 32 {
+		return fmt.Errorf("speed must be between 1 and 32")
+	}
+	if line.Y < 0 || line.Y >= oledHeight {
+		return fmt.Errorf("y must be between 0 and %d", oledHeight-1)
+	}
+	validDirections := map[string]bool{"left": true, "right": true}
+	if vertical {
+		validDirections["up"], validDirections["down"] = true, true
+	}
+	if !validDirections[line.Direction] {
+		return fmt.Errorf("invalid direction: %s", line.Direction)
+	}
+	return nil
+}
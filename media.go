@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxMediaAssets        = 64
+	maxMediaNameLength    = 64
+	defaultThumbnailScale = 1
+	// maxAssetCycleFrames bounds how many frames an animation may add to the
+	// rotation when it is looped to fill its cycle item's duration.
+	maxAssetCycleFrames = 200
+)
+
+// The media library keeps every upload as an asset in mediaDir, one JSON
+// file per asset. Cycle items point at assets by ID instead of carrying
+// bitmaps in config.json.
+
+func validateMediaName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len([]rune(name)) > maxMediaNameLength {
+		return fmt.Errorf("name must be at most %d characters", maxMediaNameLength)
+	}
+	return nil
+}
+
+func mediaAssetFile(id string) string {
+	return filepath.Join(mediaDir, id+".json")
+}
+
+// newMediaAsset describes converted frames as an asset. Width and height
+// are those of the first frame's bitmap.
+func newMediaAsset(name string, assetFrames []Frame) MediaAsset {
+	asset := MediaAsset{
+		Name:       name,
+		Animated:   len(assetFrames) > 1,
+		FrameCount: len(assetFrames),
+		CreatedAt:  time.Now(),
+		Frames:     assetFrames,
+	}
+	for _, frame := range assetFrames {
+		asset.Duration += frame.Duration
+	}
+	if len(assetFrames) > 0 {
+		for _, el := range assetFrames[0].Elements {
+			if el.Type == "bitmap" {
+				asset.Width, asset.Height = el.Width, el.Height
+				break
+			}
+		}
+	}
+	return asset
+}
+
+// mediaSummary is an asset without its frames, as listed by the API.
+func mediaSummary(asset *MediaAsset) MediaAsset {
+	summary := *asset
+	summary.Frames = nil
+	return summary
+}
+
+// addMediaAsset stores converted frames in the library under a new ID.
+func addMediaAsset(name string, assetFrames []Frame, playback *GifPlayback) (MediaAsset, error) {
+	name = strings.TrimSpace(name)
+	if runes := []rune(name); len(runes) > maxMediaNameLength {
+		name = string(runes[:maxMediaNameLength])
+	}
+	if name == "" {
+		name = "Untitled"
+	}
+	if len(assetFrames) == 0 {
+		return MediaAsset{}, fmt.Errorf("no frames to store")
+	}
+	asset := newMediaAsset(name, assetFrames)
+	if asset.Animated {
+		asset.Playback = playback
+	}
+
+	mutex.Lock()
+	if len(mediaAssets) >= maxMediaAssets {
+		mutex.Unlock()
+		return MediaAsset{}, fmt.Errorf("media library is full (%d assets)", maxMediaAssets)
+	}
+	mediaCounter++
+	asset.ID = fmt.Sprintf("asset-%d", mediaCounter)
+	mediaAssets[asset.ID] = &asset
+	mutex.Unlock()
+
+	if err := writeMediaAsset(asset); err != nil {
+		mutex.Lock()
+		delete(mediaAssets, asset.ID)
+		mutex.Unlock()
+		return MediaAsset{}, err
+	}
+
+	invalidateRenderCache("image")
+	log.Printf("🗂️  Media asset %s stored: %q (%d frames)", asset.ID, asset.Name, asset.FrameCount)
+	return mediaSummary(&asset), nil
+}
+
+func writeMediaAsset(asset MediaAsset) error {
+	if err := os.MkdirAll(mediaDir, 0700); err != nil {
+		return fmt.Errorf("creating %s: %v", mediaDir, err)
+	}
+	stored := asset
+	stored.Frames = make([]Frame, len(asset.Frames))
+	for i, frame := range asset.Frames {
+		stored.Frames[i] = encodeFrameBitmaps(frame, bitmapEncodingBase64)
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("encoding asset: %v", err)
+	}
+	path := mediaAssetFile(asset.ID)
+	tempFile := path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0600); err != nil {
+		return fmt.Errorf("writing asset: %v", err)
+	}
+	if err := os.Rename(tempFile, path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("renaming asset: %v", err)
+	}
+	return nil
+}
+
+func loadMediaLibrary() {
+	paths, err := filepath.Glob(filepath.Join(mediaDir, "*.json"))
+	if err != nil || len(paths) == 0 {
+		return
+	}
+
+	loaded := make(map[string]*MediaAsset, len(paths))
+	highest := 0
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Error reading %s: %v", path, err)
+			continue
+		}
+		var asset MediaAsset
+		if err := json.Unmarshal(data, &asset); err != nil || mediaAssetFile(asset.ID) != path {
+			log.Printf("Skipping invalid media asset %s", path)
+			continue
+		}
+		decoded, err := decodeCustomFrames(CustomContent{Frames: asset.Frames})
+		if err != nil {
+			log.Printf("Skipping media asset %s: %v", asset.ID, err)
+			continue
+		}
+		asset.Frames = decoded
+		loaded[asset.ID] = &asset
+		if n, err := strconv.Atoi(strings.TrimPrefix(asset.ID, "asset-")); err == nil && n > highest {
+			highest = n
+		}
+	}
+
+	mutex.Lock()
+	mediaAssets = loaded
+	mediaCounter = highest
+	mutex.Unlock()
+
+	log.Printf("Loaded %d media assets", len(loaded))
+}
+
+// mediaList reports the library, oldest first. The caller must hold mutex.
+func mediaList() []MediaAsset {
+	list := make([]MediaAsset, 0, len(mediaAssets))
+	for _, asset := range mediaAssets {
+		list = append(list, mediaSummary(asset))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// mediaFrames snapshots the frames of every asset for widget rendering.
+// Asset frames are never modified once stored, so sharing them is safe. The
+// caller must hold mutex.
+func mediaFrames() map[string][]Frame {
+	out := make(map[string][]Frame, len(mediaAssets))
+	for id, asset := range mediaAssets {
+		out[id] = asset.Frames
+	}
+	return out
+}
+
+// mediaAssetUsers lists the cycle items and profiles that show an asset.
+// The caller must hold mutex.
+func mediaAssetUsers(id string) []string {
+	var users []string
+	for _, item := range cycleItems {
+		if item.AssetID == id {
+			users = append(users, "cycle item "+item.ID)
+		}
+	}
+	for _, p := range profiles {
+		for _, item := range p.CycleItems {
+			if item.AssetID == id {
+				users = append(users, fmt.Sprintf("profile %q", p.Name))
+				break
+			}
+		}
+	}
+	return users
+}
+
+// assetCycleFrames turns an asset into cycle frames. A still image is shown
+// for the item's duration; an animation plays at its own frame timing and
+// loops until the duration is filled, always playing at least once. The
+// animation's frames are marked OwnTiming so the device is served each one
+// for its own duration rather than the refresh interval.
+func assetCycleFrames(assetFrames []Frame, duration int) []Frame {
+	if len(assetFrames) == 0 {
+		return nil
+	}
+	if len(assetFrames) == 1 {
+		frame := assetFrames[0]
+		frame.Duration = duration
+		return []Frame{frame}
+	}
+	var out []Frame
+	elapsed := 0
+	for len(out) < maxAssetCycleFrames {
+		for _, frame := range assetFrames {
+			frame.OwnTiming = true
+			out = append(out, frame)
+			elapsed += frame.Duration
+		}
+		if elapsed >= duration || len(out)+len(assetFrames) > maxAssetCycleFrames {
+			break
+		}
+	}
+	return out
+}
+
+func handleMedia(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		mutex.Lock()
+		list := mediaList()
+		mutex.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"assets": list})
+
+	case http.MethodPost:
+		opts, err := parseUploadOptions(r)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		newFrames, filename, _, ok := readUploadedImage(w, r, opts)
+		if !ok {
+			return
+		}
+		name := r.FormValue("name")
+		if name == "" {
+			name = filename
+		}
+		asset, err := addMediaAsset(name, newFrames, opts.Playback)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusInsufficientStorage)
+			return
+		}
+		json.NewEncoder(w).Encode(asset)
+
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		mutex.Lock()
+		if _, ok := mediaAssets[id]; !ok {
+			mutex.Unlock()
+			jsonError(w, "Asset not found", http.StatusNotFound)
+			return
+		}
+		if users := mediaAssetUsers(id); len(users) > 0 {
+			mutex.Unlock()
+			jsonError(w, "Asset is in use by "+strings.Join(users, ", "), http.StatusConflict)
+			return
+		}
+		delete(mediaAssets, id)
+		mutex.Unlock()
+
+		if err := os.Remove(mediaAssetFile(id)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing media asset %s: %v", id, err)
+		}
+		log.Printf("🗂️  Media asset %s deleted", id)
+		json.NewEncoder(w).Encode(map[string]string{"status": "deleted", "id": id})
+
+	default:
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleMediaRename(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if err := validateMediaName(req.Name); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mutex.Lock()
+	asset, ok := mediaAssets[req.ID]
+	if !ok {
+		mutex.Unlock()
+		jsonError(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+	asset.Name = req.Name
+	stored := *asset
+	mutex.Unlock()
+
+	if err := writeMediaAsset(stored); err != nil {
+		jsonError(w, "Failed to save asset: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("🗂️  Media asset %s renamed to %q", stored.ID, stored.Name)
+	json.NewEncoder(w).Encode(mediaSummary(&stored))
+}
+
+func handleMediaThumbnail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	scale := defaultThumbnailScale
+	if s := query.Get("scale"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 || v > maxPreviewScale {
+			jsonError(w, fmt.Sprintf("scale must be between 1 and %d", maxPreviewScale), http.StatusBadRequest)
+			return
+		}
+		scale = v
+	}
+
+	mutex.Lock()
+	asset, ok := mediaAssets[query.Get("id")]
+	var assetFrames []Frame
+	if ok {
+		assetFrames = asset.Frames
+	}
+	mutex.Unlock()
+	if !ok {
+		jsonError(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+
+	pos := 0
+	if f := query.Get("frame"); f != "" {
+		v, err := strconv.Atoi(f)
+		if err != nil || v < 0 || v >= len(assetFrames) {
+			jsonError(w, fmt.Sprintf("frame must be an index below %d", len(assetFrames)), http.StatusBadRequest)
+			return
+		}
+		pos = v
+	}
+
+	canvas, _ := rasterizeFrame(assetFrames[pos])
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, canvas.Image(scale)); err != nil {
+		jsonError(w, "Failed to encode thumbnail", http.StatusInternalServerError)
+		return
+	}
+
+	// Asset frames never change, so thumbnails can be cached.
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("X-Frame-Count", strconv.Itoa(len(assetFrames)))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func handleMediaShow(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mutex.Lock()
+	asset, ok := mediaAssets[req.ID]
+	if !ok {
+		mutex.Unlock()
+		jsonError(w, "Asset not found", http.StatusNotFound)
+		return
+	}
+	setDisplayFrames(resolveDevice(r), asset.Frames, asset.Animated, CustomSource{
+		Type:     "media",
+		Params:   map[string]interface{}{"assetId": asset.ID, "name": asset.Name},
+		Playback: asset.Playback,
+	})
+	summary := mediaSummary(asset)
+	mutex.Unlock()
+
+	log.Printf("🗂️  Showing media asset %s (%q)", summary.ID, summary.Name)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "shown", "asset": summary})
+}
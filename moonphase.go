@@ -69,6 +69,8 @@ func updateMoonPhaseData() {
 	moonPhaseLastFetch = time.Now()
 	mutex.Unlock()
 
+	invalidateRenderCache("moonphase")
+
 	log.Printf("🌙 Updated moon phase: %s (%.0f%% illuminated)", phaseName, illumination*100)
 
 	saveConfig()
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// normalDisplayContrast is the SSD1306 contrast Adafruit's begin() sets,
+// sent outside night mode so devices restore it after a quiet window.
+const normalDisplayContrast = 0xCF
+
+func defaultNightMode() NightMode {
+	return NightMode{
+		StartTime:     "22:00",
+		EndTime:       "07:00",
+		LedOff:        true,
+		LedBrightness: 10,
+		Contrast:      1,
+	}
+}
+
+func validateNightMode(nm NightMode) error {
+	if nm.StartTime == "" || nm.EndTime == "" {
+		return fmt.Errorf("startTime and endTime are required")
+	}
+	if err := validateScheduleRule(nightModeRule(nm)); err != nil {
+		return err
+	}
+	if nm.LedBrightness < 0 || nm.LedBrightness > 100 {
+		return fmt.Errorf("ledBrightness must be between 0 and 100")
+	}
+	if nm.Contrast < 0 || nm.Contrast > 255 {
+		return fmt.Errorf("contrast must be between 0 and 255")
+	}
+	return nil
+}
+
+func nightModeRule(nm NightMode) ScheduleRule {
+	return ScheduleRule{Days: nm.Days, StartTime: nm.StartTime, EndTime: nm.EndTime}
+}
+
+// isNightModeActive reports whether the quiet window is open right now in
+// the display timezone. The caller must hold mutex.
+func isNightModeActive() bool {
+	return nightMode.Enabled && ruleActive(nightModeRule(nightMode), displayNow())
+}
+
+// applyNightMode quiets the LED and dims the panel during the night window.
+// The caller must hold mutex.
+func applyNightMode(fs *FrameSettings) {
+	fs.DisplayContrast = normalDisplayContrast
+	if !isNightModeActive() {
+		return
+	}
+	fs.NightMode = true
+	fs.DisplayContrast = nightMode.Contrast
+	if nightMode.LedOff {
+		fs.LedBeaconEnabled = false
+	} else if fs.LedBrightness > nightMode.LedBrightness {
+		fs.LedBrightness = nightMode.LedBrightness
+	}
+}
+
+// renderNightFrame is the minimal clock that replaces the cycle at night.
+func renderNightFrame(ctx WidgetContext) Frame {
+	currentTime := ctx.Now.Format("15:04")
+	size := getScaledTextSize(2)
+	return Frame{
+		Version:  1,
+		Duration: 3000,
+		Clear:    true,
+		Elements: []Element{
+			{Type: "text", X: calcCenteredX(currentTime, size), Y: 32 - 7*size/2, Size: size, Value: currentTime},
+		},
+	}
+}
+
+func handleNightMode(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodGet {
+		mutex.Lock()
+		response := map[string]interface{}{
+			"nightMode": nightMode,
+			"active":    isNightModeActive(),
+		}
+		mutex.Unlock()
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		// Fields missing from the body keep their current values.
+		mutex.Lock()
+		updated := nightMode
+		updated.Days = append([]string(nil), nightMode.Days...)
+		mutex.Unlock()
+
+		if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+			jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := validateNightMode(updated); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mutex.Lock()
+		nightMode = updated
+		noteConfigChange(fmt.Sprintf("nightMode enabled=%v window=%s-%s", updated.Enabled, updated.StartTime, updated.EndTime))
+		response := map[string]interface{}{
+			"nightMode": nightMode,
+			"active":    isNightModeActive(),
+			"status":    "updated",
+		}
+		mutex.Unlock()
+
+		invalidateRenderCache()
+		go saveConfig()
+		publishEvent("night", response)
+
+		log.Printf("🌙 Night mode: enabled=%v, window=%s-%s, ledOff=%v", updated.Enabled, updated.StartTime, updated.EndTime, updated.LedOff)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
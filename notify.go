@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	maxNotifications            = 32
+	maxNotificationText         = 168
+	defaultNotificationDuration = 5000
+	// notificationBlinkGap is the blank frame between repeats so a repeated
+	// message visibly flashes instead of looking like one long showing.
+	notificationBlinkGap = 250
+)
+
+func validateNotification(n Notification) error {
+	text := strings.TrimSpace(n.Text)
+	if text == "" && len(n.Bitmap) == 0 {
+		return fmt.Errorf("text or bitmap is required")
+	}
+	if text != "" && len(n.Bitmap) > 0 {
+		return fmt.Errorf("provide text or bitmap, not both")
+	}
+	if len([]rune(n.Text)) > maxNotificationText {
+		return fmt.Errorf("text must be at most %d characters", maxNotificationText)
+	}
+	if len(n.Bitmap) > 0 {
+		if n.Width <= 0 || n.Width > oledWidth || n.Height <= 0 || n.Height > oledHeight {
+			return fmt.Errorf("bitmap must be between 1x1 and %dx%d", oledWidth, oledHeight)
+		}
+		if want := (n.Width + 7) / 8 * n.Height; len(n.Bitmap) != want {
+			return fmt.Errorf("bitmap must have %d bytes for %dx%d", want, n.Width, n.Height)
+		}
+	}
+	if n.Priority < 0 || n.Priority > 100 {
+		return fmt.Errorf("priority must be between 0 and 100")
+	}
+	if n.Duration < 500 || n.Duration > 60000 {
+		return fmt.Errorf("duration must be between 500 and 60000")
+	}
+	if n.Repeat < 1 || n.Repeat > 10 {
+		return fmt.Errorf("repeat must be between 1 and 10")
+	}
+	if n.LedEffect != "" {
+		validModes := map[string]bool{"auto": true, "static": true, "flash": true, "pulse": true, "rainbow": true}
+		if !validModes[n.LedEffect] {
+			return fmt.Errorf("invalid ledEffect: %s", n.LedEffect)
+		}
+	}
+	if n.LedColor != "" && (len(n.LedColor) != 7 || n.LedColor[0] != '#') {
+		return fmt.Errorf("ledColor must be in #RRGGBB format")
+	}
+	if n.TTL < 0 || n.TTL > 86400 {
+		return fmt.Errorf("ttl must be between 0 and 86400 seconds")
+	}
+	return nil
+}
+
+// notificationLength is how long a notification holds the display once it
+// starts: every showing plus the blank gaps between them.
+func notificationLength(n Notification) time.Duration {
+	ms := n.Repeat*n.Duration + (n.Repeat-1)*notificationBlinkGap
+	return time.Duration(ms) * time.Millisecond
+}
+
+// sortNotifications orders the queue by display order: highest priority
+// first, oldest first within a priority. The caller must hold mutex.
+func sortNotifications() {
+	sort.SliceStable(notifications, func(i, j int) bool {
+		if notifications[i].Priority != notifications[j].Priority {
+			return notifications[i].Priority > notifications[j].Priority
+		}
+		return notifications[i].CreatedAt.Before(notifications[j].CreatedAt)
+	})
+}
+
+// activeNotification drops finished and stale notifications and returns the
+// one that owns the display at now, or nil when the cycle should play. A
+// notification preempted by a higher priority one starts over when it gets
+// the display back. The caller must hold mutex.
+func activeNotification(now time.Time) *Notification {
+	kept := notifications[:0]
+	changed := false
+	for _, n := range notifications {
+		switch {
+		case !n.StartedAt.IsZero() && !now.Before(n.StartedAt.Add(notificationLength(n))):
+			changed = true
+		case n.StartedAt.IsZero() && n.TTL > 0 && now.After(n.CreatedAt.Add(time.Duration(n.TTL)*time.Second)):
+			log.Printf("🔔 Notification %s expired before it was shown", n.ID)
+			changed = true
+		default:
+			kept = append(kept, n)
+		}
+	}
+	notifications = kept
+
+	if len(notifications) == 0 {
+		if activeNotificationID != "" {
+			activeNotificationID = ""
+			log.Printf("🔔 Notification queue drained, resuming cycle")
+		}
+		if changed {
+			publishEvent("notifications", notificationList())
+		}
+		return nil
+	}
+
+	sortNotifications()
+	head := &notifications[0]
+	if head.ID != activeNotificationID {
+		for i := range notifications {
+			if notifications[i].ID == activeNotificationID {
+				notifications[i].StartedAt = time.Time{}
+			}
+		}
+		head.StartedAt = now
+		activeNotificationID = head.ID
+		log.Printf("🔔 Showing notification %s (priority %d)", head.ID, head.Priority)
+		changed = true
+	}
+	if changed {
+		publishEvent("notifications", notificationList())
+	}
+	return head
+}
+
+// notificationFrame returns what a notification shows at now: its content
+// during a showing, a blank frame during the gap between repeats. Duration
+// is the time left in that phase so devices poll again right at the switch.
+func notificationFrame(n Notification, now time.Time) Frame {
+	period := n.Duration + notificationBlinkGap
+	phase := int(now.Sub(n.StartedAt)/time.Millisecond) % period
+
+	if phase >= n.Duration {
+		return Frame{Version: 1, Duration: period - phase, Clear: true, Elements: []Element{}}
+	}
+
+	frame := Frame{Version: 1, Duration: n.Duration - phase, Clear: true}
+	if len(n.Bitmap) > 0 {
+		frame.Elements = []Element{{
+			Type:   "bitmap",
+			X:      (oledWidth - n.Width) / 2,
+			Y:      (oledHeight - n.Height) / 2,
+			Width:  n.Width,
+			Height: n.Height,
+			Bitmap: n.Bitmap,
+		}}
+		return frame
+	}
+
+	text := strings.TrimSpace(n.Text)
+	size, perLine := 2, 10
+	if len([]rune(text)) > perLine {
+		size, perLine = 1, 21
+	}
+	lines := wrapWords(text, perLine)
+	if maxLines := oledHeight / (8 * size); len(lines) > maxLines {
+		lines = lines[:maxLines]
+	}
+	y := (oledHeight - len(lines)*8*size) / 2
+	for _, line := range lines {
+		frame.Elements = append(frame.Elements, Element{
+			Type:  "text",
+			X:     calcCenteredX(line, size),
+			Y:     y,
+			Size:  size,
+			Value: line,
+		})
+		y += 8 * size
+	}
+	return frame
+}
+
+// wrapWords breaks text into lines of at most width characters, splitting
+// words that are longer than a line.
+func wrapWords(text string, width int) []string {
+	var lines []string
+	current := ""
+	for _, word := range strings.Fields(text) {
+		for len([]rune(word)) > width {
+			if current != "" {
+				lines = append(lines, current)
+				current = ""
+			}
+			runes := []rune(word)
+			lines = append(lines, string(runes[:width]))
+			word = string(runes[width:])
+		}
+		switch {
+		case current == "":
+			current = word
+		case len([]rune(current))+1+len([]rune(word)) <= width:
+			current += " " + word
+		default:
+			lines = append(lines, current)
+			current = word
+		}
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// applyNotificationLed lets a notification override the LED beacon. The
+// override wins over night mode's LED-off since notifications are urgent.
+func applyNotificationLed(fs *FrameSettings, n Notification) {
+	if n.LedColor == "" && n.LedEffect == "" {
+		return
+	}
+	fs.LedBeaconEnabled = true
+	if n.LedColor != "" {
+		fs.LedCustomColor = n.LedColor
+		fs.LedEffectMode = "static"
+	}
+	if n.LedEffect != "" {
+		fs.LedEffectMode = n.LedEffect
+	}
+}
+
+// writeNotificationFrame answers a frame poll with the active notification.
+// It reports false when the queue is empty and the cycle should be served.
+// The caller must hold mutex.
+func writeNotificationFrame(w http.ResponseWriter, r *http.Request, fs FrameSettings) bool {
+	now := time.Now()
+	n := activeNotification(now)
+	if n == nil {
+		return false
+	}
+	applyNotificationLed(&fs, *n)
+	frame := encodeFrameBitmaps(notificationFrame(*n, now), getBitmapEncoding(r))
+	writeFrameJSON(w, r, buildFrameResponse(frame, false, fs))
+	return true
+}
+
+// notificationList reports the queue in display order. The caller must hold
+// mutex.
+func notificationList() []NotificationStatus {
+	list := make([]NotificationStatus, 0, len(notifications))
+	for _, n := range notifications {
+		list = append(list, NotificationStatus{Notification: n, Active: n.ID == activeNotificationID})
+	}
+	return list
+}
+
+func handleNotify(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		mutex.Lock()
+		activeNotification(time.Now())
+		response := map[string]interface{}{
+			"notifications": notificationList(),
+			"active":        activeNotificationID,
+		}
+		mutex.Unlock()
+		json.NewEncoder(w).Encode(response)
+
+	case http.MethodPost:
+		var req struct {
+			Text      string `json:"text"`
+			Bitmap    []int  `json:"bitmap"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+			Priority  int    `json:"priority"`
+			Duration  int    `json:"duration"`
+			Repeat    int    `json:"repeat"`
+			LedColor  string `json:"ledColor"`
+			LedEffect string `json:"ledEffect"`
+			TTL       int    `json:"ttl"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Duration == 0 {
+			req.Duration = defaultNotificationDuration
+		}
+		if req.Repeat == 0 {
+			req.Repeat = 1
+		}
+		n := Notification{
+			Text:      req.Text,
+			Bitmap:    req.Bitmap,
+			Width:     req.Width,
+			Height:    req.Height,
+			Priority:  req.Priority,
+			Duration:  req.Duration,
+			Repeat:    req.Repeat,
+			LedColor:  req.LedColor,
+			LedEffect: req.LedEffect,
+			TTL:       req.TTL,
+		}
+		if err := validateNotification(n); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mutex.Lock()
+		activeNotification(time.Now())
+		if len(notifications) >= maxNotifications {
+			mutex.Unlock()
+			jsonError(w, fmt.Sprintf("Notification queue is full (%d)", maxNotifications), http.StatusServiceUnavailable)
+			return
+		}
+		notificationCounter++
+		n.ID = fmt.Sprintf("notify-%d", notificationCounter)
+		n.CreatedAt = time.Now()
+		notifications = append(notifications, n)
+		sortNotifications()
+		position := 0
+		for i := range notifications {
+			if notifications[i].ID == n.ID {
+				position = i
+				break
+			}
+		}
+		response := map[string]interface{}{
+			"status":      "queued",
+			"id":          n.ID,
+			"position":    position,
+			"queueLength": len(notifications),
+		}
+		publishEvent("notifications", notificationList())
+		mutex.Unlock()
+
+		log.Printf("🔔 Notification %s queued (priority %d, %dms x%d)", n.ID, n.Priority, n.Duration, n.Repeat)
+		json.NewEncoder(w).Encode(response)
+
+	case http.MethodDelete:
+		query := r.URL.Query()
+		id := query.Get("id")
+		if id == "" && query.Get("all") != "true" {
+			jsonError(w, "id or all=true is required", http.StatusBadRequest)
+			return
+		}
+
+		mutex.Lock()
+		removed := 0
+		kept := notifications[:0]
+		for _, n := range notifications {
+			if id == "" || n.ID == id {
+				removed++
+				continue
+			}
+			kept = append(kept, n)
+		}
+		notifications = kept
+		if removed == 0 && id != "" {
+			mutex.Unlock()
+			jsonError(w, "Notification not found", http.StatusNotFound)
+			return
+		}
+		if id == "" || id == activeNotificationID {
+			activeNotificationID = ""
+		}
+		response := map[string]interface{}{
+			"status":      "dismissed",
+			"removed":     removed,
+			"queueLength": len(notifications),
+		}
+		publishEvent("notifications", notificationList())
+		mutex.Unlock()
+
+		log.Printf("🔔 Dismissed %d notification(s)", removed)
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -96,11 +96,11 @@ func handlePomodoro(w http.ResponseWriter, r *http.Request) {
 			jsonError(w, "Invalid action: "+req.Action, http.StatusBadRequest)
 			return
 		}
-		response := map[string]interface{}{
-			"session":  pomodoroSession,
-			"settings": pomodoroSettings,
-		}
+		response := pomodoroEventData()
+		publishEvent("pomodoro", response)
 		mutex.Unlock()
+
+		invalidateRenderCache("pomodoro")
 		json.NewEncoder(w).Encode(response)
 		return
 	}
@@ -141,12 +141,12 @@ func handlePomodoro(w http.ResponseWriter, r *http.Request) {
 			pomodoroSession.TimeRemaining = pomodoroSettings.WorkDuration
 		}
 
-		response := map[string]interface{}{
-			"session":  pomodoroSession,
-			"settings": pomodoroSettings,
-		}
+		response := pomodoroEventData()
+		publishEvent("pomodoro", response)
+		noteConfigChange("pomodoro settings updated")
 		mutex.Unlock()
 
+		invalidateRenderCache()
 		go saveConfig()
 		log.Printf("🍅 Pomodoro settings updated: work=%dmin, break=%dmin, long=%dmin, cycles=%d",
 			pomodoroSettings.WorkDuration/60, pomodoroSettings.BreakDuration/60,
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPreviewScale = 4
+	maxPreviewScale     = 16
+)
+
+// previewFrame picks the frame a preview request refers to: one frame of a
+// cycle item rendered on the spot when "item" is set, otherwise an index
+// into the rotation a device is playing, or its current frame.
+func previewFrame(r *http.Request) (Frame, int, int, error) {
+	query := r.URL.Query()
+	frameParam := query.Get("frame")
+
+	mutex.Lock()
+	dev := devices[getDeviceID(r)]
+
+	if itemID := query.Get("item"); itemID != "" {
+		var item CycleItem
+		found := false
+		for _, ci := range cycleItems {
+			if ci.ID == itemID {
+				item = ci
+				found = true
+				break
+			}
+		}
+		ctx := snapshotWidgetContext()
+		mutex.Unlock()
+
+		if !found {
+			return Frame{}, 0, 0, fmt.Errorf("cycle item %q not found", itemID)
+		}
+		item.Enabled = true
+		itemFrames := renderWidget(ctx, "preview:"+itemID, item)
+		pos, err := previewIndex(frameParam, 0, len(itemFrames))
+		if err != nil {
+			return Frame{}, 0, 0, err
+		}
+		return itemFrames[pos], pos, len(itemFrames), nil
+	}
+	defer mutex.Unlock()
+
+	deviceFrames := activeFrames(dev)
+	pos, err := previewIndex(frameParam, *frameCursor(dev), len(deviceFrames))
+	if err != nil {
+		return Frame{}, 0, 0, err
+	}
+	return deviceFrames[pos], pos, len(deviceFrames), nil
+}
+
+// previewIndex resolves a "frame" parameter, where empty or "current" means
+// the cursor position.
+func previewIndex(param string, cursor, count int) (int, error) {
+	if count == 0 {
+		return 0, fmt.Errorf("no frames available")
+	}
+	if param == "" || param == "current" {
+		if cursor < 0 || cursor >= count {
+			return 0, nil
+		}
+		return cursor, nil
+	}
+	pos, err := strconv.Atoi(param)
+	if err != nil || pos < 0 || pos >= count {
+		return 0, fmt.Errorf("frame must be \"current\" or an index below %d", count)
+	}
+	return pos, nil
+}
+
+func handlePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	scale := defaultPreviewScale
+	if s := r.URL.Query().Get("scale"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 || v > maxPreviewScale {
+			jsonError(w, fmt.Sprintf("scale must be between 1 and %d", maxPreviewScale), http.StatusBadRequest)
+			return
+		}
+		scale = v
+	}
+
+	ensureFrames()
+
+	frame, pos, count, err := previewFrame(r)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	canvas, clipped := rasterizeFrame(frame)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, canvas.Image(scale)); err != nil {
+		jsonError(w, "Failed to encode preview", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Disposition", "inline; filename=\"esp-desk-preview.png\"")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Index", strconv.Itoa(pos))
+	w.Header().Set("X-Frame-Count", strconv.Itoa(count))
+	if len(clipped) > 0 {
+		report, _ := json.Marshal(clipped)
+		w.Header().Set("X-Clipped-Elements", string(report))
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
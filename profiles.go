@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	maxProfiles          = 16
+	maxProfileNameLength = 32
+)
+
+// profileWindowOpen remembers which scheduled profiles had an open window at
+// the last check, so a schedule only switches profiles when a window opens
+// and a manual switch inside the window sticks.
+var profileWindowOpen = make(map[string]bool)
+
+func validateProfile(p Profile) error {
+	name := strings.TrimSpace(p.Name)
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if name != p.Name {
+		return fmt.Errorf("name must not start or end with spaces")
+	}
+	if len([]rune(name)) > maxProfileNameLength {
+		return fmt.Errorf("name must be at most %d characters", maxProfileNameLength)
+	}
+	if len(p.CycleItems) == 0 {
+		return fmt.Errorf("cycleItems must not be empty")
+	}
+	if err := validateCycleItems(p.CycleItems); err != nil {
+		return err
+	}
+	validScales := map[string]bool{"compact": true, "normal": true, "large": true}
+	if !validScales[p.DisplayScale] {
+		return fmt.Errorf("invalid displayScale: %s", p.DisplayScale)
+	}
+	if p.LedBrightness < 0 || p.LedBrightness > 100 {
+		return fmt.Errorf("ledBrightness must be between 0 and 100")
+	}
+	validModes := map[string]bool{"auto": true, "static": true, "flash": true, "pulse": true, "rainbow": true}
+	if !validModes[p.LedEffectMode] {
+		return fmt.Errorf("invalid ledEffectMode: %s", p.LedEffectMode)
+	}
+	if len(p.LedCustomColor) != 7 || p.LedCustomColor[0] != '#' {
+		return fmt.Errorf("ledCustomColor must be in #RRGGBB format")
+	}
+	if p.LedFlashSpeed < 100 || p.LedFlashSpeed > 2000 {
+		return fmt.Errorf("ledFlashSpeed must be between 100 and 2000")
+	}
+	if p.LedPulseSpeed < 500 || p.LedPulseSpeed > 3000 {
+		return fmt.Errorf("ledPulseSpeed must be between 500 and 3000")
+	}
+	return validateSchedule(p.Schedule)
+}
+
+// captureProfile snapshots the live settings into a profile. The caller
+// must hold mutex.
+func captureProfile(name string) Profile {
+	return Profile{
+		Name:             name,
+		CycleItems:       append([]CycleItem(nil), cycleItems...),
+		ShowHeaders:      showHeaders,
+		DisplayScale:     displayScale,
+		LedBrightness:    ledBrightness,
+		LedBeaconEnabled: ledBeaconEnabled,
+		LedEffectMode:    ledEffectMode,
+		LedCustomColor:   ledCustomColor,
+		LedFlashSpeed:    ledFlashSpeed,
+		LedPulseSpeed:    ledPulseSpeed,
+		WidgetOptions: WidgetOptions{
+			BCD24HourMode:     bcd24HourMode,
+			BCDShowSeconds:    bcdShowSeconds,
+			TimeShowSeconds:   timeShowSeconds,
+			AnalogShowSeconds: analogShowSeconds,
+			AnalogShowRoman:   analogShowRoman,
+		},
+	}
+}
+
+// applyProfile makes a profile the live configuration. The caller must hold
+// mutex and save the config afterwards.
+func applyProfile(p Profile) {
+	cycleItems = append([]CycleItem(nil), p.CycleItems...)
+	showHeaders = p.ShowHeaders
+	displayScale = p.DisplayScale
+	ledBrightness = p.LedBrightness
+	ledBeaconEnabled = p.LedBeaconEnabled
+	ledEffectMode = p.LedEffectMode
+	ledCustomColor = p.LedCustomColor
+	ledFlashSpeed = p.LedFlashSpeed
+	ledPulseSpeed = p.LedPulseSpeed
+	bcd24HourMode = p.WidgetOptions.BCD24HourMode
+	bcdShowSeconds = p.WidgetOptions.BCDShowSeconds
+	timeShowSeconds = p.WidgetOptions.TimeShowSeconds
+	analogShowSeconds = p.WidgetOptions.AnalogShowSeconds
+	analogShowRoman = p.WidgetOptions.AnalogShowRoman
+	activeProfile = p.Name
+	index = 0
+}
+
+// detachProfile forgets the active profile once a setting it covers is
+// changed by hand, so the dashboard stops claiming the profile is in
+// effect. The caller must hold mutex.
+func detachProfile() {
+	if activeProfile == "" {
+		return
+	}
+	log.Printf("🎛️  Profile %q no longer active: settings changed by hand", activeProfile)
+	activeProfile = ""
+}
+
+// findProfile returns the position of a profile by name, or -1. The caller
+// must hold mutex.
+func findProfile(name string) int {
+	for i, p := range profiles {
+		if p.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// activateProfile switches to a named profile and announces it. The caller
+// must hold mutex.
+func activateProfile(name, reason string) bool {
+	i := findProfile(name)
+	if i < 0 {
+		return false
+	}
+	applyProfile(profiles[i])
+	// Device rotations follow the new cycle from its start too.
+	for _, dev := range devices {
+		if !dev.IsCustomMode {
+			dev.Index = 0
+		}
+	}
+	noteConfigChange(fmt.Sprintf("profile %q activated (%s)", name, reason))
+	invalidateRenderCache()
+	go saveConfig()
+	publishEvent("settings", currentSettings())
+	log.Printf("🎛️  Profile %q activated (%s)", name, reason)
+	return true
+}
+
+// openProfileWindows reports, for each scheduled profile, whether its
+// window is open at now. The caller must hold mutex.
+func openProfileWindows(now time.Time) map[string]bool {
+	open := make(map[string]bool, len(profiles))
+	for _, p := range profiles {
+		if len(p.Schedule) > 0 {
+			open[p.Name] = isScheduledActive(CycleItem{Schedule: p.Schedule}, now)
+		}
+	}
+	return open
+}
+
+// checkProfileSchedules activates the first scheduled profile whose window
+// opened since the last check. The caller must hold mutex.
+func checkProfileSchedules(now time.Time) {
+	open := openProfileWindows(now)
+	opened := ""
+	for _, p := range profiles {
+		if open[p.Name] && !profileWindowOpen[p.Name] {
+			opened = p.Name
+			break
+		}
+	}
+	profileWindowOpen = open
+
+	if opened != "" && opened != activeProfile {
+		activateProfile(opened, "schedule")
+	}
+}
+
+// startProfileScheduler seeds the open windows from the current time before
+// the first check, so a window that is already open at startup does not
+// override the profile loaded from config.json.
+func startProfileScheduler() {
+	mutex.Lock()
+	profileWindowOpen = openProfileWindows(displayNow())
+	mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		for range ticker.C {
+			mutex.Lock()
+			checkProfileSchedules(displayNow())
+			mutex.Unlock()
+		}
+	}()
+}
+
+func profilesResponse() map[string]interface{} {
+	list := profiles
+	if list == nil {
+		list = []Profile{}
+	}
+	return map[string]interface{}{
+		"profiles":      list,
+		"activeProfile": activeProfile,
+	}
+}
+
+func handleProfiles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		mutex.Lock()
+		response := profilesResponse()
+		mutex.Unlock()
+		json.NewEncoder(w).Encode(response)
+
+	case http.MethodPost:
+		// With "capture" set, the profile is a snapshot of the live settings
+		// and only name and schedule are read from the body.
+		var req struct {
+			Profile
+			Capture bool `json:"capture"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		profile := req.Profile
+		if req.Capture {
+			mutex.Lock()
+			profile = captureProfile(req.Name)
+			mutex.Unlock()
+			profile.Schedule = req.Schedule
+		}
+		if err := validateProfile(profile); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mutex.Lock()
+		status := "updated"
+		if i := findProfile(profile.Name); i >= 0 {
+			profiles[i] = profile
+		} else {
+			if len(profiles) >= maxProfiles {
+				mutex.Unlock()
+				jsonError(w, fmt.Sprintf("At most %d profiles can be saved", maxProfiles), http.StatusBadRequest)
+				return
+			}
+			profiles = append(profiles, profile)
+			status = "created"
+		}
+		noteConfigChange(fmt.Sprintf("profile %q %s", profile.Name, status))
+		response := profilesResponse()
+		response["status"] = status
+		mutex.Unlock()
+
+		go saveConfig()
+		log.Printf("🎛️  Profile %q %s (%d cycle items)", profile.Name, status, len(profile.CycleItems))
+		json.NewEncoder(w).Encode(response)
+
+	case http.MethodDelete:
+		name := r.URL.Query().Get("name")
+		mutex.Lock()
+		i := findProfile(name)
+		if i < 0 {
+			mutex.Unlock()
+			jsonError(w, "Profile not found", http.StatusNotFound)
+			return
+		}
+		profiles = append(profiles[:i], profiles[i+1:]...)
+		if activeProfile == name {
+			activeProfile = ""
+		}
+		noteConfigChange(fmt.Sprintf("profile %q deleted", name))
+		response := profilesResponse()
+		response["status"] = "deleted"
+		mutex.Unlock()
+
+		go saveConfig()
+		log.Printf("🎛️  Profile %q deleted", name)
+		json.NewEncoder(w).Encode(response)
+
+	default:
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleProfileActivate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	mutex.Lock()
+	if !activateProfile(req.Name, "manual") {
+		mutex.Unlock()
+		jsonError(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	settings := currentSettings()
+	mutex.Unlock()
+
+	json.NewEncoder(w).Encode(settings)
+}
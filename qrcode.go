@@ -148,10 +148,10 @@ func handleQRCode(w http.ResponseWriter, r *http.Request) {
 
 		
 		mutex.Lock()
-		isCustomMode = true
-		isGifMode = false
-		frames = []Frame{frame}
-		index = 0
+		setDisplayFrames(resolveDevice(r), []Frame{frame}, false, CustomSource{
+			Type:   "qr",
+			Params: map[string]interface{}{"data": req.Data, "duration": req.Duration},
+		})
 		mutex.Unlock()
 
 		log.Printf("📱 QR code displayed: %d chars of data", len(req.Data))
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"unicode/utf8"
+)
+
+const (
+	oledWidth  = 128
+	oledHeight = 64
+
+	// maxPolygonPoints matches MAX_POLYGON_POINTS in main.ino.
+	maxPolygonPoints = 16
+)
+
+// Canvas is a 1-bit OLED framebuffer in the layout the firmware's drawBitmap
+// expects: row-major, (width+7)/8 bytes per row, most significant bit first.
+type Canvas struct {
+	Width  int
+	Height int
+	Pix    []int
+}
+
+func newCanvas(width, height int) *Canvas {
+	return &Canvas{
+		Width:  width,
+		Height: height,
+		Pix:    make([]int, ((width+7)/8)*height),
+	}
+}
+
+func (c *Canvas) SetPixel(x, y int) {
+	if x < 0 || x >= c.Width || y < 0 || y >= c.Height {
+		return
+	}
+	c.Pix[y*((c.Width+7)/8)+x/8] |= 0x80 >> (x % 8)
+}
+
+func (c *Canvas) Pixel(x, y int) bool {
+	if x < 0 || x >= c.Width || y < 0 || y >= c.Height {
+		return false
+	}
+	return c.Pix[y*((c.Width+7)/8)+x/8]&(0x80>>(x%8)) != 0
+}
+
+func (c *Canvas) FillRect(x, y, w, h int) {
+	for py := y; py < y+h; py++ {
+		for px := x; px < x+w; px++ {
+			c.SetPixel(px, py)
+		}
+	}
+}
+
+// DrawChar draws one font5x7 glyph with its top-left corner at x,y.
+// Characters missing from the font render as a space.
+func (c *Canvas) DrawChar(x, y, size int, char rune) {
+	charData, exists := font5x7[char]
+	if !exists {
+		charData = font5x7[' ']
+	}
+	for col := 0; col < 5; col++ {
+		for row := 0; row < 7; row++ {
+			if charData[col]&(1<<row) != 0 {
+				c.FillRect(x+col*size, y+row*size, size, size)
+			}
+		}
+	}
+}
+
+// DrawText draws value on a 6*size pixel advance and returns the area its
+// glyph cells cover. With wrap set it follows Adafruit GFX print(): a glyph
+// that would cross the right edge moves to the start of the next line and
+// '\n' starts a new line. Without wrap drawing stops at the right edge,
+// which is what flattened marquee frames rely on.
+func (c *Canvas) DrawText(x, y, size int, value string, wrap bool) image.Rectangle {
+	if size <= 0 {
+		size = 1
+	}
+	var area image.Rectangle
+	cursorX, cursorY := x, y
+	for _, char := range value {
+		if wrap {
+			if char == '\n' {
+				cursorX = 0
+				cursorY += 8 * size
+				continue
+			}
+			if char == '\r' {
+				continue
+			}
+			if cursorX+6*size > c.Width {
+				cursorX = 0
+				cursorY += 8 * size
+			}
+		}
+		c.DrawChar(cursorX, cursorY, size, char)
+		area = area.Union(image.Rect(cursorX, cursorY, cursorX+5*size, cursorY+7*size))
+		cursorX += 6 * size
+		if !wrap && cursorX >= c.Width {
+			break
+		}
+	}
+	return area
+}
+
+// measureText is the width DrawText advances over for value without
+// wrapping: 6*size pixels for every font5x7 cell. It counts runes, so a
+// multi-byte character takes one cell like it does when drawn.
+func measureText(value string, size int) int {
+	if size <= 0 {
+		size = 1
+	}
+	return utf8.RuneCountInString(value) * 6 * size
+}
+
+// DrawBitmap draws a w x h bitmap with (w+7)/8 bytes per row, clipping any
+// part that falls outside the canvas the way Adafruit GFX drawBitmap does.
+func (c *Canvas) DrawBitmap(x, y, w, h int, data []byte) {
+	bytesPerRow := (w + 7) / 8
+	for row := 0; row < h; row++ {
+		for col := 0; col < w; col++ {
+			i := row*bytesPerRow + col/8
+			if i < len(data) && data[i]&(0x80>>(col%8)) != 0 {
+				c.SetPixel(x+col, y+row)
+			}
+		}
+	}
+}
+
+// The vector primitives below follow Adafruit GFX pixel for pixel so the
+// preview matches drawLine, drawCircle and friends on the device.
+
+func (c *Canvas) hLine(x, y, w int) { c.FillRect(x, y, w, 1) }
+func (c *Canvas) vLine(x, y, h int) { c.FillRect(x, y, 1, h) }
+
+// DrawLine plots a line between two points with Adafruit's Bresenham variant.
+func (c *Canvas) DrawLine(x0, y0, x1, y1 int) {
+	steep := abs(y1-y0) > abs(x1-x0)
+	if steep {
+		x0, y0 = y0, x0
+		x1, y1 = y1, x1
+	}
+	if x0 > x1 {
+		x0, x1 = x1, x0
+		y0, y1 = y1, y0
+	}
+	dx := x1 - x0
+	dy := abs(y1 - y0)
+	err := dx / 2
+	ystep := -1
+	if y0 < y1 {
+		ystep = 1
+	}
+	for ; x0 <= x1; x0++ {
+		if steep {
+			c.SetPixel(y0, x0)
+		} else {
+			c.SetPixel(x0, y0)
+		}
+		err -= dy
+		if err < 0 {
+			y0 += ystep
+			err += dx
+		}
+	}
+}
+
+func (c *Canvas) DrawRect(x, y, w, h int) {
+	c.hLine(x, y, w)
+	c.hLine(x, y+h-1, w)
+	c.vLine(x, y, h)
+	c.vLine(x+w-1, y, h)
+}
+
+// circlePoints visits every pixel drawCircle would set.
+func circlePoints(cx, cy, r int, plot func(x, y int)) {
+	f := 1 - r
+	ddFx, ddFy := 1, -2*r
+	x, y := 0, r
+	plot(cx, cy+r)
+	plot(cx, cy-r)
+	plot(cx+r, cy)
+	plot(cx-r, cy)
+	for x < y {
+		if f >= 0 {
+			y--
+			ddFy += 2
+			f += ddFy
+		}
+		x++
+		ddFx += 2
+		f += ddFx
+		plot(cx+x, cy+y)
+		plot(cx-x, cy+y)
+		plot(cx+x, cy-y)
+		plot(cx-x, cy-y)
+		plot(cx+y, cy+x)
+		plot(cx-y, cy+x)
+		plot(cx+y, cy-x)
+		plot(cx-y, cy-x)
+	}
+}
+
+func (c *Canvas) DrawCircle(cx, cy, r int) {
+	circlePoints(cx, cy, r, c.SetPixel)
+}
+
+// drawCircleHelper draws the quarter circles selected by corner
+// (1 top-left, 2 top-right, 4 bottom-right, 8 bottom-left).
+func (c *Canvas) drawCircleHelper(cx, cy, r, corner int) {
+	f := 1 - r
+	ddFx, ddFy := 1, -2*r
+	x, y := 0, r
+	for x < y {
+		if f >= 0 {
+			y--
+			ddFy += 2
+			f += ddFy
+		}
+		x++
+		ddFx += 2
+		f += ddFx
+		if corner&0x4 != 0 {
+			c.SetPixel(cx+x, cy+y)
+			c.SetPixel(cx+y, cy+x)
+		}
+		if corner&0x2 != 0 {
+			c.SetPixel(cx+x, cy-y)
+			c.SetPixel(cx+y, cy-x)
+		}
+		if corner&0x8 != 0 {
+			c.SetPixel(cx-y, cy+x)
+			c.SetPixel(cx-x, cy+y)
+		}
+		if corner&0x1 != 0 {
+			c.SetPixel(cx-y, cy-x)
+			c.SetPixel(cx-x, cy-y)
+		}
+	}
+}
+
+// fillCircleHelper fills the right (1) and/or left (2) half of a circle,
+// stretched vertically by delta pixels.
+func (c *Canvas) fillCircleHelper(cx, cy, r, corners, delta int) {
+	f := 1 - r
+	ddFx, ddFy := 1, -2*r
+	x, y := 0, r
+	px, py := x, y
+	delta++
+	for x < y {
+		if f >= 0 {
+			y--
+			ddFy += 2
+			f += ddFy
+		}
+		x++
+		ddFx += 2
+		f += ddFx
+		if x < y+1 {
+			if corners&1 != 0 {
+				c.vLine(cx+x, cy-y, 2*y+delta)
+			}
+			if corners&2 != 0 {
+				c.vLine(cx-x, cy-y, 2*y+delta)
+			}
+		}
+		if y != py {
+			if corners&1 != 0 {
+				c.vLine(cx+py, cy-px, 2*px+delta)
+			}
+			if corners&2 != 0 {
+				c.vLine(cx-py, cy-px, 2*px+delta)
+			}
+			py = y
+		}
+		px = x
+	}
+}
+
+func (c *Canvas) FillCircle(cx, cy, r int) {
+	c.vLine(cx, cy-r, 2*r+1)
+	c.fillCircleHelper(cx, cy, r, 3, 0)
+}
+
+func (c *Canvas) DrawRoundRect(x, y, w, h, r int) {
+	r = min(r, min(w, h)/2)
+	c.hLine(x+r, y, w-2*r)
+	c.hLine(x+r, y+h-1, w-2*r)
+	c.vLine(x, y+r, h-2*r)
+	c.vLine(x+w-1, y+r, h-2*r)
+	c.drawCircleHelper(x+r, y+r, r, 1)
+	c.drawCircleHelper(x+w-r-1, y+r, r, 2)
+	c.drawCircleHelper(x+w-r-1, y+h-r-1, r, 4)
+	c.drawCircleHelper(x+r, y+h-r-1, r, 8)
+}
+
+func (c *Canvas) FillRoundRect(x, y, w, h, r int) {
+	r = min(r, min(w, h)/2)
+	c.FillRect(x+r, y, w-2*r, h)
+	c.fillCircleHelper(x+w-r-1, y+r, r, 1, h-2*r-1)
+	c.fillCircleHelper(x+r, y+r, r, 2, h-2*r-1)
+}
+
+// DrawArc draws the part of a circle outline between two angles, in degrees
+// clockwise from 12 o'clock. The sweep runs clockwise from start to end.
+func (c *Canvas) DrawArc(cx, cy, r, start, end int) {
+	sweep := ((end-start)%360 + 360) % 360
+	if sweep == 0 && end != start {
+		sweep = 360
+	}
+	start = (start%360 + 360) % 360
+	circlePoints(cx, cy, r, func(x, y int) {
+		angle := math.Atan2(float64(x-cx), float64(cy-y)) * 180 / math.Pi
+		if angle < 0 {
+			angle += 360
+		}
+		rel := angle - float64(start)
+		if rel < 0 {
+			rel += 360
+		}
+		if rel <= float64(sweep) {
+			c.SetPixel(x, y)
+		}
+	})
+}
+
+// DrawPolygon joins points given as x,y pairs into a closed outline, filling
+// the inside with even-odd scanlines when filled is set.
+func (c *Canvas) DrawPolygon(points []int, filled bool) {
+	n := len(points) / 2
+	if filled {
+		minY, maxY := points[1], points[1]
+		for i := 1; i < n; i++ {
+			minY = min(minY, points[2*i+1])
+			maxY = max(maxY, points[2*i+1])
+		}
+		for y := minY; y <= maxY; y++ {
+			var nodes []int
+			for i, j := 0, n-1; i < n; j, i = i, i+1 {
+				xi, yi := points[2*i], points[2*i+1]
+				xj, yj := points[2*j], points[2*j+1]
+				if (yi < y && yj >= y) || (yj < y && yi >= y) {
+					nodes = append(nodes, xi+(y-yi)*(xj-xi)/(yj-yi))
+				}
+			}
+			sort.Ints(nodes)
+			for k := 0; k+1 < len(nodes); k += 2 {
+				c.hLine(nodes[k], y, nodes[k+1]-nodes[k]+1)
+			}
+		}
+	}
+	for i := 0; i < n; i++ {
+		j := (i + 1) % n
+		c.DrawLine(points[2*i], points[2*i+1], points[2*j], points[2*j+1])
+	}
+}
+
+// rasterMode selects how positions are interpreted when drawing elements.
+type rasterMode int
+
+const (
+	// rasterDevice reproduces drawFrame in main.ino, which clamps text and
+	// line origins onto the screen and wraps long text.
+	rasterDevice rasterMode = iota
+	// rasterFlatten draws text exactly where it is placed and clips it at
+	// the edges, so marquee positions may start off-screen.
+	rasterFlatten
+)
+
+// ClippedElement reports a frame element that was not fully drawn.
+// Reason is "clipped" (partly off-screen), "offscreen" (nothing visible),
+// "invalid" (the firmware would skip it, such as a bitmap with bad data or
+// a rect without size) or
+// "unsupported" (the firmware ignores the element type).
+type ClippedElement struct {
+	Index  int    `json:"index"`
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// elementBitmapBytes returns the raw bytes of a bitmap element from either
+// its integer array or its packed data, with the firmware's 1KB limit.
+func elementBitmapBytes(el Element) ([]byte, error) {
+	var raw []byte
+	if el.Data != "" {
+		var err error
+		if el.Encoding == bitmapEncodingHex {
+			raw, err = hex.DecodeString(el.Data)
+		} else {
+			raw, err = base64.StdEncoding.DecodeString(el.Data)
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		raw = make([]byte, len(el.Bitmap))
+		for i, b := range el.Bitmap {
+			raw[i] = byte(b)
+		}
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("bitmap has no data")
+	}
+	if len(raw) > 1024 {
+		return nil, fmt.Errorf("bitmap is %d bytes, limit is 1024", len(raw))
+	}
+	return raw, nil
+}
+
+// DrawElement draws one frame element and returns the area it covers, which
+// may extend past the canvas, or an error for a bitmap that cannot be drawn.
+func (c *Canvas) DrawElement(el Element, mode rasterMode) (image.Rectangle, error) {
+	switch el.Type {
+	case "text":
+		x, y := el.X, el.Y
+		if mode == rasterDevice {
+			x, y = clampInt(x, 0, c.Width-1), clampInt(y, 0, c.Height-1)
+		}
+		// Text in a loaded font reaches the device as a bitmap at its
+		// exact position, so it is neither clamped nor wrapped.
+		if font := lookupFont(el.Font); font != nil {
+			return c.DrawFontText(font, el.X, el.Y, el.Size, el.Value), nil
+		}
+		return c.DrawText(x, y, el.Size, el.Value, mode == rasterDevice), nil
+
+	case "line":
+		x, y, w, h := el.X, el.Y, el.Width, el.Height
+		if w == 0 {
+			w = 1
+		}
+		if h == 0 {
+			h = 1
+		}
+		if mode == rasterDevice {
+			x, y = max(x, 0), max(y, 0)
+		}
+		c.FillRect(x, y, w, h)
+		return image.Rect(x, y, x+w, y+h), nil
+
+	case "bitmap":
+		area := image.Rect(el.X, el.Y, el.X+el.Width, el.Y+el.Height)
+		if el.Width <= 0 || el.Height <= 0 {
+			return area, fmt.Errorf("bitmap has no size")
+		}
+		data, err := elementBitmapBytes(el)
+		if err != nil {
+			return area, err
+		}
+		if need := ((el.Width + 7) / 8) * el.Height; len(data) < need {
+			return area, fmt.Errorf("bitmap has %d bytes, %dx%d needs %d", len(data), el.Width, el.Height, need)
+		}
+		c.DrawBitmap(el.X, el.Y, el.Width, el.Height, data)
+		return area, nil
+
+	case "segment":
+		c.DrawLine(el.X1, el.Y1, el.X2, el.Y2)
+		area := image.Rect(el.X1, el.Y1, el.X2, el.Y2)
+		area.Max = area.Max.Add(image.Pt(1, 1))
+		return area, nil
+
+	case "rect":
+		area := image.Rect(el.X, el.Y, el.X+el.Width, el.Y+el.Height)
+		if el.Width <= 0 || el.Height <= 0 {
+			return area, fmt.Errorf("rect has no size")
+		}
+		switch {
+		case el.Filled && el.Radius > 0:
+			c.FillRoundRect(el.X, el.Y, el.Width, el.Height, el.Radius)
+		case el.Filled:
+			c.FillRect(el.X, el.Y, el.Width, el.Height)
+		case el.Radius > 0:
+			c.DrawRoundRect(el.X, el.Y, el.Width, el.Height, el.Radius)
+		default:
+			c.DrawRect(el.X, el.Y, el.Width, el.Height)
+		}
+		return area, nil
+
+	case "circle", "arc":
+		area := image.Rect(el.X-el.Radius, el.Y-el.Radius, el.X+el.Radius+1, el.Y+el.Radius+1)
+		if el.Radius < 0 {
+			return area, fmt.Errorf("%s has a negative radius", el.Type)
+		}
+		switch {
+		case el.Type == "arc":
+			end := el.EndAngle
+			if end == 0 {
+				end = 360
+			}
+			c.DrawArc(el.X, el.Y, el.Radius, el.StartAngle, end)
+		case el.Filled:
+			c.FillCircle(el.X, el.Y, el.Radius)
+		default:
+			c.DrawCircle(el.X, el.Y, el.Radius)
+		}
+		return area, nil
+
+	case "polygon":
+		if len(el.Points) < 4 || len(el.Points) > maxPolygonPoints*2 || len(el.Points)%2 != 0 {
+			return image.Rectangle{}, fmt.Errorf("polygon needs 2 to %d x,y pairs", maxPolygonPoints)
+		}
+		var area image.Rectangle
+		for i := 0; i < len(el.Points); i += 2 {
+			area = area.Union(image.Rect(el.Points[i], el.Points[i+1], el.Points[i]+1, el.Points[i+1]+1))
+		}
+		c.DrawPolygon(el.Points, el.Filled)
+		return area, nil
+	}
+	return image.Rectangle{}, errUnsupportedElement
+}
+
+var errUnsupportedElement = fmt.Errorf("unsupported element type")
+
+// rasterizeFrameMode draws every element of a frame onto a blank 128x64
+// canvas and lists the elements that did not fully fit.
+func rasterizeFrameMode(frame Frame, mode rasterMode) (*Canvas, []ClippedElement) {
+	c := newCanvas(oledWidth, oledHeight)
+	screen := image.Rect(0, 0, c.Width, c.Height)
+	var clipped []ClippedElement
+	for i, el := range frame.Elements {
+		area, err := c.DrawElement(el, mode)
+		reason := ""
+		switch {
+		case err == errUnsupportedElement:
+			reason = "unsupported"
+		case err != nil:
+			reason = "invalid"
+		case area.Empty():
+		case !area.Overlaps(screen):
+			reason = "offscreen"
+		case !area.In(screen):
+			reason = "clipped"
+		}
+		if reason != "" {
+			clipped = append(clipped, ClippedElement{Index: i, Type: el.Type, Reason: reason})
+		}
+	}
+	return c, clipped
+}
+
+// rasterizeFrame draws a frame exactly as the ESP32 would show it.
+func rasterizeFrame(frame Frame) (*Canvas, []ClippedElement) {
+	return rasterizeFrameMode(frame, rasterDevice)
+}
+
+// Image returns the canvas as a two-colour image with every OLED pixel
+// enlarged to a scale x scale block.
+func (c *Canvas) Image(scale int) *image.Paletted {
+	if scale < 1 {
+		scale = 1
+	}
+	palette := color.Palette{color.Black, color.White}
+	img := image.NewPaletted(image.Rect(0, 0, c.Width*scale, c.Height*scale), palette)
+	for y := 0; y < c.Height; y++ {
+		for x := 0; x < c.Width; x++ {
+			if !c.Pixel(x, y) {
+				continue
+			}
+			for sy := 0; sy < scale; sy++ {
+				row := (y*scale + sy) * img.Stride
+				for sx := 0; sx < scale; sx++ {
+					img.Pix[row+x*scale+sx] = 1
+				}
+			}
+		}
+	}
+	return img
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
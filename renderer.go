@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Frames for the display cycle are rendered lazily: a device poll (or an
+// input change while dashboards are listening) calls ensureFrames, which
+// snapshots state under mutex and re-renders only the widgets whose cached
+// frames have expired or been invalidated.
+
+type renderCacheEntry struct {
+	frames   []Frame
+	revision uint64
+	expires  time.Time
+}
+
+var (
+	renderMutex sync.Mutex
+	renderCache = make(map[string]renderCacheEntry)
+
+	revisionMutex   sync.Mutex
+	globalRevision  uint64
+	widgetRevisions = make(map[string]uint64)
+
+	rendererStarted bool
+	renderRequests  = make(chan struct{}, 1)
+)
+
+// startFrameRenderer enables lazy rendering and starts the goroutine that
+// rebuilds frames after an invalidation when dashboards are subscribed.
+func startFrameRenderer() {
+	renderMutex.Lock()
+	rendererStarted = true
+	renderMutex.Unlock()
+
+	go func() {
+		for range renderRequests {
+			if hasEventSubscribers() {
+				ensureFrames()
+			}
+		}
+	}()
+
+	ensureFrames()
+}
+
+// invalidateRenderCache marks cached frames of the given widget types as
+// stale, or every cached frame when no type is given. It never blocks and
+// is safe to call while holding mutex.
+func invalidateRenderCache(widgetTypes ...string) {
+	revisionMutex.Lock()
+	if len(widgetTypes) == 0 {
+		globalRevision++
+	}
+	for _, t := range widgetTypes {
+		widgetRevisions[t]++
+	}
+	revisionMutex.Unlock()
+
+	select {
+	case renderRequests <- struct{}{}:
+	default:
+	}
+}
+
+// renderRevisions snapshots the invalidation counters. It is taken before
+// the state snapshot so an invalidation racing a render is never lost.
+func renderRevisions() func(widgetType string) uint64 {
+	revisionMutex.Lock()
+	defer revisionMutex.Unlock()
+	global := globalRevision
+	perType := make(map[string]uint64, len(widgetRevisions))
+	for t, rev := range widgetRevisions {
+		perType[t] = rev
+	}
+	return func(widgetType string) uint64 {
+		return global + perType[widgetType]
+	}
+}
+
+// ensureFrames brings the shared rotation up to date. The global mutex is
+// held only while snapshotting; widgets render outside it.
+func ensureFrames() {
+	renderMutex.Lock()
+	defer renderMutex.Unlock()
+
+	if !rendererStarted {
+		return
+	}
+
+	revisionOf := renderRevisions()
+
+	mutex.Lock()
+	localIsCustomMode := isCustomMode
+	night := isNightModeActive()
+	ctx := snapshotWidgetContext()
+	localCycleItems := make([]CycleItem, len(cycleItems))
+	copy(localCycleItems, cycleItems)
+	mutex.Unlock()
+
+	if localIsCustomMode {
+		return
+	}
+
+	if night {
+		applyAutoFrames([]Frame{renderNightFrame(ctx)}, false)
+		return
+	}
+
+	seen := make(map[string]bool, len(localCycleItems)+2)
+	render := func(ctx WidgetContext, key string, item CycleItem) []Frame {
+		seen[key] = true
+		return renderWidgetCached(ctx, key, item, revisionOf(item.Type))
+	}
+	newFrames := buildCycleFrames(ctx, localCycleItems, render)
+
+	for key := range renderCache {
+		if !seen[key] {
+			delete(renderCache, key)
+		}
+	}
+
+	applyAutoFrames(newFrames, false)
+}
+
+// renderWidgetCached returns the cached frames for key while they are fresh,
+// re-rendering the widget otherwise. The caller must hold renderMutex.
+func renderWidgetCached(ctx WidgetContext, key string, item CycleItem, revision uint64) []Frame {
+	w, ok := lookupWidget(item.Type)
+	if !ok || !item.Enabled {
+		return nil
+	}
+
+	if entry, ok := renderCache[key]; ok && entry.revision == revision {
+		if entry.expires.IsZero() || time.Now().Before(entry.expires) {
+			return entry.frames
+		}
+	}
+
+	rendered := renderWidget(ctx, key, item)
+	entry := renderCacheEntry{frames: rendered, revision: revision}
+	ttl := w.CacheTTL()
+	if iw, ok := w.(itemTTLWidget); ok {
+		ttl = iw.ItemCacheTTL(item)
+	}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	renderCache[key] = entry
+	return rendered
+}
+
+func cycleItemKey(position int, item CycleItem) string {
+	return fmt.Sprintf("%d:%s:%s", position, item.ID, item.Type)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// scheduleHorizonDays bounds how far ahead nextScheduledActive looks.
+const scheduleHorizonDays = 366
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("time %q must be HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func validateScheduleRule(rule ScheduleRule) error {
+	for _, day := range rule.Days {
+		if _, ok := weekdayNames[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("unknown day %q (use mon..sun)", day)
+		}
+	}
+	var start, end int
+	var err error
+	if rule.StartTime != "" {
+		if start, err = parseClock(rule.StartTime); err != nil {
+			return err
+		}
+	}
+	if rule.EndTime != "" {
+		if end, err = parseClock(rule.EndTime); err != nil {
+			return err
+		}
+	}
+	if rule.StartTime != "" && rule.EndTime != "" && start == end {
+		return fmt.Errorf("startTime and endTime must differ")
+	}
+	var startDate, endDate time.Time
+	if rule.StartDate != "" {
+		if startDate, err = time.Parse("2006-01-02", rule.StartDate); err != nil {
+			return fmt.Errorf("startDate must be YYYY-MM-DD")
+		}
+	}
+	if rule.EndDate != "" {
+		if endDate, err = time.Parse("2006-01-02", rule.EndDate); err != nil {
+			return fmt.Errorf("endDate must be YYYY-MM-DD")
+		}
+	}
+	if rule.StartDate != "" && rule.EndDate != "" && endDate.Before(startDate) {
+		return fmt.Errorf("endDate is before startDate")
+	}
+	return nil
+}
+
+func validateSchedule(rules []ScheduleRule) error {
+	for i, rule := range rules {
+		if err := validateScheduleRule(rule); err != nil {
+			return fmt.Errorf("schedule rule %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// ruleMatchesDay reports whether a window that opened on day is allowed by
+// the rule's weekdays and date range.
+func ruleMatchesDay(rule ScheduleRule, day time.Time) bool {
+	if len(rule.Days) > 0 {
+		matched := false
+		for _, name := range rule.Days {
+			if weekdayNames[strings.ToLower(name)] == day.Weekday() {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	date := day.Format("2006-01-02")
+	if rule.StartDate != "" && date < rule.StartDate {
+		return false
+	}
+	if rule.EndDate != "" && date > rule.EndDate {
+		return false
+	}
+	return true
+}
+
+// ruleActive evaluates one rule at now, which must already be in the
+// display location. A window whose end is before its start runs past
+// midnight and belongs to the day it opened.
+func ruleActive(rule ScheduleRule, now time.Time) bool {
+	start, end := 0, 24*60
+	if rule.StartTime != "" {
+		start, _ = parseClock(rule.StartTime)
+	}
+	if rule.EndTime != "" {
+		end, _ = parseClock(rule.EndTime)
+	}
+	minute := now.Hour()*60 + now.Minute()
+
+	if start < end {
+		return minute >= start && minute < end && ruleMatchesDay(rule, now)
+	}
+	if minute >= start {
+		return ruleMatchesDay(rule, now)
+	}
+	if minute < end {
+		return ruleMatchesDay(rule, now.AddDate(0, 0, -1))
+	}
+	return false
+}
+
+// isScheduledActive reports whether an item's schedule allows it at now.
+// An item without rules is always active; otherwise any matching rule
+// activates it.
+func isScheduledActive(item CycleItem, now time.Time) bool {
+	if len(item.Schedule) == 0 {
+		return true
+	}
+	for _, rule := range item.Schedule {
+		if ruleActive(rule, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextScheduledActive returns the first moment after now at which the item
+// becomes active. Activity can only begin at midnight or at a rule's start
+// time, so only those instants are checked.
+func nextScheduledActive(item CycleItem, now time.Time) (time.Time, bool) {
+	loc := now.Location()
+	year, month, day := now.Date()
+	for offset := 0; offset <= scheduleHorizonDays; offset++ {
+		midnight := time.Date(year, month, day+offset, 0, 0, 0, 0, loc)
+		candidates := []time.Time{midnight}
+		for _, rule := range item.Schedule {
+			if rule.StartTime == "" {
+				continue
+			}
+			start, _ := parseClock(rule.StartTime)
+			candidates = append(candidates, time.Date(year, month, day+offset, start/60, start%60, 0, 0, loc))
+		}
+
+		var best time.Time
+		for _, candidate := range candidates {
+			if !candidate.After(now) || !isScheduledActive(item, candidate) {
+				continue
+			}
+			if best.IsZero() || candidate.Before(best) {
+				best = candidate
+			}
+		}
+		if !best.IsZero() {
+			return best, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// cycleItemStatuses reports, for every item, whether its schedule allows it
+// now and when it next becomes active if not. Items that point at a media
+// asset which no longer exists render nothing, so they carry a problem; an
+// import, restore or profile can bring such an item back. The caller must
+// hold mutex.
+func cycleItemStatuses(items []CycleItem, now time.Time) []CycleItemStatus {
+	statuses := make([]CycleItemStatus, 0, len(items))
+	for _, item := range items {
+		status := CycleItemStatus{ID: item.ID, Active: isScheduledActive(item, now)}
+		if !status.Active {
+			if next, ok := nextScheduledActive(item, now); ok {
+				status.NextActive = &next
+			}
+		}
+		if item.AssetID != "" && mediaAssets[item.AssetID] == nil {
+			status.Problem = fmt.Sprintf("media asset %s not found", item.AssetID)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -10,29 +11,38 @@ import (
 	"time"
 )
 
+// currentSettings snapshots the settings view with each cycle item's
+// schedule status. The caller must hold mutex.
+func currentSettings() Settings {
+	return Settings{
+		AutoPlay:           autoPlay,
+		FrameDuration:      frameDuration,
+		EspRefreshDuration: espRefreshDuration,
+		GifFps:             gifFps,
+		ShowHeaders:        showHeaders,
+		DisplayRotation:    displayRotation,
+		FrameCount:         len(frames),
+		CurrentIndex:       index,
+		CycleItems:         cycleItems,
+		LedBrightness:      ledBrightness,
+		LedBeaconEnabled:   ledBeaconEnabled,
+		LedEffectMode:      ledEffectMode,
+		LedCustomColor:     ledCustomColor,
+		LedFlashSpeed:      ledFlashSpeed,
+		LedPulseSpeed:      ledPulseSpeed,
+		DisplayScale:       displayScale,
+		CycleItemStatus:    cycleItemStatuses(cycleItems, displayNow()),
+		ActiveProfile:      activeProfile,
+		CustomSource:       customSource,
+	}
+}
+
 func handleSettings(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method == http.MethodGet {
 		mutex.Lock()
-		settings := Settings{
-			AutoPlay:           autoPlay,
-			FrameDuration:      frameDuration,
-			EspRefreshDuration: espRefreshDuration,
-			GifFps:             gifFps,
-			ShowHeaders:        showHeaders,
-			DisplayRotation:    displayRotation,
-			FrameCount:         len(frames),
-			CurrentIndex:       index,
-			CycleItems:         cycleItems,
-			LedBrightness:      ledBrightness,
-			LedBeaconEnabled:   ledBeaconEnabled,
-			LedEffectMode:      ledEffectMode,
-			LedCustomColor:     ledCustomColor,
-			LedFlashSpeed:      ledFlashSpeed,
-			LedPulseSpeed:      ledPulseSpeed,
-			DisplayScale:       displayScale,
-		}
+		settings := currentSettings()
 		mutex.Unlock()
 		json.NewEncoder(w).Encode(settings)
 		return
@@ -59,6 +69,12 @@ func handleSettings(w http.ResponseWriter, r *http.Request) {
 			jsonError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
 			return
 		}
+		if req.CycleItems != nil {
+			if err := validateCycleItems(req.CycleItems); err != nil {
+				jsonError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
 
 		mutex.Lock()
 		var changes []string
@@ -168,30 +184,21 @@ func handleSettings(w http.ResponseWriter, r *http.Request) {
 				changes = append(changes, fmt.Sprintf("displayScale=%s", displayScale))
 			}
 		}
-		settings := Settings{
-			AutoPlay:           autoPlay,
-			FrameDuration:      frameDuration,
-			EspRefreshDuration: espRefreshDuration,
-			GifFps:             gifFps,
-			ShowHeaders:        showHeaders,
-			DisplayRotation:    displayRotation,
-			FrameCount:         len(frames),
-			CurrentIndex:       index,
-			CycleItems:         cycleItems,
-			LedBrightness:      ledBrightness,
-			LedBeaconEnabled:   ledBeaconEnabled,
-			LedEffectMode:      ledEffectMode,
-			LedCustomColor:     ledCustomColor,
-			LedFlashSpeed:      ledFlashSpeed,
-			LedPulseSpeed:      ledPulseSpeed,
-			DisplayScale:       displayScale,
+		if req.ShowHeaders != nil || req.CycleItems != nil || req.DisplayScale != nil ||
+			req.LedBrightness != nil || req.LedBeaconEnabled != nil || req.LedEffectMode != nil ||
+			req.LedCustomColor != nil || req.LedFlashSpeed != nil || req.LedPulseSpeed != nil {
+			detachProfile()
 		}
+		noteConfigChange(changes...)
+		settings := currentSettings()
 		mutex.Unlock()
 
+		invalidateRenderCache()
 		go saveConfig()
 
 		if len(changes) > 0 {
 			log.Printf("⚙️  Settings updated: %s", strings.Join(changes, ", "))
+			publishEvent("settings", settings)
 		}
 
 		json.NewEncoder(w).Encode(settings)
@@ -210,8 +217,11 @@ func handleToggleHeaders(w http.ResponseWriter, r *http.Request) {
 	mutex.Lock()
 	showHeaders = !showHeaders
 	currentState := showHeaders
+	detachProfile()
 	mutex.Unlock()
 
+	invalidateRenderCache()
+
 	log.Printf("👁️  Headers visibility toggled: showHeaders=%v", currentState)
 
 	w.Header().Set("Content-Type", "application/json")
@@ -241,14 +251,30 @@ func loadConfig() {
 	}
 	defer file.Close()
 
-	var config PersistentConfig
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		log.Printf("Error reading config.json: %v, using defaults", err)
+		return
+	}
+	config, fromVersion, err := decodeConfig(data)
+	if err != nil {
 		log.Printf("Error decoding config.json: %v, using defaults", err)
 		return
 	}
+	if fromVersion != currentConfigVersion {
+		log.Printf("Migrated config.json from schema version %d to %d", fromVersion, currentConfigVersion)
+	}
 
 	mutex.Lock()
+	applyConfig(config)
+	mutex.Unlock()
+
+	log.Println("Loaded settings from config.json")
+}
+
+// applyConfig makes a decoded config the live state, keeping the current
+// value of anything missing or out of range. The caller must hold mutex.
+func applyConfig(config PersistentConfig) {
 	showHeaders = config.ShowHeaders
 	autoPlay = config.AutoPlay
 	if config.FrameDuration >= 50 && config.FrameDuration <= 5000 {
@@ -360,9 +386,47 @@ func loadConfig() {
 				moonPhaseData.PhaseName, moonPhaseData.Illumination*100)
 		}
 	}
-	mutex.Unlock()
 
-	log.Println("Loaded settings from config.json")
+	// Overrides missing from the file are cleared rather than kept, so an
+	// import or restore leaves exactly the overrides it lists.
+	for _, dev := range devices {
+		dev.Overrides = DeviceOverrides{}
+	}
+	for id, overrides := range config.DeviceOverrides {
+		if !isValidDeviceID(id) || validateDeviceOverrides(overrides) != nil {
+			log.Printf("Ignoring invalid overrides for device %s", id)
+			continue
+		}
+		dev := lookupDevice(id)
+		if dev == nil {
+			log.Printf("Ignoring overrides for device %s: device registry is full", id)
+			continue
+		}
+		dev.Overrides = overrides
+	}
+
+	if config.NightMode != nil {
+		if err := validateNightMode(*config.NightMode); err == nil {
+			nightMode = *config.NightMode
+		} else {
+			log.Printf("Ignoring invalid night mode settings: %v", err)
+		}
+	} else {
+		nightMode = defaultNightMode()
+	}
+
+	profiles = nil
+	for _, p := range config.Profiles {
+		if err := validateProfile(p); err != nil || findProfile(p.Name) >= 0 {
+			log.Printf("Ignoring invalid profile %q", p.Name)
+			continue
+		}
+		profiles = append(profiles, p)
+	}
+	activeProfile = ""
+	if findProfile(config.ActiveProfile) >= 0 {
+		activeProfile = config.ActiveProfile
+	}
 }
 
 var saveConfigChan = make(chan struct{}, 1)
@@ -398,7 +462,55 @@ func saveConfig() {
 
 func writeConfigToDisk() {
 	mutex.Lock()
+	config := snapshotConfig()
+	history := appendConfigHistory(config, time.Now())
+	var custom *CustomContentFile
+	if customContentDirty {
+		snapshot := snapshotCustomContent(time.Now())
+		custom = &snapshot
+		customContentDirty = false
+	}
+	mutex.Unlock()
+
+	tempFile := configFile + ".tmp"
+	file, err := os.Create(tempFile)
+	if err != nil {
+		log.Printf("Error creating temp config file: %v", err)
+		return
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(config); err != nil {
+		file.Close()
+		os.Remove(tempFile)
+		log.Printf("Error encoding config: %v", err)
+		return
+	}
+	file.Close()
+
+	_ = os.Remove(configFile)
+	if err := os.Rename(tempFile, configFile); err != nil {
+		log.Printf("Error renaming config file: %v", err)
+		os.Remove(tempFile)
+		return
+	}
+
+	if history != nil {
+		writeConfigHistory(history)
+	}
+	if custom != nil {
+		writeCustomContent(*custom)
+	}
+
+	log.Println("Settings saved to config.json")
+}
+
+// snapshotConfig captures everything config.json stores. The caller must
+// hold mutex.
+func snapshotConfig() PersistentConfig {
 	config := PersistentConfig{
+		SchemaVersion:         currentConfigVersion,
 		ShowHeaders:           showHeaders,
 		AutoPlay:              autoPlay,
 		FrameDuration:         frameDuration,
@@ -433,33 +545,20 @@ func writeConfigToDisk() {
 		SpotifyRefreshToken:   spotifyCredentials.RefreshToken,
 		MoonPhaseData:         moonPhaseData,
 	}
-	mutex.Unlock()
-
-	tempFile := configFile + ".tmp"
-	file, err := os.Create(tempFile)
-	if err != nil {
-		log.Printf("Error creating temp config file: %v", err)
-		return
-	}
-
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	if err := encoder.Encode(config); err != nil {
-		file.Close()
-		os.Remove(tempFile)
-		log.Printf("Error encoding config: %v", err)
-		return
-	}
-	file.Close()
-
-	_ = os.Remove(configFile)
-	if err := os.Rename(tempFile, configFile); err != nil {
-		log.Printf("Error renaming config file: %v", err)
-		os.Remove(tempFile)
-		return
+	nightModeCopy := nightMode
+	config.NightMode = &nightModeCopy
+	config.Profiles = append([]Profile(nil), profiles...)
+	config.ActiveProfile = activeProfile
+	for id, dev := range devices {
+		if dev.Overrides == (DeviceOverrides{}) {
+			continue
+		}
+		if config.DeviceOverrides == nil {
+			config.DeviceOverrides = make(map[string]DeviceOverrides)
+		}
+		config.DeviceOverrides[id] = dev.Overrides
 	}
-
-	log.Println("Settings saved to config.json")
+	return config
 }
 
 func initializeTimezone() {
@@ -504,8 +603,10 @@ func handleTimezone(w http.ResponseWriter, r *http.Request) {
 		mutex.Lock()
 		timezoneName = req.Timezone
 		displayLocation = loc
+		noteConfigChange("timezone=" + req.Timezone)
 		mutex.Unlock()
 
+		invalidateRenderCache()
 		saveConfig()
 
 		log.Printf("🌍 Timezone updated: %s", req.Timezone)
@@ -525,20 +626,15 @@ func handleReset(w http.ResponseWriter, r *http.Request) {
 
 	mutex.Lock()
 
-	isCustomMode = false
-	isGifMode = false
+	clearSharedCustomMode()
 	showHeaders = true
 	autoPlay = true
 	frameDuration = 200
 	espRefreshDuration = 3000
 	gifFps = 0
-	cycleItems = []CycleItem{
-		{ID: "time-1", Type: "time", Label: "🕐 Time", Enabled: true, Duration: 3000},
-		{ID: "bcd-1", Type: "bcd", Label: "🔢 BCD Clock", Enabled: true, Duration: 3000},
-		{ID: "analog-1", Type: "analog", Label: "🧮 Analog Clock", Enabled: true, Duration: 3000},
-		{ID: "weather-1", Type: "weather", Label: "🌤 Weather", Enabled: true, Duration: 3000},
-	}
-	cycleItemCounter = 4
+	cycleItems = defaultCycleItems()
+	cycleItemCounter = len(cycleItems)
+	activeProfile = ""
 	bcd24HourMode = true
 	bcdShowSeconds = true
 	analogShowSeconds = false
@@ -547,8 +643,15 @@ func handleReset(w http.ResponseWriter, r *http.Request) {
 	cityLat = 12.96
 	cityLng = 77.57
 	index = 0
+	for _, dev := range devices {
+		clearDeviceCustomMode(dev)
+	}
+	noteConfigChange("reset to defaults")
 	mutex.Unlock()
 
+	invalidateRenderCache()
+	go saveConfig()
+
 	go fetchWeather()
 
 	log.Printf("🔄 System reset to defaults: city=%s, timezone=%s", currentCity, timezoneName)
@@ -599,6 +702,12 @@ func handleBCDSettings(w http.ResponseWriter, r *http.Request) {
 				changes = append(changes, "seconds=hidden")
 			}
 		}
+		for _, change := range changes {
+			noteConfigChange("bcd " + change)
+		}
+		if len(changes) > 0 {
+			detachProfile()
+		}
 		response := map[string]interface{}{
 			"bcd24HourMode":  bcd24HourMode,
 			"bcdShowSeconds": bcdShowSeconds,
@@ -606,6 +715,7 @@ func handleBCDSettings(w http.ResponseWriter, r *http.Request) {
 		}
 		mutex.Unlock()
 
+		invalidateRenderCache()
 		go saveConfig()
 
 		if len(changes) > 0 {
@@ -661,6 +771,12 @@ func handleAnalogSettings(w http.ResponseWriter, r *http.Request) {
 				changes = append(changes, "numerals=markers")
 			}
 		}
+		for _, change := range changes {
+			noteConfigChange("analog " + change)
+		}
+		if len(changes) > 0 {
+			detachProfile()
+		}
 		response := map[string]interface{}{
 			"analogShowSeconds": analogShowSeconds,
 			"analogShowRoman":   analogShowRoman,
@@ -668,6 +784,7 @@ func handleAnalogSettings(w http.ResponseWriter, r *http.Request) {
 		}
 		mutex.Unlock()
 
+		invalidateRenderCache()
 		go saveConfig()
 
 		if len(changes) > 0 {
@@ -713,12 +830,19 @@ func handleTimeSettings(w http.ResponseWriter, r *http.Request) {
 				changes = append(changes, "seconds=hidden")
 			}
 		}
+		for _, change := range changes {
+			noteConfigChange("time " + change)
+		}
+		if len(changes) > 0 {
+			detachProfile()
+		}
 		response := map[string]interface{}{
 			"timeShowSeconds": timeShowSeconds,
 			"status":          "updated",
 		}
 		mutex.Unlock()
 
+		invalidateRenderCache()
 		go saveConfig()
 
 		if len(changes) > 0 {
@@ -94,15 +94,33 @@ func startSpotifyPoller() {
 			spotifyFetching = false
 			spotifyLastFetch = time.Now()
 			spotifyFetchError = err
+			trackChanged := false
 			if err == nil {
+				trackChanged = !sameSpotifyTrack(spotifyLastTrack, track)
 				spotifyLastTrack = track
 
 			}
 			mutex.Unlock()
+
+			if err == nil {
+				invalidateRenderCache("spotify")
+			}
+			if trackChanged {
+				publishEvent("spotify", track)
+			}
 		}
 	}()
 }
 
+// sameSpotifyTrack reports whether two polls describe the same song in the
+// same play state, ignoring playback progress.
+func sameSpotifyTrack(a, b *SpotifyTrack) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Name == b.Name && a.Artist == b.Artist && a.IsPlaying == b.IsPlaying
+}
+
 func handleSpotifyAuth(w http.ResponseWriter, r *http.Request) {
 	mutex.Lock()
 	clientID := spotifyCredentials.ClientID
@@ -215,6 +233,7 @@ func handleSpotifyCallback(w http.ResponseWriter, r *http.Request) {
 	spotifyEnabled = true
 	mutex.Unlock()
 
+	invalidateRenderCache("spotify")
 	go saveConfig()
 
 	log.Println("🎵 Spotify connected successfully")
@@ -578,6 +597,7 @@ func handleSpotifySettings(w http.ResponseWriter, r *http.Request) {
 		}
 		mutex.Unlock()
 
+		invalidateRenderCache("spotify")
 		go saveConfig()
 		json.NewEncoder(w).Encode(response)
 		return
@@ -32,57 +32,59 @@ function showNoFramesMessage() {
 
 function hideNoFramesMessage() {}
 
-function loadSettings() {
-  authFetch("/api/settings")
-    .then((res) => res.json())
-    .then((data) => {
-      settings = data;
-      autoPlayEnabled = data.autoPlay;
-      frameSpeed = data.frameDuration || 200;
-      espRefreshDuration = data.espRefreshDuration || 3000;
-      gifFps = data.gifFps || 0;
-      document.getElementById("speedSlider").value = frameSpeed;
-      document.getElementById("speedValue").textContent = `${frameSpeed}ms`;
-      document.getElementById("espRefreshSlider").value = espRefreshDuration;
-      document.getElementById("espRefreshValue").textContent = `${(
-        espRefreshDuration / 1000
-      ).toFixed(1)}s`;
-      document.getElementById("gifFpsSlider").value = gifFps;
-      updateGifFpsDisplay(gifFps);
-      updateAutoPlayButton();
-      updateHeadersToggle(data.showHeaders);
+function applySettings(data) {
+  settings = data;
+  autoPlayEnabled = data.autoPlay;
+  frameSpeed = data.frameDuration || 200;
+  espRefreshDuration = data.espRefreshDuration || 3000;
+  gifFps = data.gifFps || 0;
+  document.getElementById("speedSlider").value = frameSpeed;
+  document.getElementById("speedValue").textContent = `${frameSpeed}ms`;
+  document.getElementById("espRefreshSlider").value = espRefreshDuration;
+  document.getElementById("espRefreshValue").textContent = `${(
+    espRefreshDuration / 1000
+  ).toFixed(1)}s`;
+  document.getElementById("gifFpsSlider").value = gifFps;
+  updateGifFpsDisplay(gifFps);
+  updateAutoPlayButton();
+  updateHeadersToggle(data.showHeaders);
 
-      if (typeof updateRotationToggle === "function") {
-        displayRotation = data.displayRotation || 0;
-        updateRotationToggle(data.displayRotation === 2);
-      }
+  if (typeof updateRotationToggle === "function") {
+    displayRotation = data.displayRotation || 0;
+    updateRotationToggle(data.displayRotation === 2);
+  }
 
-      if (data.cycleItems) {
-        updateDisplayCycleUI(data.cycleItems);
-      }
+  if (data.cycleItems) {
+    updateDisplayCycleUI(data.cycleItems);
+  }
 
-      if (typeof updateBeaconUI === "function") {
-        updateBeaconUI(
-          data.ledBrightness || 50,
-          data.ledBeaconEnabled !== false
-        );
-      }
+  if (typeof updateBeaconUI === "function") {
+    updateBeaconUI(
+      data.ledBrightness || 50,
+      data.ledBeaconEnabled !== false
+    );
+  }
 
-      if (typeof initLedSettings === "function") {
-        initLedSettings(
-          data.ledBeaconEnabled !== false,
-          data.ledBrightness || 50,
-          data.ledEffectMode || "auto",
-          data.ledCustomColor || "#0064FF",
-          data.ledFlashSpeed || 500,
-          data.ledPulseSpeed || 1000
-        );
-      }
+  if (typeof initLedSettings === "function") {
+    initLedSettings(
+      data.ledBeaconEnabled !== false,
+      data.ledBrightness || 50,
+      data.ledEffectMode || "auto",
+      data.ledCustomColor || "#0064FF",
+      data.ledFlashSpeed || 500,
+      data.ledPulseSpeed || 1000
+    );
+  }
 
-      if (typeof updateDisplayScaleUI === "function") {
-        updateDisplayScaleUI(data.displayScale || "normal");
-      }
-    })
+  if (typeof updateDisplayScaleUI === "function") {
+    updateDisplayScaleUI(data.displayScale || "normal");
+  }
+}
+
+function loadSettings() {
+  authFetch("/api/settings")
+    .then((res) => res.json())
+    .then(applySettings)
     .catch((err) => {
       if (err.message !== "Unauthorized") {
         console.warn("Failed to load settings:", err.message);
@@ -157,22 +159,46 @@ function sendMarquee() {
   const speed = parseInt(document.getElementById("marqueeSpeed").value);
   const maxFrames = parseInt(document.getElementById("marqueeMaxFrames").value);
   const framed = document.getElementById("marqueeFramed")?.checked || false;
+  const mode = document.getElementById("marqueeMode").value;
+  const pause = parseInt(document.getElementById("marqueePause").value);
+  const text2 = document.getElementById("marqueeText2").value;
+
+  const body = {
+    mode: mode,
+    pause: mode === "loop" ? 0 : pause,
+    maxFrames: maxFrames,
+    framed: framed,
+  };
+  if (text2) {
+    // Two lines scroll side to side, each at its own speed
+    const direction = marqueeDirection === "right" ? "right" : "left";
+    body.lines = [
+      { text: text, size: 1, speed: speed, direction: direction },
+      {
+        text: text2,
+        size: 1,
+        speed: parseInt(document.getElementById("marqueeSpeed2").value),
+        direction: direction,
+      },
+    ];
+  } else {
+    body.text = text;
+    body.direction = marqueeDirection;
+    body.size = marqueeSize;
+    body.speed = speed;
+  }
 
   authFetch("/api/custom/marquee", {
     method: "POST",
     headers: { "Content-Type": "application/json" },
-    body: JSON.stringify({
-      text: text,
-      direction: marqueeDirection,
-      size: marqueeSize,
-      speed: speed,
-      loops: 3,
-      maxFrames: maxFrames,
-      framed: framed,
-    }),
+    body: JSON.stringify(body),
   })
     .then((res) => res.json())
     .then((data) => {
+      if (data.error) {
+        alert(data.error);
+        return;
+      }
       loadSettings();
 
       startAutoPlay();
@@ -184,6 +210,57 @@ function sendMarquee() {
     });
 }
 
+function exportConfig() {
+  authFetch("/api/config/export")
+    .then((res) => res.blob())
+    .then((blob) => {
+      const link = document.createElement("a");
+      link.href = URL.createObjectURL(blob);
+      link.download = "esp-desk-config.json";
+      link.click();
+      URL.revokeObjectURL(link.href);
+    })
+    .catch((err) => {
+      if (err.message !== "Unauthorized") {
+        console.error("exportConfig error:", err);
+      }
+    });
+}
+
+function importConfig(input) {
+  const file = input.files[0];
+  input.value = "";
+  if (!file) return;
+  file
+    .text()
+    .then((text) =>
+      authFetch("/api/config/import", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: text,
+      }),
+    )
+    .then((res) => res.json())
+    .then((data) => {
+      if (data.errors) {
+        const lines = data.errors.map((e) =>
+          e.field ? `${e.field}: ${e.error}` : e.error,
+        );
+        alert("Config was not imported:\n" + lines.join("\n"));
+        return;
+      }
+      loadSettings();
+      loadNightModeSettings();
+      loadProfiles();
+      loadWeather();
+    })
+    .catch((err) => {
+      if (err.message !== "Unauthorized") {
+        console.error("importConfig error:", err);
+      }
+    });
+}
+
 function resetSystem() {
   authFetch("/api/reset", { method: "POST" })
     .then((res) => res.json())
@@ -22,6 +22,7 @@ initClipboardPaste();
 initCharCounters();
 
 function initAfterAuth() {
+  loadWidgets();
   loadSettings();
   loadCurrent();
   loadWeather();
@@ -29,10 +30,14 @@ function initAfterAuth() {
   loadBCDSettings();
   loadAnalogSettings();
   loadTimeSettings();
+  loadNightModeSettings();
+  loadProfiles();
+  loadMedia();
   loadSpotifyStatus();
   initPomodoro();
 
   startPolling();
+  connectEvents();
 }
 
 let pollingInterval = null;
@@ -118,6 +118,7 @@ async function handleLogout() {
 
   authToken = null;
   localStorage.removeItem(AUTH_TOKEN_KEY); 
+  if (typeof disconnectEvents === "function") disconnectEvents();
   showLogin();
 }
 
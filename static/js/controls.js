@@ -11,6 +11,8 @@ function setDirection(dir) {
   document
     .getElementById("dirRight")
     .classList.toggle("active", dir === "right");
+  document.getElementById("dirUp").classList.toggle("active", dir === "up");
+  document.getElementById("dirDown").classList.toggle("active", dir === "down");
 }
 
 function setMarqueeSize(size) {
@@ -356,3 +358,154 @@ function loadTimeSettings() {
       }
     });
 }
+
+let nightModeSettings = null;
+
+function saveNightMode(update) {
+  authFetch("/api/settings/night", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(update),
+  })
+    .then((res) => res.json())
+    .then((data) => {
+      if (data.nightMode) updateNightModeUI(data.nightMode);
+      else if (data.error) alert(data.error);
+    })
+    .catch((err) => {
+      if (err.message !== "Unauthorized") {
+        console.error("saveNightMode error:", err);
+      }
+    });
+}
+
+function toggleNightMode() {
+  if (!nightModeSettings) return;
+  saveNightMode({ enabled: !nightModeSettings.enabled });
+}
+
+function toggleNightLed() {
+  if (!nightModeSettings) return;
+  saveNightMode({ ledOff: !nightModeSettings.ledOff });
+}
+
+function setNightWindow() {
+  const start = document.getElementById("nightStart").value;
+  const end = document.getElementById("nightEnd").value;
+  if (!start || !end) return;
+  saveNightMode({ startTime: start, endTime: end });
+}
+
+function updateNightModeUI(nm) {
+  nightModeSettings = nm;
+  const toggle = document.getElementById("nightModeToggle");
+  if (toggle) toggle.classList.toggle("active", nm.enabled);
+  const ledToggle = document.getElementById("nightLedToggle");
+  if (ledToggle) ledToggle.classList.toggle("active", nm.ledOff);
+  const start = document.getElementById("nightStart");
+  if (start) start.value = nm.startTime;
+  const end = document.getElementById("nightEnd");
+  if (end) end.value = nm.endTime;
+}
+
+function loadNightModeSettings() {
+  authFetch("/api/settings/night")
+    .then((res) => res.json())
+    .then((data) => {
+      if (data.nightMode) updateNightModeUI(data.nightMode);
+    })
+    .catch((err) => {
+      if (err.message !== "Unauthorized") {
+        console.error("loadNightModeSettings error:", err);
+      }
+    });
+}
+
+function renderProfiles(data) {
+  const select = document.getElementById("profileSelect");
+  if (!select) return;
+  select.innerHTML = "";
+  if (data.profiles.length === 0) {
+    const option = document.createElement("option");
+    option.textContent = "No profiles saved";
+    option.value = "";
+    select.appendChild(option);
+    return;
+  }
+  data.profiles.forEach((profile) => {
+    const option = document.createElement("option");
+    option.value = profile.name;
+    option.textContent =
+      profile.name + (profile.name === data.activeProfile ? " (active)" : "");
+    option.selected = profile.name === data.activeProfile;
+    select.appendChild(option);
+  });
+}
+
+function loadProfiles() {
+  authFetch("/api/profiles")
+    .then((res) => res.json())
+    .then(renderProfiles)
+    .catch((err) => {
+      if (err.message !== "Unauthorized") {
+        console.error("loadProfiles error:", err);
+      }
+    });
+}
+
+function handleProfileResponse(res) {
+  return res.json().then((data) => {
+    if (data.error) {
+      alert(data.error);
+      return;
+    }
+    loadProfiles();
+    loadSettings();
+  });
+}
+
+function activateSelectedProfile() {
+  const name = document.getElementById("profileSelect").value;
+  if (!name) return;
+  authFetch("/api/profiles/activate", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ name: name }),
+  })
+    .then(handleProfileResponse)
+    .catch((err) => {
+      if (err.message !== "Unauthorized") {
+        console.error("activateProfile error:", err);
+      }
+    });
+}
+
+function saveCurrentAsProfile() {
+  const name = prompt("Profile name (an existing profile is overwritten):");
+  if (!name || !name.trim()) return;
+  authFetch("/api/profiles", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ name: name.trim(), capture: true }),
+  })
+    .then(handleProfileResponse)
+    .catch((err) => {
+      if (err.message !== "Unauthorized") {
+        console.error("saveProfile error:", err);
+      }
+    });
+}
+
+function deleteSelectedProfile() {
+  const name = document.getElementById("profileSelect").value;
+  if (!name || !confirm(`Delete profile "${name}"?`)) return;
+  authFetch("/api/profiles?name=" + encodeURIComponent(name), {
+    method: "DELETE",
+  })
+    .then(handleProfileResponse)
+    .catch((err) => {
+      if (err.message !== "Unauthorized") {
+        console.error("deleteProfile error:", err);
+      }
+    });
+}
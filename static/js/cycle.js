@@ -3,6 +3,7 @@ let newItemStyle = "normal";
 let cycleItemIdCounter = 0;
 let pendingSaveCount = 0;
 let lastSaveTimestamp = 0;
+let widgetCatalog = {};
 
 function renderCycleItems(items, updateLocalState = true) {
   if (updateLocalState) {
@@ -47,7 +48,7 @@ function renderCycleItems(items, updateLocalState = true) {
 
     const labelSpan = document.createElement("span");
     labelSpan.className = "cycle-label";
-    labelSpan.textContent = `${typeIcon} ${labelText}${extraInfo}`;
+    labelSpan.textContent = `${typeIcon} ${labelText}${extraInfo}${scheduleInfo(item)}${problemInfo(item)}`;
 
     const deleteBtn = document.createElement("button");
     deleteBtn.className = "cycle-delete-btn";
@@ -66,7 +67,39 @@ function renderCycleItems(items, updateLocalState = true) {
   initDisplayCycleDragDrop();
 }
 
+function loadWidgets() {
+  authFetch("/api/widgets")
+    .then((res) => res.json())
+    .then((data) => {
+      widgetCatalog = {};
+      (data.widgets || []).forEach((w) => {
+        widgetCatalog[w.type] = w;
+      });
+      populateWidgetSelect();
+    })
+    .catch((err) => {
+      if (err.message !== "Unauthorized") {
+        console.warn("Failed to load widgets:", err.message);
+      }
+    });
+}
+
+function populateWidgetSelect() {
+  const select = document.getElementById("addItemType");
+  if (!select) return;
+
+  const known = new Set(Array.from(select.options).map((o) => o.value));
+  Object.values(widgetCatalog).forEach((w) => {
+    if (known.has(w.type)) return;
+    const option = document.createElement("option");
+    option.value = w.type;
+    option.textContent = `${w.icon} ${w.name}`;
+    select.appendChild(option);
+  });
+}
+
 function getTypeIcon(type) {
+  if (widgetCatalog[type]) return widgetCatalog[type].icon;
   const icons = {
     time: "🕐",
     bcd: "🔢",
@@ -86,6 +119,28 @@ function getTypeIcon(type) {
   return icons[type] || "📋";
 }
 
+// Describe a scheduled item using the status /api/settings reports for it.
+function scheduleInfo(item) {
+  if (!item.schedule || item.schedule.length === 0) return "";
+  const statuses = (settings && settings.cycleItemStatus) || [];
+  const status = statuses.find((s) => s.id === item.id);
+  if (!status || status.active) return " ⏰";
+  if (!status.nextActive) return " ⏰ off";
+  const next = new Date(status.nextActive).toLocaleString([], {
+    weekday: "short",
+    hour: "2-digit",
+    minute: "2-digit",
+  });
+  return ` ⏰ from ${next}`;
+}
+
+// Flag items the server cannot render, such as images whose asset is gone.
+function problemInfo(item) {
+  const statuses = (settings && settings.cycleItemStatus) || [];
+  const status = statuses.find((s) => s.id === item.id);
+  return status && status.problem ? ` ⚠️ ${status.problem}` : "";
+}
+
 function truncate(str, len) {
   if (!str) return "";
   return str.length > len ? str.substring(0, len) + "..." : str;
@@ -136,7 +191,7 @@ function addCycleItem() {
 
   if (type === "image") {
     alert(
-      "Upload an image first, then use the '💾 Save to Cycle' button that appears after upload."
+      "Upload an image or GIF first, then use 'Save' after the upload or 'Add to Cycle' in the media library."
     );
     return;
   }
@@ -172,12 +227,13 @@ function addCycleItem() {
     snake: "🐍 Snake Game",
   };
 
+  const defaults = widgetCatalog[type] ? widgetCatalog[type].defaults : {};
   const newItem = {
     id: id,
     type: type,
-    label: labelMap[type] || type,
+    label: defaults.label || labelMap[type] || type,
     enabled: true,
-    duration: 3000,
+    duration: defaults.duration || 3000,
   };
 
   cycleItems.push(newItem);
@@ -230,7 +286,12 @@ function saveCycleItems() {
     body: JSON.stringify({ cycleItems: cycleItems }),
   })
     .then((res) => {
-      return res.json();
+      return res.json().then((data) => {
+        if (!res.ok) {
+          throw new Error(data.error || "Save failed");
+        }
+        return data;
+      });
     })
     .then((data) => {
       lastSaveTimestamp = Date.now();
@@ -238,6 +299,9 @@ function saveCycleItems() {
     .catch((err) => {
       if (err.message !== "Unauthorized") {
         console.error("❌ Save failed:", err);
+        alert("Could not save the display cycle: " + err.message);
+        lastSaveTimestamp = 0;
+        loadSettings();
       }
     })
     .finally(() => {
@@ -344,32 +408,51 @@ function updateDisplayCycle() {
   saveCycleItems();
 }
 
-function saveImageToCycle() {
-  if (!lastUploadedImage) {
-    alert("No image available to save! Upload an image first.");
-    return;
-  }
-
+function addAssetToCycle(asset) {
   cycleItemIdCounter++;
   const id = `image-${Date.now()}-${cycleItemIdCounter}`;
 
   const newItem = {
     id: id,
     type: "image",
-    label: "🖼 Image",
-    bitmap: lastUploadedImage.bitmap,
-    width: lastUploadedImage.width,
-    height: lastUploadedImage.height,
+    label: "🖼 " + asset.name,
+    assetId: asset.id,
     enabled: true,
-    duration: 3000,
+    duration: asset.animated ? Math.max(asset.duration, 3000) : 3000,
   };
 
   cycleItems.push(newItem);
   saveCycleItems();
   renderCycleItems(cycleItems);
 
+  setUploadStatus("success", "Saved to cycle!");
+}
+
+function saveImageToCycle() {
+  if (!lastUploadedImage) {
+    alert("No image available to save! Upload an image first.");
+    return;
+  }
+
+  if (lastUploadedImage.id) {
+    addAssetToCycle(lastUploadedImage);
+  } else {
+    cycleItemIdCounter++;
+    cycleItems.push({
+      id: `image-${Date.now()}-${cycleItemIdCounter}`,
+      type: "image",
+      label: "🖼 Image",
+      bitmap: lastUploadedImage.bitmap,
+      width: lastUploadedImage.width,
+      height: lastUploadedImage.height,
+      enabled: true,
+      duration: 3000,
+    });
+    saveCycleItems();
+    renderCycleItems(cycleItems);
+    setUploadStatus("success", "Saved to cycle!");
+  }
+
   document.getElementById("saveToCycleBtn").style.display = "none";
   lastUploadedImage = null;
-
-  setUploadStatus("success", "Saved to cycle!");
 }
@@ -0,0 +1,82 @@
+
+
+
+
+let eventSource = null;
+
+function connectEvents() {
+  if (typeof EventSource === "undefined") return;
+  if (eventSource) eventSource.close();
+
+  eventSource = new EventSource("/api/events");
+
+  
+  eventSource.addEventListener("ready", () => {
+    pauseStatePolling();
+    loadSettings();
+    loadWeather();
+    loadPomodoroState();
+  });
+
+  eventSource.addEventListener("frames", () => {
+    loadCurrentWithChangeDetection();
+  });
+
+  eventSource.addEventListener("settings", (e) => {
+    applySettings(JSON.parse(e.data));
+  });
+
+  eventSource.addEventListener("weather", (e) => {
+    applyWeather(JSON.parse(e.data));
+  });
+
+  eventSource.addEventListener("pomodoro", (e) => {
+    const data = JSON.parse(e.data);
+    if (data.session) pomodoroSession = data.session;
+    if (data.settings) pomodoroSettings = data.settings;
+    renderPomodoroUI();
+  });
+
+  eventSource.addEventListener("spotify", () => {
+    loadSpotifyStatus();
+  });
+
+  
+  eventSource.onerror = () => {
+    resumeStatePolling();
+    if (eventSource.readyState === EventSource.CLOSED) {
+      eventSource = null;
+    }
+  };
+}
+
+function disconnectEvents() {
+  if (eventSource) {
+    eventSource.close();
+    eventSource = null;
+  }
+}
+
+function pauseStatePolling() {
+  if (settingsPollingInterval) {
+    clearInterval(settingsPollingInterval);
+    settingsPollingInterval = null;
+  }
+  if (weatherInterval) {
+    clearInterval(weatherInterval);
+    weatherInterval = null;
+  }
+  cleanupPomodoro();
+}
+
+function resumeStatePolling() {
+  if (!settingsPollingInterval) {
+    settingsPollingInterval = setInterval(loadSettings, 10000);
+  }
+  if (!weatherInterval) {
+    weatherInterval = setInterval(loadWeather, 60000);
+  }
+  if (!pomodoroPollingInterval) {
+    pomodoroPollingInterval = setInterval(loadPomodoroState, 1000);
+  }
+}
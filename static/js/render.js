@@ -48,12 +48,244 @@ function drawFrame(frame) {
     } else if (el.type === "line") {
       ctx.fillStyle = "#00f3ff";
       ctx.fillRect(el.x || 0, el.y || 0, el.width || 1, el.height || 1);
+    } else if (VECTOR_TYPES.includes(el.type)) {
+      ctx.fillStyle = "#00f3ff";
+      drawVectorElement(el);
     }
   });
 
   updateModeUI(settings && settings.frameCount > 1);
 }
 
+// Vector primitives, drawn pixel for pixel like Adafruit GFX on the device
+// (see raster.go).
+const VECTOR_TYPES = ["segment", "rect", "circle", "arc", "polygon"];
+
+function plot(x, y) {
+  ctx.fillRect(x, y, 1, 1);
+}
+
+function drawVectorLine(x0, y0, x1, y1) {
+  const steep = Math.abs(y1 - y0) > Math.abs(x1 - x0);
+  if (steep) {
+    [x0, y0] = [y0, x0];
+    [x1, y1] = [y1, x1];
+  }
+  if (x0 > x1) {
+    [x0, x1] = [x1, x0];
+    [y0, y1] = [y1, y0];
+  }
+  const dx = x1 - x0;
+  const dy = Math.abs(y1 - y0);
+  let err = Math.trunc(dx / 2);
+  const ystep = y0 < y1 ? 1 : -1;
+  for (; x0 <= x1; x0++) {
+    if (steep) plot(y0, x0);
+    else plot(x0, y0);
+    err -= dy;
+    if (err < 0) {
+      y0 += ystep;
+      err += dx;
+    }
+  }
+}
+
+function circlePoints(cx, cy, r, fn) {
+  let f = 1 - r;
+  let ddFx = 1;
+  let ddFy = -2 * r;
+  let x = 0;
+  let y = r;
+  fn(cx, cy + r);
+  fn(cx, cy - r);
+  fn(cx + r, cy);
+  fn(cx - r, cy);
+  while (x < y) {
+    if (f >= 0) {
+      y--;
+      ddFy += 2;
+      f += ddFy;
+    }
+    x++;
+    ddFx += 2;
+    f += ddFx;
+    fn(cx + x, cy + y);
+    fn(cx - x, cy + y);
+    fn(cx + x, cy - y);
+    fn(cx - x, cy - y);
+    fn(cx + y, cy + x);
+    fn(cx - y, cy + x);
+    fn(cx + y, cy - x);
+    fn(cx - y, cy - x);
+  }
+}
+
+function drawCircleHelper(cx, cy, r, corner) {
+  let f = 1 - r;
+  let ddFx = 1;
+  let ddFy = -2 * r;
+  let x = 0;
+  let y = r;
+  while (x < y) {
+    if (f >= 0) {
+      y--;
+      ddFy += 2;
+      f += ddFy;
+    }
+    x++;
+    ddFx += 2;
+    f += ddFx;
+    if (corner & 0x4) {
+      plot(cx + x, cy + y);
+      plot(cx + y, cy + x);
+    }
+    if (corner & 0x2) {
+      plot(cx + x, cy - y);
+      plot(cx + y, cy - x);
+    }
+    if (corner & 0x8) {
+      plot(cx - y, cy + x);
+      plot(cx - x, cy + y);
+    }
+    if (corner & 0x1) {
+      plot(cx - y, cy - x);
+      plot(cx - x, cy - y);
+    }
+  }
+}
+
+function fillCircleHelper(cx, cy, r, corners, delta) {
+  let f = 1 - r;
+  let ddFx = 1;
+  let ddFy = -2 * r;
+  let x = 0;
+  let y = r;
+  let px = x;
+  let py = y;
+  delta++;
+  while (x < y) {
+    if (f >= 0) {
+      y--;
+      ddFy += 2;
+      f += ddFy;
+    }
+    x++;
+    ddFx += 2;
+    f += ddFx;
+    if (x < y + 1) {
+      if (corners & 1) ctx.fillRect(cx + x, cy - y, 1, 2 * y + delta);
+      if (corners & 2) ctx.fillRect(cx - x, cy - y, 1, 2 * y + delta);
+    }
+    if (y !== py) {
+      if (corners & 1) ctx.fillRect(cx + py, cy - px, 1, 2 * px + delta);
+      if (corners & 2) ctx.fillRect(cx - py, cy - px, 1, 2 * px + delta);
+      py = y;
+    }
+    px = x;
+  }
+}
+
+function drawRectElement(x, y, w, h, r, filled) {
+  r = Math.min(r, Math.trunc(Math.min(w, h) / 2));
+  if (filled) {
+    ctx.fillRect(x + r, y, w - 2 * r, h);
+    if (r > 0) {
+      fillCircleHelper(x + w - r - 1, y + r, r, 1, h - 2 * r - 1);
+      fillCircleHelper(x + r, y + r, r, 2, h - 2 * r - 1);
+    }
+    return;
+  }
+  ctx.fillRect(x + r, y, w - 2 * r, 1);
+  ctx.fillRect(x + r, y + h - 1, w - 2 * r, 1);
+  ctx.fillRect(x, y + r, 1, h - 2 * r);
+  ctx.fillRect(x + w - 1, y + r, 1, h - 2 * r);
+  if (r > 0) {
+    drawCircleHelper(x + r, y + r, r, 1);
+    drawCircleHelper(x + w - r - 1, y + r, r, 2);
+    drawCircleHelper(x + w - r - 1, y + h - r - 1, r, 4);
+    drawCircleHelper(x + r, y + h - r - 1, r, 8);
+  }
+}
+
+function drawArcElement(cx, cy, r, start, end) {
+  let sweep = (((end - start) % 360) + 360) % 360;
+  if (sweep === 0 && end !== start) sweep = 360;
+  start = ((start % 360) + 360) % 360;
+  circlePoints(cx, cy, r, (x, y) => {
+    let angle = (Math.atan2(x - cx, cy - y) * 180) / Math.PI;
+    if (angle < 0) angle += 360;
+    let rel = angle - start;
+    if (rel < 0) rel += 360;
+    if (rel <= sweep) plot(x, y);
+  });
+}
+
+function drawPolygonElement(points, filled) {
+  const n = points.length / 2;
+  if (filled) {
+    let minY = points[1];
+    let maxY = points[1];
+    for (let i = 1; i < n; i++) {
+      minY = Math.min(minY, points[2 * i + 1]);
+      maxY = Math.max(maxY, points[2 * i + 1]);
+    }
+    for (let y = minY; y <= maxY; y++) {
+      const nodes = [];
+      for (let i = 0, j = n - 1; i < n; j = i++) {
+        const xi = points[2 * i];
+        const yi = points[2 * i + 1];
+        const xj = points[2 * j];
+        const yj = points[2 * j + 1];
+        if ((yi < y && yj >= y) || (yj < y && yi >= y)) {
+          nodes.push(xi + Math.trunc(((y - yi) * (xj - xi)) / (yj - yi)));
+        }
+      }
+      nodes.sort((a, b) => a - b);
+      for (let k = 0; k + 1 < nodes.length; k += 2) {
+        ctx.fillRect(nodes[k], y, nodes[k + 1] - nodes[k] + 1, 1);
+      }
+    }
+  }
+  for (let i = 0; i < n; i++) {
+    const j = (i + 1) % n;
+    drawVectorLine(points[2 * i], points[2 * i + 1], points[2 * j], points[2 * j + 1]);
+  }
+}
+
+function drawVectorElement(el) {
+  const x = el.x || 0;
+  const y = el.y || 0;
+  const r = el.radius || 0;
+  switch (el.type) {
+    case "segment":
+      drawVectorLine(el.x1 || 0, el.y1 || 0, el.x2 || 0, el.y2 || 0);
+      break;
+    case "rect":
+      if ((el.width || 0) > 0 && (el.height || 0) > 0) {
+        drawRectElement(x, y, el.width, el.height, r, !!el.filled);
+      }
+      break;
+    case "circle":
+      if (el.filled) {
+        ctx.fillRect(x, y - r, 1, 2 * r + 1);
+        fillCircleHelper(x, y, r, 3, 0);
+      } else {
+        circlePoints(x, y, r, plot);
+      }
+      break;
+    case "arc":
+      drawArcElement(x, y, r, el.startAngle || 0, el.endAngle || 360);
+      break;
+    case "polygon": {
+      const points = el.points || [];
+      if (points.length >= 4 && points.length <= 32 && points.length % 2 === 0) {
+        drawPolygonElement(points, !!el.filled);
+      }
+      break;
+    }
+  }
+}
+
 function updateModeUI(isCustom) {
   const badge = document.getElementById("mode-badge");
   const frameCount = (settings && settings.frameCount) || 1;
@@ -16,6 +16,44 @@ function uploadFile(file) {
   const maxFrames =
     parseInt(document.getElementById("gifMaxFramesSlider").value) || 10;
   formData.append("maxFrames", maxFrames.toString());
+  formData.append("fit", document.getElementById("fitSelect").value);
+  formData.append("anchor", document.getElementById("anchorSelect").value);
+  formData.append("dither", document.getElementById("ditherSelect").value);
+  formData.append(
+    "brightness",
+    document.getElementById("ditherBrightnessSlider").value
+  );
+  formData.append(
+    "contrast",
+    document.getElementById("ditherContrastSlider").value
+  );
+  formData.append("gamma", document.getElementById("ditherGammaSlider").value);
+  formData.append(
+    "invert",
+    document.getElementById("ditherInvert").checked ? "true" : "false"
+  );
+  formData.append("speed", document.getElementById("gifSpeedSlider").value);
+  formData.append(
+    "trimStart",
+    document.getElementById("gifTrimStartSlider").value
+  );
+  formData.append("trimEnd", document.getElementById("gifTrimEndSlider").value);
+  formData.append(
+    "loopCount",
+    document.getElementById("gifLoopCountSlider").value
+  );
+  formData.append(
+    "reverse",
+    document.getElementById("gifReverse").checked ? "true" : "false"
+  );
+  formData.append(
+    "pingPong",
+    document.getElementById("gifPingPong").checked ? "true" : "false"
+  );
+  formData.append(
+    "save",
+    document.getElementById("uploadSaveToLibrary").checked ? "true" : "false"
+  );
 
   
   setUploadStatus("uploading", "Uploading...");
@@ -42,7 +80,12 @@ function uploadFile(file) {
       }
 
       
-      if (data.bitmap) {
+      if (data.asset) {
+        lastUploadedImage = data.asset;
+        document.getElementById("saveToCycleBtn").style.display =
+          "inline-block";
+        loadMedia();
+      } else if (data.bitmap) {
         lastUploadedImage = {
           bitmap: data.bitmap,
           width: data.width,
@@ -215,3 +258,114 @@ function handlePaste(e) {
     }
   }
 }
+
+let mediaAssets = [];
+
+function renderMedia(assets) {
+  mediaAssets = assets;
+  const select = document.getElementById("mediaSelect");
+  if (!select) return;
+  const previous = select.value;
+  select.innerHTML = "";
+  if (assets.length === 0) {
+    const option = document.createElement("option");
+    option.textContent = "No uploads yet";
+    option.value = "";
+    select.appendChild(option);
+  }
+  assets.forEach((asset) => {
+    const option = document.createElement("option");
+    option.value = asset.id;
+    option.textContent =
+      asset.name + (asset.animated ? ` (${asset.frameCount} frames)` : "");
+    option.selected = asset.id === previous;
+    select.appendChild(option);
+  });
+  updateMediaThumbnail();
+}
+
+function loadMedia() {
+  authFetch("/api/media")
+    .then((res) => res.json())
+    .then((data) => renderMedia(data.assets))
+    .catch((err) => {
+      if (err.message !== "Unauthorized") {
+        console.error("loadMedia error:", err);
+      }
+    });
+}
+
+function selectedMediaAsset() {
+  const id = document.getElementById("mediaSelect").value;
+  return mediaAssets.find((asset) => asset.id === id) || null;
+}
+
+function updateMediaThumbnail() {
+  const thumbnail = document.getElementById("mediaThumbnail");
+  const asset = selectedMediaAsset();
+  if (!asset) {
+    thumbnail.style.display = "none";
+    thumbnail.removeAttribute("src");
+    return;
+  }
+  thumbnail.src = `/api/media/thumbnail?id=${encodeURIComponent(asset.id)}&scale=2`;
+  thumbnail.style.display = "block";
+}
+
+function handleMediaResponse(res) {
+  return res.json().then((data) => {
+    if (data.error) {
+      alert(data.error);
+      return null;
+    }
+    loadMedia();
+    return data;
+  });
+}
+
+function showSelectedMedia() {
+  const asset = selectedMediaAsset();
+  if (!asset) return;
+  authFetch("/api/media/show", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ id: asset.id }),
+  })
+    .then(handleMediaResponse)
+    .then((data) => {
+      if (!data) return;
+      loadSettings();
+      if (asset.animated) {
+        startAutoPlay();
+      } else {
+        loadCurrent();
+      }
+    });
+}
+
+function addSelectedMediaToCycle() {
+  const asset = selectedMediaAsset();
+  if (!asset) return;
+  addAssetToCycle(asset);
+}
+
+function renameSelectedMedia() {
+  const asset = selectedMediaAsset();
+  if (!asset) return;
+  const name = prompt("New name:", asset.name);
+  if (!name) return;
+  authFetch("/api/media/rename", {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ id: asset.id, name: name.trim() }),
+  }).then(handleMediaResponse);
+}
+
+function deleteSelectedMedia() {
+  const asset = selectedMediaAsset();
+  if (!asset) return;
+  if (!confirm(`Delete "${asset.name}" from the media library?`)) return;
+  authFetch(`/api/media?id=${encodeURIComponent(asset.id)}`, {
+    method: "DELETE",
+  }).then(handleMediaResponse);
+}
@@ -69,16 +69,18 @@ function renderWeatherDisplay(data, display) {
   }
 }
 
+function applyWeather(data) {
+  const display = document.getElementById("weatherDisplay");
+  if (display && data.city) {
+    renderWeatherDisplay(data, display);
+  }
+}
+
 function loadWeather() {
   
   authFetch("/api/weather")
     .then((res) => res.json())
-    .then((data) => {
-      const display = document.getElementById("weatherDisplay");
-      if (display && data.city) {
-        renderWeatherDisplay(data, display);
-      }
-    })
+    .then(applyWeather)
     .catch((err) => {
       if (err.message !== "Unauthorized") {
         console.warn("loadWeather error:", err.message);
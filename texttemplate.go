@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+const (
+	// maxTemplateOutput bounds what a text item template may expand to; the
+	// display shows far less than this anyway.
+	maxTemplateOutput = 256
+	// maxTemplateBytes is how much raw output, before whitespace collapses,
+	// a template may write before execution is stopped.
+	maxTemplateBytes = 4 * maxTemplateOutput
+	// maxTemplateSteps bounds the range iterations of one execution, so a
+	// loop that writes nothing cannot run forever either.
+	maxTemplateSteps = 1000
+
+	templateStepFunc = "_rangeStep"
+)
+
+var (
+	errTemplateOutput = errors.New("output is too long")
+	errTemplateSteps  = fmt.Errorf("more than %d range iterations", maxTemplateSteps)
+)
+
+// limitedWriter collects template output and fails once it would exceed
+// maxTemplateBytes, which stops the template.
+type limitedWriter struct {
+	strings.Builder
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.Len()+len(p) > maxTemplateBytes {
+		w.Builder.Write(p[:maxTemplateBytes-w.Len()])
+		return 0, errTemplateOutput
+	}
+	return w.Builder.Write(p)
+}
+
+// countRangeSteps puts a call to the step function at the start of every
+// range body in the tree under node, so each iteration is counted.
+func countRangeSteps(node parse.Node, step parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			countRangeSteps(child, step)
+		}
+	case *parse.RangeNode:
+		countRangeSteps(n.List, step)
+		countRangeSteps(n.ElseList, step)
+		if n.List != nil {
+			n.List.Nodes = append([]parse.Node{step.Copy()}, n.List.Nodes...)
+		}
+	case *parse.IfNode:
+		countRangeSteps(n.List, step)
+		countRangeSteps(n.ElseList, step)
+	case *parse.WithNode:
+		countRangeSteps(n.List, step)
+		countRangeSteps(n.ElseList, step)
+	}
+}
+
+// TemplateData is what a text item template sees as ".".
+type TemplateData struct {
+	Now               time.Time
+	Time              string
+	Date              string
+	Timezone          string
+	Uptime            string
+	UptimeSeconds     int
+	Weather           WeatherData
+	Spotify           SpotifyTrack
+	SpotifyPlaying    bool
+	Pomodoro          PomodoroSession
+	PomodoroRemaining string
+	Moon              MoonPhaseData
+}
+
+func isTextTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+func newTemplateData(ctx WidgetContext) TemplateData {
+	data := TemplateData{
+		Now:               ctx.Now,
+		Time:              ctx.Now.Format("15:04"),
+		Date:              ctx.Now.Format("2006-01-02"),
+		Timezone:          ctx.Now.Format("MST"),
+		Weather:           ctx.Weather,
+		Pomodoro:          ctx.Pomodoro,
+		PomodoroRemaining: fmt.Sprintf("%02d:%02d", ctx.Pomodoro.TimeRemaining/60, ctx.Pomodoro.TimeRemaining%60),
+		Moon:              ctx.MoonPhase,
+	}
+	if !ctx.StartTime.IsZero() {
+		uptime := ctx.Now.Sub(ctx.StartTime).Round(time.Second)
+		data.Uptime = uptime.String()
+		data.UptimeSeconds = int(uptime.Seconds())
+	}
+	if ctx.SpotifyTrack != nil {
+		data.Spotify = *ctx.SpotifyTrack
+		data.SpotifyPlaying = ctx.SpotifyTrack.IsPlaying
+	}
+	return data
+}
+
+// templateFuncs are the helpers available to text item templates. Dates are
+// interpreted in the display timezone.
+func templateFuncs(now time.Time) template.FuncMap {
+	return template.FuncMap{
+		"daysUntil": func(date string) (int, error) {
+			target, err := time.ParseInLocation("2006-01-02", date, now.Location())
+			if err != nil {
+				return 0, fmt.Errorf("%q must be YYYY-MM-DD", date)
+			}
+			today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+			return int(math.Round(target.Sub(today).Hours() / 24)), nil
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"clock": func(seconds int) string {
+			return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+		},
+	}
+}
+
+// executeTextTemplate expands a text item template against ctx. Runs of
+// whitespace, including newlines, collapse to single spaces. Output past
+// maxTemplateBytes is cut off and reported as errTemplateOutput along with
+// the text written so far; too many range iterations fail the template.
+func executeTextTemplate(text string, ctx WidgetContext) (string, error) {
+	steps := 0
+	funcs := templateFuncs(ctx.Now)
+	funcs[templateStepFunc] = func() (string, error) {
+		if steps++; steps > maxTemplateSteps {
+			return "", errTemplateSteps
+		}
+		return "", nil
+	}
+	tmpl, err := template.New("text").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %s", strings.TrimPrefix(err.Error(), "template: "))
+	}
+	stepTmpl, err := template.New("step").Funcs(funcs).Parse("{{" + templateStepFunc + "}}")
+	if err != nil {
+		return "", err
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			countRangeSteps(t.Tree.Root, stepTmpl.Tree.Root.Nodes[0])
+		}
+	}
+
+	var out limitedWriter
+	err = tmpl.Execute(&out, newTemplateData(ctx))
+	result := strings.Join(strings.Fields(out.String()), " ")
+	if runes := []rune(result); len(runes) > maxTemplateOutput {
+		result = string(runes[:maxTemplateOutput])
+	}
+	if errors.Is(err, errTemplateOutput) {
+		return result, err
+	}
+	if err != nil {
+		return "", fmt.Errorf("template failed: %s", strings.TrimPrefix(err.Error(), "template: "))
+	}
+	return result, nil
+}
+
+// validateTextTemplate parses a template and runs it once against empty
+// data, which catches syntax errors, unknown functions and unknown fields
+// before the item is saved, as well as templates that write too much or
+// loop too long.
+func validateTextTemplate(text string) error {
+	if !isTextTemplate(text) {
+		return nil
+	}
+	_, err := executeTextTemplate(text, WidgetContext{Now: time.Now()})
+	if errors.Is(err, errTemplateOutput) {
+		return fmt.Errorf("template failed: %v", err)
+	}
+	return err
+}
+
+// expandTextItem returns the text to display for a text item. A template
+// that fails at render time shows a short error instead of the raw template.
+func expandTextItem(ctx WidgetContext, text string) string {
+	if !isTextTemplate(text) {
+		return text
+	}
+	// Data such as a long track name can push a valid template past the
+	// output limit; show what fit rather than an error.
+	expanded, err := executeTextTemplate(text, ctx)
+	if err != nil && !errors.Is(err, errTemplateOutput) {
+		return "template error"
+	}
+	return expanded
+}
@@ -15,6 +15,24 @@ type Element struct {
 	Bitmap    []int  `json:"bitmap,omitempty"`
 	Speed     int    `json:"speed,omitempty"`
 	Direction string `json:"direction,omitempty"`
+	Data      string `json:"data,omitempty"`
+	Encoding  string `json:"encoding,omitempty"`
+	// Font names a loaded BDF font for text; empty is the built-in 5x7.
+	Font string `json:"font,omitempty"`
+
+	// Vector primitives: segment uses x1,y1-x2,y2; rect uses x,y,width,height
+	// with an optional corner radius; circle and arc are centred on x,y;
+	// polygon joins the x,y pairs in points. Arc angles are degrees clockwise
+	// from 12 o'clock, endAngle defaulting to 360.
+	X1         int   `json:"x1,omitempty"`
+	Y1         int   `json:"y1,omitempty"`
+	X2         int   `json:"x2,omitempty"`
+	Y2         int   `json:"y2,omitempty"`
+	Radius     int   `json:"radius,omitempty"`
+	Filled     bool  `json:"filled,omitempty"`
+	StartAngle int   `json:"startAngle,omitempty"`
+	EndAngle   int   `json:"endAngle,omitempty"`
+	Points     []int `json:"points,omitempty"`
 }
 
 type Frame struct {
@@ -22,6 +40,11 @@ type Frame struct {
 	Duration int       `json:"duration"`
 	Clear    bool      `json:"clear"`
 	Elements []Element `json:"elements"`
+
+	// OwnTiming serves the frame with its own Duration instead of the
+	// device refresh interval, so animated assets in the cycle keep their
+	// frame timing.
+	OwnTiming bool `json:"-"`
 }
 
 type Settings struct {
@@ -41,6 +64,19 @@ type Settings struct {
 	LedFlashSpeed      int         `json:"ledFlashSpeed"`
 	LedPulseSpeed      int         `json:"ledPulseSpeed"`
 	DisplayScale       string      `json:"displayScale"`
+
+	CycleItemStatus []CycleItemStatus `json:"cycleItemStatus"`
+	ActiveProfile   string            `json:"activeProfile"`
+	CustomSource    *CustomSource     `json:"customSource,omitempty"`
+}
+
+// CycleItemStatus reports whether an item's schedule allows it right now
+// and, when it does not, when it next will.
+type CycleItemStatus struct {
+	ID         string     `json:"id"`
+	Active     bool       `json:"active"`
+	NextActive *time.Time `json:"nextActive,omitempty"`
+	Problem    string     `json:"problem,omitempty"`
 }
 
 type CycleItem struct {
@@ -58,6 +94,23 @@ type CycleItem struct {
 	TargetDate  string `json:"targetDate,omitempty"`
 	TargetLabel string `json:"targetLabel,omitempty"`
 	QRData      string `json:"qrData,omitempty"`
+	AssetID     string `json:"assetId,omitempty"`
+	Font        string `json:"font,omitempty"`
+	HeaderFont  string `json:"headerFont,omitempty"`
+
+	Schedule []ScheduleRule `json:"schedule,omitempty"`
+}
+
+// ScheduleRule limits when a cycle item is shown, evaluated in the display
+// timezone. Every field that is set must match. Days are "mon".."sun";
+// times are "HH:MM" and a window whose end is before its start runs past
+// midnight; dates are inclusive "YYYY-MM-DD".
+type ScheduleRule struct {
+	Days      []string `json:"days,omitempty"`
+	StartTime string   `json:"startTime,omitempty"`
+	EndTime   string   `json:"endTime,omitempty"`
+	StartDate string   `json:"startDate,omitempty"`
+	EndDate   string   `json:"endDate,omitempty"`
 }
 
 type WeatherResponse struct {
@@ -104,6 +157,7 @@ type MoonPhaseData struct {
 }
 
 type PersistentConfig struct {
+	SchemaVersion      int         `json:"schemaVersion"`
 	ShowHeaders        bool        `json:"showHeaders"`
 	AutoPlay           bool        `json:"autoPlay"`
 	FrameDuration      int         `json:"frameDuration"`
@@ -143,6 +197,36 @@ type PersistentConfig struct {
 	SpotifyRefreshToken string `json:"spotifyRefreshToken"`
 
 	MoonPhaseData MoonPhaseData `json:"moonPhaseData"`
+
+	DeviceOverrides map[string]DeviceOverrides `json:"deviceOverrides,omitempty"`
+
+	NightMode *NightMode `json:"nightMode,omitempty"`
+
+	Profiles      []Profile `json:"profiles,omitempty"`
+	ActiveProfile string    `json:"activeProfile,omitempty"`
+}
+
+// ConfigFieldError is one problem found in an imported config.
+type ConfigFieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// ConfigSnapshot is one entry of the rolling config history: the config as
+// saved, without credentials, and the changes that led to it.
+type ConfigSnapshot struct {
+	ID        int              `json:"id"`
+	Timestamp time.Time        `json:"timestamp"`
+	Changes   []string         `json:"changes"`
+	Config    PersistentConfig `json:"config"`
+}
+
+// ConfigDiffEntry is one differing path between two configs.
+type ConfigDiffEntry struct {
+	Path string      `json:"path"`
+	Op   string      `json:"op"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
 }
 
 type LoginAttempt struct {
@@ -174,10 +258,186 @@ type GifFullResponse struct {
 	GifFps     int     `json:"gifFps"`
 	Frames     []Frame `json:"frames"`
 
+	// Offset is the index of Frames[0] within the whole animation. When
+	// HasMore is set the device fetches the next window from NextOffset.
+	Offset      int  `json:"offset"`
+	TotalFrames int  `json:"totalFrames"`
+	NextOffset  int  `json:"nextOffset"`
+	HasMore     bool `json:"hasMore"`
+	LoopCount   int  `json:"loopCount,omitempty"`
+
 	LedBrightness    int    `json:"ledBrightness"`
 	LedBeaconEnabled bool   `json:"ledBeaconEnabled"`
 	LedEffectMode    string `json:"ledEffectMode"`
 	LedCustomColor   string `json:"ledCustomColor"`
 	LedFlashSpeed    int    `json:"ledFlashSpeed"`
 	LedPulseSpeed    int    `json:"ledPulseSpeed"`
+	DisplayContrast  int    `json:"displayContrast"`
+}
+
+type DeviceOverrides struct {
+	EspRefreshDuration *int    `json:"espRefreshDuration,omitempty"`
+	GifFps             *int    `json:"gifFps,omitempty"`
+	DisplayRotation    *int    `json:"displayRotation,omitempty"`
+	LedBrightness      *int    `json:"ledBrightness,omitempty"`
+	LedBeaconEnabled   *bool   `json:"ledBeaconEnabled,omitempty"`
+	LedEffectMode      *string `json:"ledEffectMode,omitempty"`
+	LedCustomColor     *string `json:"ledCustomColor,omitempty"`
+	LedFlashSpeed      *int    `json:"ledFlashSpeed,omitempty"`
+	LedPulseSpeed      *int    `json:"ledPulseSpeed,omitempty"`
+}
+
+type DeviceState struct {
+	ID           string          `json:"id"`
+	Index        int             `json:"index"`
+	Frames       []Frame         `json:"-"`
+	IsCustomMode bool            `json:"isCustomMode"`
+	IsGifMode    bool            `json:"isGifMode"`
+	CustomSource *CustomSource   `json:"customSource,omitempty"`
+	MaxGifFrames int             `json:"maxGifFrames,omitempty"`
+	Overrides    DeviceOverrides `json:"overrides"`
+	FirstSeen    time.Time       `json:"firstSeen"`
+	LastSeen     time.Time       `json:"lastSeen"`
+}
+
+type FrameSettings struct {
+	EspRefreshDuration int
+	GifFps             int
+	DisplayRotation    int
+	LedBrightness      int
+	LedBeaconEnabled   bool
+	LedEffectMode      string
+	LedCustomColor     string
+	LedFlashSpeed      int
+	LedPulseSpeed      int
+	DisplayContrast    int
+	NightMode          bool
+}
+
+// Notification is a queued message that preempts the display. It is shown
+// Repeat times for Duration ms each, with a short blank blink in between,
+// while the LED beacon runs LedEffect in LedColor.
+type Notification struct {
+	ID        string    `json:"id"`
+	Text      string    `json:"text,omitempty"`
+	Bitmap    []int     `json:"bitmap,omitempty"`
+	Width     int       `json:"width,omitempty"`
+	Height    int       `json:"height,omitempty"`
+	Priority  int       `json:"priority"`
+	Duration  int       `json:"duration"`
+	Repeat    int       `json:"repeat"`
+	LedColor  string    `json:"ledColor,omitempty"`
+	LedEffect string    `json:"ledEffect,omitempty"`
+	TTL       int       `json:"ttl,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// NotificationStatus is a queued notification as listed by /api/notify.
+type NotificationStatus struct {
+	Notification
+	Active bool `json:"active"`
+}
+
+// Profile is a named bundle of cycle items, LED and display settings that
+// can be switched in one call. A profile with a Schedule activates itself
+// when one of its windows opens.
+type Profile struct {
+	Name             string         `json:"name"`
+	CycleItems       []CycleItem    `json:"cycleItems"`
+	ShowHeaders      bool           `json:"showHeaders"`
+	DisplayScale     string         `json:"displayScale"`
+	LedBrightness    int            `json:"ledBrightness"`
+	LedBeaconEnabled bool           `json:"ledBeaconEnabled"`
+	LedEffectMode    string         `json:"ledEffectMode"`
+	LedCustomColor   string         `json:"ledCustomColor"`
+	LedFlashSpeed    int            `json:"ledFlashSpeed"`
+	LedPulseSpeed    int            `json:"ledPulseSpeed"`
+	WidgetOptions    WidgetOptions  `json:"widgetOptions"`
+	Schedule         []ScheduleRule `json:"schedule,omitempty"`
+}
+
+// WidgetOptions are the clock widget settings a profile carries.
+type WidgetOptions struct {
+	BCD24HourMode     bool `json:"bcd24HourMode"`
+	BCDShowSeconds    bool `json:"bcdShowSeconds"`
+	TimeShowSeconds   bool `json:"timeShowSeconds"`
+	AnalogShowSeconds bool `json:"analogShowSeconds"`
+	AnalogShowRoman   bool `json:"analogShowRoman"`
+}
+
+// NightMode swaps the cycle for a minimal clock, quiets the LED beacon and
+// lowers the OLED contrast during a daily window in the display timezone.
+// LedBrightness caps the beacon when LedOff is false.
+type NightMode struct {
+	Enabled       bool     `json:"enabled"`
+	StartTime     string   `json:"startTime"`
+	EndTime       string   `json:"endTime"`
+	Days          []string `json:"days,omitempty"`
+	LedOff        bool     `json:"ledOff"`
+	LedBrightness int      `json:"ledBrightness"`
+	Contrast      int      `json:"contrast"`
+}
+
+// CustomSource records which endpoint produced custom content and the
+// parameters it was called with.
+type CustomSource struct {
+	Type     string                 `json:"type"`
+	Params   map[string]interface{} `json:"params,omitempty"`
+	Playback *GifPlayback           `json:"playback,omitempty"`
+}
+
+// GifPlayback shapes how an animation plays. TrimStart and TrimEnd drop
+// frames from either end of the source GIF before it is sampled; the rest
+// is applied when frames are sent. A LoopCount of 0 plays until replaced.
+type GifPlayback struct {
+	Speed     float64 `json:"speed,omitempty"`
+	Reverse   bool    `json:"reverse,omitempty"`
+	PingPong  bool    `json:"pingPong,omitempty"`
+	TrimStart int     `json:"trimStart,omitempty"`
+	TrimEnd   int     `json:"trimEnd,omitempty"`
+	LoopCount int     `json:"loopCount,omitempty"`
+}
+
+// CustomContent is custom content as stored in the sidecar file. Bitmaps
+// are base64 packed to keep the file small.
+type CustomContent struct {
+	Source    CustomSource `json:"source"`
+	IsGifMode bool         `json:"isGifMode"`
+	Frames    []Frame      `json:"frames"`
+	SavedAt   time.Time    `json:"savedAt"`
+}
+
+type CustomContentFile struct {
+	Shared  *CustomContent           `json:"shared,omitempty"`
+	Devices map[string]CustomContent `json:"devices,omitempty"`
+}
+
+// MediaAsset is an uploaded image or animation in the media library. Frames
+// are left out of listings and packed as base64 on disk.
+type MediaAsset struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Animated   bool      `json:"animated"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	FrameCount int       `json:"frameCount"`
+	Duration   int       `json:"duration"`
+	CreatedAt  time.Time `json:"createdAt"`
+	// Playback keeps an animation's upload options, so showing it again
+	// plays it the same way.
+	Playback *GifPlayback `json:"playback,omitempty"`
+	Frames   []Frame      `json:"frames,omitempty"`
+}
+
+// FontInfo describes a font text elements can name in their font field.
+// Metrics are in pixels at size 1.
+type FontInfo struct {
+	Name    string `json:"name"`
+	Family  string `json:"family,omitempty"`
+	Ascent  int    `json:"ascent"`
+	Descent int    `json:"descent"`
+	Height  int    `json:"height"`
+	Glyphs  int    `json:"glyphs"`
+	Builtin bool   `json:"builtin,omitempty"`
 }
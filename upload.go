@@ -2,14 +2,17 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	"image/gif"
 	_ "image/jpeg"
 	_ "image/png"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 
@@ -24,66 +27,124 @@ func handleGifFull(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.Header.Get("X-ESP32-Loops-Done") != "" {
+		mutex.Lock()
+		sharedFinished := finishGifLoops(resolveDevice(r))
+		mutex.Unlock()
+		if sharedFinished {
+			invalidateRenderCache()
+		}
+	}
+	ensureFrames()
+
 	mutex.Lock()
 	defer mutex.Unlock()
 
+	dev := resolveDevice(r)
+	if v, err := strconv.Atoi(r.Header.Get("X-ESP32-Max-Frames")); err == nil && v > 0 && dev != nil {
+		dev.MaxGifFrames = v
+	}
+	deviceFrames := activeFrames(dev)
+	fs := resolveFrameSettings(dev)
+	playback := activePlayback(dev)
+
 	w.Header().Set("Content-Type", "application/json")
 
 	
-	if !isGifMode || len(frames) == 0 {
+	// A queued notification needs the device polling frames, so GIF
+	// playback pauses until the queue drains.
+	if !activeGifMode(dev) || len(deviceFrames) == 0 || activeNotification(time.Now()) != nil {
 		log.Printf("📡 ESP32 check: isGifMode=false (polling mode)")
 		json.NewEncoder(w).Encode(GifFullResponse{
 			IsGifMode:        false,
-			FrameCount:       len(frames),
-			GifFps:           gifFps,
+			FrameCount:       len(deviceFrames),
+			GifFps:           fs.GifFps,
 			Frames:           nil,
-			LedBrightness:    ledBrightness,
-			LedBeaconEnabled: ledBeaconEnabled,
-			LedEffectMode:    ledEffectMode,
-			LedCustomColor:   ledCustomColor,
-			LedFlashSpeed:    ledFlashSpeed,
-			LedPulseSpeed:    ledPulseSpeed,
+			LedBrightness:    fs.LedBrightness,
+			LedBeaconEnabled: fs.LedBeaconEnabled,
+			LedEffectMode:    fs.LedEffectMode,
+			LedCustomColor:   fs.LedCustomColor,
+			LedFlashSpeed:    fs.LedFlashSpeed,
+			LedPulseSpeed:    fs.LedPulseSpeed,
+			DisplayContrast:  fs.DisplayContrast,
 		})
 		return
 	}
 
-	
-	maxFrames := 10
-	framesToSend := make([]Frame, 0, maxFrames)
+	maxFrames, maxBytes := gifFrameBudget(r)
+	offset := 0
+	if v := r.URL.Query().Get("offset"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			jsonError(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		offset = parsed
+	}
+	// Reverse and ping-pong reorder the frames; offsets count positions in
+	// this playback order.
+	order := playbackOrder(len(deviceFrames), playback)
+	// A device that walked past the end, or whose animation was replaced by
+	// a shorter one, starts over.
+	if offset >= len(order) {
+		offset = 0
+	}
 
-	
+	encoding := getBitmapEncoding(r)
 	fpsOverrideDuration := 0
-	if gifFps > 0 {
-		fpsOverrideDuration = 1000 / gifFps 
+	if fs.GifFps > 0 {
+		fpsOverrideDuration = 1000 / fs.GifFps
 	}
 
-	for i, frame := range frames {
-		if i >= maxFrames {
-			log.Printf("Warning: Limiting GIF to %d frames for ESP32 memory", maxFrames)
+	framesToSend := make([]Frame, 0, maxFrames)
+	used := 0
+	for _, i := range order[offset:] {
+		if len(framesToSend) >= maxFrames {
 			break
 		}
 
-		
-		frameCopy := frame
+		frameCopy := encodeFrameBitmaps(gifPlaybackFrame(deviceFrames[i]), encoding)
 		if fpsOverrideDuration > 0 {
 			frameCopy.Duration = fpsOverrideDuration
 		}
+		frameCopy.Duration = playbackDuration(frameCopy.Duration, playback)
+		size := estimateFrameBytes(frameCopy)
+		if len(framesToSend) > 0 && used+size > maxBytes {
+			break
+		}
+		used += size
 		framesToSend = append(framesToSend, frameCopy)
 	}
 
-	log.Printf("📡 ESP32 check: isGifMode=true (%d frames sent for local playback)", len(framesToSend))
+	loops := 0
+	if playback != nil {
+		loops = playback.LoopCount
+	}
+	next := offset + len(framesToSend)
+	hasMore := next < len(order)
+	if !hasMore {
+		next = 0
+	}
+	log.Printf("📡 ESP32 check: isGifMode=true (frames %d-%d of %d, ~%d bytes, budget %d frames/%d bytes)",
+		offset, offset+len(framesToSend)-1, len(order), used, maxFrames, maxBytes)
 
 	resp := GifFullResponse{
 		IsGifMode:        true,
 		FrameCount:       len(framesToSend),
-		GifFps:           gifFps,
+		GifFps:           fs.GifFps,
 		Frames:           framesToSend,
-		LedBrightness:    ledBrightness,
-		LedBeaconEnabled: ledBeaconEnabled,
-		LedEffectMode:    ledEffectMode,
-		LedCustomColor:   ledCustomColor,
-		LedFlashSpeed:    ledFlashSpeed,
-		LedPulseSpeed:    ledPulseSpeed,
+		Offset:           offset,
+		TotalFrames:      len(order),
+		NextOffset:       next,
+		HasMore:          hasMore,
+		LoopCount:        loops,
+		LedBrightness:    fs.LedBrightness,
+		LedBeaconEnabled: fs.LedBeaconEnabled,
+		LedEffectMode:    fs.LedEffectMode,
+		LedCustomColor:   fs.LedCustomColor,
+		LedFlashSpeed:    fs.LedFlashSpeed,
+		LedPulseSpeed:    fs.LedPulseSpeed,
+		DisplayContrast:  fs.DisplayContrast,
 	}
 
 	
@@ -98,165 +159,305 @@ func handleGifFull(w http.ResponseWriter, r *http.Request) {
 	log.Printf("📡 Sending GIF payload: %d bytes", len(jsonData))
 
 	
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(jsonData)))
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonData)
+	writePayload(w, r, jsonData)
 }
 
+const (
+	defaultGifMaxFrames = 10
+	maxGifPageFrames    = 60
 
+	// defaultGifPayloadBytes leaves the firmware's JSON buffer room to spare
+	// once the LED and display settings are added.
+	defaultGifPayloadBytes = 64 * 1024
+	minGifPayloadBytes     = 2 * 1024
+	maxGifPayloadBytes     = 512 * 1024
+)
 
+// gifFrameBudget negotiates how many frames and roughly how many bytes of
+// frame JSON a GIF response may carry. The device states its limits with the
+// X-ESP32-Max-Frames and X-ESP32-Max-Payload headers; a ?limit= query can
+// only lower the frame count further.
+func gifFrameBudget(r *http.Request) (int, int) {
+	maxFrames := 0
+	if v, err := strconv.Atoi(r.Header.Get("X-ESP32-Max-Frames")); err == nil && v > 0 {
+		maxFrames = v
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		if maxFrames == 0 || v < maxFrames {
+			maxFrames = v
+		}
+	}
+	if maxFrames == 0 {
+		maxFrames = defaultGifMaxFrames
+	}
+	if maxFrames > maxGifPageFrames {
+		maxFrames = maxGifPageFrames
+	}
+
+	maxBytes := defaultGifPayloadBytes
+	if v, err := strconv.Atoi(r.Header.Get("X-ESP32-Max-Payload")); err == nil && v > 0 {
+		maxBytes = v
+		if maxBytes < minGifPayloadBytes {
+			maxBytes = minGifPayloadBytes
+		}
+		if maxBytes > maxGifPayloadBytes {
+			maxBytes = maxGifPayloadBytes
+		}
+	}
+	return maxFrames, maxBytes
+}
 
+// gifPlaybackFrame returns frame as the firmware's local player expects it:
+// a single full-screen bitmap. Anything else is flattened.
+func gifPlaybackFrame(frame Frame) Frame {
+	if len(frame.Elements) == 1 {
+		el := frame.Elements[0]
+		if el.Type == "bitmap" && el.X == 0 && el.Y == 0 && el.Width == oledWidth && el.Height == oledHeight {
+			return frame
+		}
+	}
+	return convertFrameToBitmap(frame)
+}
 
-func handleUpload(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// estimateFrameBytes is the size a frame adds to the JSON response.
+func estimateFrameBytes(frame Frame) int {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return 0
 	}
+	return len(data) + 1
+}
+
+
+
+
 
+// uploadOptions are the conversion settings sent with an upload.
+type uploadOptions struct {
+	MaxFrames int
+	Dither    ditherOptions
+	Layout    imageLayout
+	Playback  *GifPlayback
+}
+
+func parseUploadOptions(r *http.Request) (uploadOptions, error) {
 	r.ParseMultipartForm(10 << 20)
 
+	opts := uploadOptions{MaxFrames: 10}
+	if maxFramesStr := r.FormValue("maxFrames"); maxFramesStr != "" {
+		if parsed, err := strconv.Atoi(maxFramesStr); err == nil {
+			opts.MaxFrames = parsed
+		}
+	}
+	if opts.MaxFrames < 2 {
+		opts.MaxFrames = 2
+	}
+	if opts.MaxFrames > maxGifPageFrames {
+		opts.MaxFrames = maxGifPageFrames
+	}
+
+	dither, err := parseDitherOptions(r)
+	if err != nil {
+		return opts, err
+	}
+	opts.Dither = dither
+	layout, err := parseImageLayout(r)
+	if err != nil {
+		return opts, err
+	}
+	opts.Layout = layout
+	playback, err := parseGifPlayback(r)
+	if err != nil {
+		return opts, err
+	}
+	opts.Playback = playback
+	return opts, nil
+}
+
+// maxImageDimension bounds the width and height an upload may declare. A GIF
+// is composited on a canvas the size of its logical screen, which a tiny
+// file can claim is enormous.
+const maxImageDimension = 2048
+
+// readUploadedImage reads the "file" field of an upload request and
+// converts it into display frames. It writes the error response itself and
+// reports false when the upload cannot be used.
+func readUploadedImage(w http.ResponseWriter, r *http.Request, opts uploadOptions) ([]Frame, string, string, bool) {
 	file, header, err := r.FormFile("file")
 	if err != nil {
 		http.Error(w, "Error retrieving file", http.StatusBadRequest)
-		return
+		return nil, "", "", false
 	}
 	defer file.Close()
 
-	_, format, err := image.DecodeConfig(file)
+	config, format, err := image.DecodeConfig(file)
 	if err != nil {
 		http.Error(w, "Unknown image format: "+err.Error(), http.StatusBadRequest)
-		return
+		return nil, "", "", false
+	}
+	if config.Width > maxImageDimension || config.Height > maxImageDimension {
+		http.Error(w, fmt.Sprintf("Image is %dx%d, limit is %dx%d", config.Width, config.Height, maxImageDimension, maxImageDimension), http.StatusBadRequest)
+		return nil, "", "", false
+	}
+	if err := opts.Layout.validateFor(config.Width, config.Height); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, "", "", false
 	}
 
 	file.Seek(0, 0)
 
-	mutex.Lock()
-	defer mutex.Unlock()
-	isCustomMode = true
-	index = 0
+	newFrames, err := convertImage(file, format, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, "", "", false
+	}
+	return newFrames, header.Filename, format, true
+}
+
+// convertImage turns an image into display frames: one frame for a still
+// image, up to opts.MaxFrames sampled frames for a GIF.
+func convertImage(file io.Reader, format string, opts uploadOptions) ([]Frame, error) {
+	var newFrames []Frame
+	layout := opts.Layout
 
 	if format == "gif" {
 		g, err := gif.DecodeAll(file)
 		if err != nil {
-			http.Error(w, "Failed to decode GIF", http.StatusInternalServerError)
-			return
+			return nil, errors.New("Failed to decode GIF")
 		}
 
-		frames = []Frame{}
-		isGifMode = true 
-
 		totalFrames := len(g.Image)
-
-		
-		maxFrames := 10 
-		if maxFramesStr := r.FormValue("maxFrames"); maxFramesStr != "" {
-			if parsed, err := strconv.Atoi(maxFramesStr); err == nil {
-				maxFrames = parsed
+		first, last := 0, totalFrames
+		if opts.Playback != nil {
+			first += opts.Playback.TrimStart
+			last -= opts.Playback.TrimEnd
+			if first >= last {
+				return nil, fmt.Errorf("trimStart and trimEnd leave none of the %d frames", totalFrames)
 			}
+			totalFrames = last - first
 		}
-		if maxFrames < 2 {
-			maxFrames = 2
-		}
-		if maxFrames > 20 {
-			maxFrames = 20
-		}
+
+		maxFrames := opts.MaxFrames
 		log.Printf("GIF upload: using maxFrames=%d (user setting)", maxFrames)
 
-		
-		var frameIndices []int
-		if totalFrames <= maxFrames {
-			
-			for i := 0; i < totalFrames; i++ {
-				frameIndices = append(frameIndices, i)
-			}
-			log.Printf("GIF has %d frames, using all", totalFrames)
+		delays := make([]int, totalFrames)
+		for i := range delays {
+			delays[i] = gifFrameDelay(g, first+i)
+		}
+		frameIndices, durations := sampleGIFFrames(delays, maxFrames)
+		for i := range frameIndices {
+			frameIndices[i] += first
+		}
+		if totalFrames > maxFrames {
+			log.Printf("GIF has %d frames, sampling down to %d frames by playback time", totalFrames, len(frameIndices))
 		} else {
-			
-			step := float64(totalFrames) / float64(maxFrames)
-			for i := 0; i < maxFrames; i++ {
-				frameIdx := int(float64(i) * step)
-				if frameIdx >= totalFrames {
-					frameIdx = totalFrames - 1
-				}
-				frameIndices = append(frameIndices, frameIdx)
-			}
-			log.Printf("GIF has %d frames, sampling down to %d frames (step: %.2f)", totalFrames, maxFrames, step)
+			log.Printf("GIF has %d frames, using all", totalFrames)
 		}
 
-		
-		totalOriginalDuration := 0
-		for _, delay := range g.Delay {
-			totalOriginalDuration += delay * 10
-		}
-
-		
-		for _, frameIdx := range frameIndices {
-			srcImg := g.Image[frameIdx]
-			bitmap := processImageToBitmap(srcImg, 128, 64)
-
-			var duration int
-			if totalFrames > maxFrames {
-				
-				duration = totalOriginalDuration / len(frameIndices)
-			} else {
-				duration = g.Delay[frameIdx] * 10
-			}
+		compositeGIF(g, frameIndices, func(canvas image.Image) {
+			bitmap := processImageToBitmap(canvas, opts.Layout, opts.Dither)
 
+			duration := durations[len(newFrames)]
 			if duration < 50 {
 				duration = 50
 			}
 
-			frames = append(frames, Frame{
+			newFrames = append(newFrames, Frame{
 				Version:  1,
 				Duration: duration,
 				Clear:    true,
 				Elements: []Element{
-					{Type: "bitmap", X: 0, Y: 0, Width: 128, Height: 64, Bitmap: bitmap},
+					{Type: "bitmap", X: layout.X, Y: layout.Y, Width: layout.Width, Height: layout.Height, Bitmap: bitmap},
 				},
 			})
-		}
+		})
 
 	} else {
 		img, _, err := image.Decode(file)
 		if err != nil {
-			http.Error(w, "Failed to decode image", http.StatusInternalServerError)
-			return
+			return nil, errors.New("Failed to decode image")
 		}
 
-		isGifMode = false 
-		bitmap := processImageToBitmap(img, 128, 64)
-		frames = []Frame{
+		bitmap := processImageToBitmap(img, opts.Layout, opts.Dither)
+		newFrames = []Frame{
 			{
 				Version:  1,
 				Duration: 5000,
 				Clear:    true,
 				Elements: []Element{
-					{Type: "bitmap", X: 0, Y: 0, Width: 128, Height: 64, Bitmap: bitmap},
+					{Type: "bitmap", X: layout.X, Y: layout.Y, Width: layout.Width, Height: layout.Height, Bitmap: bitmap},
 				},
 			},
 		}
 	}
+	return newFrames, nil
+}
+
+func handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	opts, err := parseUploadOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	newFrames, filename, format, ok := readUploadedImage(w, r, opts)
+	if !ok {
+		return
+	}
+	gifMode := format == "gif"
+	source := CustomSource{Type: "upload", Params: map[string]interface{}{"filename": filename, "format": format, "dither": opts.Dither.Algorithm, "fit": opts.Layout.Fit}}
+	if gifMode {
+		source.Params["maxFrames"] = opts.MaxFrames
+		source.Playback = opts.Playback
+	}
+
+	// With save=true the upload also lands in the media library, so it can
+	// be shown again or added to the cycle later.
+	saveToLibrary := r.FormValue("save") == "true"
+	var asset MediaAsset
+	var assetErr error
+	if saveToLibrary {
+		asset, assetErr = addMediaAsset(filename, newFrames, opts.Playback)
+		if assetErr == nil {
+			source.Params["assetId"] = asset.ID
+		}
+	}
+
+	mutex.Lock()
+	setDisplayFrames(resolveDevice(r), newFrames, gifMode, source)
+	currentAutoPlay := autoPlay
+	mutex.Unlock()
 
-	frameCount := len(frames)
-	if isGifMode {
-		log.Printf("🎬 GIF uploaded: %s (%d frames, local playback enabled)", header.Filename, frameCount)
+	frameCount := len(newFrames)
+	if gifMode {
+		log.Printf("🎬 GIF uploaded: %s (%d frames, local playback enabled)", filename, frameCount)
 	} else {
-		log.Printf("🖼️  Image uploaded: %s (format=%s)", header.Filename, format)
+		log.Printf("🖼️  Image uploaded: %s (format=%s)", filename, format)
 	}
 	w.Header().Set("Content-Type", "application/json")
 
 	response := map[string]interface{}{
 		"frameCount": frameCount,
-		"autoPlay":   autoPlay,
+		"autoPlay":   currentAutoPlay,
 	}
-
-	
-	if format != "gif" && frameCount == 1 {
-		el := frames[0].Elements[0]
+	if !gifMode && frameCount == 1 {
+		el := newFrames[0].Elements[0]
 		response["bitmap"] = el.Bitmap
 		response["width"] = el.Width
 		response["height"] = el.Height
-		log.Printf("Including bitmap data for save-to-cycle: %dx%d, %d bytes", el.Width, el.Height, len(el.Bitmap))
+	}
+	switch {
+	case !saveToLibrary:
+	case assetErr == nil:
+		response["assetId"] = asset.ID
+		response["asset"] = asset
+	default:
+		log.Printf("🗂️  Upload not added to the media library: %v", assetErr)
+		response["assetError"] = assetErr.Error()
 	}
 
 	json.NewEncoder(w).Encode(response)
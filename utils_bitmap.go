@@ -178,66 +178,11 @@ func calcCenteredX(text string, size int) int {
 	return x
 }
 
-// convertFrameToBitmap converts a frame with text/line elements to a frame with a single bitmap element
+// convertFrameToBitmap flattens a frame into a single full-screen bitmap
+// element. Every element type is drawn; text is placed exactly at its
+// position and clipped at the edges so marquee positions can start off-screen.
 func convertFrameToBitmap(frame Frame) Frame {
-	const width = 128
-	const height = 64
-	bytesPerRow := (width + 7) / 8 // 16 bytes per row for 128 width
-	bitmap := make([]int, bytesPerRow*height)
-
-	// Helper function to set a pixel
-	setPixel := func(px, py int) {
-		if px < 0 || px >= width || py < 0 || py >= height {
-			return
-		}
-		byteIndex := py*bytesPerRow + px/8
-		if byteIndex < len(bitmap) {
-			bitmap[byteIndex] |= (0x80 >> (px % 8))
-		}
-	}
-
-	// Render all elements
-	for _, el := range frame.Elements {
-		switch el.Type {
-		case "text":
-			// Render text element
-			currentX := el.X
-			size := el.Size
-			if size == 0 {
-				size = 1
-			}
-			for _, char := range el.Value {
-				charData, exists := font5x7[char]
-				if !exists {
-					charData = font5x7[' '] // Default to space
-				}
-				// Draw character with scaling
-				for col := 0; col < 5; col++ {
-					for row := 0; row < 7; row++ {
-						if charData[col]&(1<<row) != 0 {
-							for sx := 0; sx < size; sx++ {
-								for sy := 0; sy < size; sy++ {
-									setPixel(currentX+col*size+sx, el.Y+row*size+sy)
-								}
-							}
-						}
-					}
-				}
-				currentX += 6 * size
-				if currentX >= width {
-					break
-				}
-			}
-
-		case "line":
-			// Render line/rectangle element
-			for x := el.X; x < el.X+el.Width; x++ {
-				for y := el.Y; y < el.Y+el.Height; y++ {
-					setPixel(x, y)
-				}
-			}
-		}
-	}
+	canvas, _ := rasterizeFrameMode(frame, rasterFlatten)
 
 	// Return new frame with bitmap element
 	return Frame{
@@ -251,7 +196,7 @@ func convertFrameToBitmap(frame Frame) Frame {
 				Y:      0,
 				Width:  128,
 				Height: 64,
-				Bitmap: bitmap,
+				Bitmap: canvas.Pix,
 			},
 		},
 	}
@@ -261,38 +206,46 @@ func convertFrameToBitmap(frame Frame) Frame {
 
 
 
-func processImageToBitmap(src image.Image, width, height int) []int {
-	bounds := src.Bounds()
-	dx := bounds.Dx()
-	dy := bounds.Dy()
+// processImageToBitmap scales an image into a layout.Width x layout.Height
+// 1-bit bitmap as the layout's fit mode and anchor describe, converting it
+// with the given tone and dither settings. Uncovered pixels stay dark.
+func processImageToBitmap(src image.Image, layout imageLayout, opts ditherOptions) []int {
+	width, height := layout.Width, layout.Height
+	srcRect := layout.sourceRect(src.Bounds())
+	dx := srcRect.Dx()
+	dy := srcRect.Dy()
 
 	bytesPerRow := (width + 7) / 8
 	finalBitmap := make([]int, bytesPerRow*height)
-
-	targetW, targetH := width, height
-	ratioSrc := float64(dx) / float64(dy)
-	ratioDst := float64(width) / float64(height)
-
-	if ratioSrc > ratioDst {
-		targetH = int(float64(width) / ratioSrc)
-	} else {
-		targetW = int(float64(height) * ratioSrc)
+	if dx <= 0 || dy <= 0 {
+		return finalBitmap
 	}
 
-	offsetX := (width - targetW) / 2
-	offsetY := (height - targetH) / 2
+	dst := layout.place(dx, dy)
+	visible := dst.Intersect(image.Rect(0, 0, width, height))
+	targetW, targetH := visible.Dx(), visible.Dy()
+	if targetW <= 0 || targetH <= 0 {
+		return finalBitmap
+	}
 
+	gray := make([]float64, targetW*targetH)
 	for y := 0; y < targetH; y++ {
 		for x := 0; x < targetW; x++ {
-			srcX := int(float64(x) * float64(dx) / float64(targetW))
-			srcY := int(float64(y) * float64(dy) / float64(targetH))
+			srcX := (visible.Min.X + x - dst.Min.X) * dx / dst.Dx()
+			srcY := (visible.Min.Y + y - dst.Min.Y) * dy / dst.Dy()
 
-			r, g, b, _ := src.At(bounds.Min.X+srcX, bounds.Min.Y+srcY).RGBA()
+			r, g, b, _ := src.At(srcRect.Min.X+srcX, srcRect.Min.Y+srcY).RGBA()
 			lum := (19595*r + 38470*g + 7471*b + 1<<15) >> 24
+			gray[y*targetW+x] = opts.adjust(float64(lum))
+		}
+	}
 
-			if lum > 128 {
-				drawX := x + offsetX
-				drawY := y + offsetY
+	lit := ditherGray(gray, targetW, targetH, opts)
+	for y := 0; y < targetH; y++ {
+		for x := 0; x < targetW; x++ {
+			if lit[y*targetW+x] {
+				drawX := x + visible.Min.X
+				drawY := y + visible.Min.Y
 
 				byteIndex := drawY*bytesPerRow + drawX/8
 				if byteIndex < len(finalBitmap) {
@@ -156,6 +156,9 @@ func fetchWeather() {
 	mutex.Lock()
 	weatherData = newData
 	mutex.Unlock()
+
+	invalidateRenderCache("weather")
+	publishEvent("weather", newData)
 }
 
 func handleWeather(w http.ResponseWriter, r *http.Request) {
@@ -197,6 +200,7 @@ func handleWeather(w http.ResponseWriter, r *http.Request) {
 		currentCity = req.City
 		cityLat = req.Latitude
 		cityLng = req.Longitude
+		noteConfigChange("city=" + req.City)
 		mutex.Unlock()
 
 		go saveConfig()
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WidgetContext is a snapshot of everything widgets render from. It is taken
+// under mutex once per update so Render never touches globals.
+type WidgetContext struct {
+	Now               time.Time
+	Location          *time.Location
+	StartTime         time.Time
+	ShowHeaders       bool
+	TimeShowSeconds   bool
+	BCD24HourMode     bool
+	BCDShowSeconds    bool
+	AnalogShowSeconds bool
+	AnalogShowRoman   bool
+	Weather           WeatherData
+	Pomodoro          PomodoroSession
+	PomodoroSettings  PomodoroSettings
+	SpotifyTrack      *SpotifyTrack
+	SpotifyEnabled    bool
+	MoonPhase         MoonPhaseData
+	Media             map[string][]Frame
+	Fonts             map[string]*BitmapFont
+}
+
+// WidgetSetting describes one cycle item field a widget reads, so the
+// dashboard can build its editor without hard-coding each type.
+type WidgetSetting struct {
+	Key      string   `json:"key"`
+	Type     string   `json:"type"`
+	Label    string   `json:"label"`
+	Required bool     `json:"required,omitempty"`
+	Options  []string `json:"options,omitempty"`
+	Min      int      `json:"min,omitempty"`
+	Max      int      `json:"max,omitempty"`
+}
+
+// Widget is a display cycle item type. Render receives the item with its
+// duration already defaulted and returns the frames to add to the rotation.
+// CacheTTL is how long rendered frames stay valid when their inputs do not
+// change; zero keeps them until invalidateRenderCache is called.
+type Widget interface {
+	Type() string
+	Name() string
+	Icon() string
+	Settings() []WidgetSetting
+	Defaults() CycleItem
+	Validate(item CycleItem) error
+	Render(ctx WidgetContext, item CycleItem) []Frame
+	CacheTTL() time.Duration
+}
+
+// itemTTLWidget is implemented by widgets whose cache lifetime depends on
+// the item, such as text items that hold a template. It overrides CacheTTL.
+type itemTTLWidget interface {
+	ItemCacheTTL(item CycleItem) time.Duration
+}
+
+// widgetRenderer renders one cycle item identified by a stable cache key.
+type widgetRenderer func(ctx WidgetContext, key string, item CycleItem) []Frame
+
+// WidgetInfo is the /api/widgets description of a registered widget.
+type WidgetInfo struct {
+	Type     string          `json:"type"`
+	Name     string          `json:"name"`
+	Icon     string          `json:"icon"`
+	Settings []WidgetSetting `json:"settings"`
+	Defaults CycleItem       `json:"defaults"`
+}
+
+var (
+	widgetRegistry = make(map[string]Widget)
+	widgetOrder    []string
+)
+
+func init() {
+	for _, w := range builtinWidgets() {
+		registerWidget(w)
+	}
+}
+
+func registerWidget(w Widget) {
+	if _, exists := widgetRegistry[w.Type()]; !exists {
+		widgetOrder = append(widgetOrder, w.Type())
+	}
+	widgetRegistry[w.Type()] = w
+}
+
+func lookupWidget(widgetType string) (Widget, bool) {
+	w, ok := widgetRegistry[widgetType]
+	return w, ok
+}
+
+// displayNow returns the current time in the display timezone. The caller
+// must hold mutex.
+func displayNow() time.Time {
+	now := time.Now()
+	if displayLocation != nil {
+		now = now.In(displayLocation)
+	}
+	return now
+}
+
+// snapshotWidgetContext copies the state widgets need. The caller must hold mutex.
+func snapshotWidgetContext() WidgetContext {
+	return WidgetContext{
+		Now:               displayNow(),
+		Location:          displayLocation,
+		StartTime:         startTime,
+		ShowHeaders:       showHeaders,
+		TimeShowSeconds:   timeShowSeconds,
+		BCD24HourMode:     bcd24HourMode,
+		BCDShowSeconds:    bcdShowSeconds,
+		AnalogShowSeconds: analogShowSeconds,
+		AnalogShowRoman:   analogShowRoman,
+		Weather:           weatherData,
+		Pomodoro:          pomodoroSession,
+		PomodoroSettings:  pomodoroSettings,
+		SpotifyTrack:      spotifyLastTrack,
+		SpotifyEnabled:    spotifyEnabled,
+		MoonPhase:         moonPhaseData,
+		Media:             mediaFrames(),
+		Fonts:             bitmapFonts,
+	}
+}
+
+// renderWidget renders one cycle item, returning nil for disabled items and
+// unknown types.
+func renderWidget(ctx WidgetContext, key string, item CycleItem) []Frame {
+	if !item.Enabled {
+		return nil
+	}
+	w, ok := lookupWidget(item.Type)
+	if !ok {
+		return nil
+	}
+	if item.Duration <= 0 {
+		item.Duration = 3000
+	}
+	return w.Render(ctx, item)
+}
+
+// buildCycleFrames renders the whole display cycle for one snapshot,
+// skipping items whose schedule does not allow them at ctx.Now.
+func buildCycleFrames(ctx WidgetContext, items []CycleItem, render widgetRenderer) []Frame {
+	var newFrames []Frame
+	hasPomodoroInCycle := false
+	for i, item := range items {
+		if !item.Enabled {
+			continue
+		}
+		if item.Type == "pomodoro" {
+			hasPomodoroInCycle = true
+		}
+		if !isScheduledActive(item, ctx.Now) {
+			continue
+		}
+		newFrames = append(newFrames, render(ctx, cycleItemKey(i, item), item)...)
+	}
+
+	if ctx.PomodoroSettings.ShowInCycle && !hasPomodoroInCycle {
+		newFrames = append(newFrames, render(ctx, "auto:pomodoro", CycleItem{Type: "pomodoro", Enabled: true})...)
+	}
+
+	if len(newFrames) == 0 {
+		newFrames = render(ctx, "auto:time", CycleItem{Type: "time", Enabled: true})
+	}
+	return newFrames
+}
+
+// validateCycleItems checks every item against its widget before a cycle is
+// accepted from the dashboard.
+func validateCycleItems(items []CycleItem) error {
+	for i, item := range items {
+		w, ok := lookupWidget(item.Type)
+		if !ok {
+			return fmt.Errorf("cycle item %d: unknown type %q", i, item.Type)
+		}
+		if item.Duration < 0 || item.Duration > 600000 {
+			return fmt.Errorf("cycle item %d: duration must be between 0 and 600000", i)
+		}
+		if err := validateSchedule(item.Schedule); err != nil {
+			return fmt.Errorf("cycle item %d: %v", i, err)
+		}
+		if err := w.Validate(item); err != nil {
+			return fmt.Errorf("cycle item %d (%s): %v", i, item.Type, err)
+		}
+	}
+	return nil
+}
+
+// defaultCycleItems returns the factory display cycle.
+func defaultCycleItems() []CycleItem {
+	var items []CycleItem
+	for _, widgetType := range []string{"time", "bcd", "analog", "weather"} {
+		w, ok := lookupWidget(widgetType)
+		if !ok {
+			continue
+		}
+		item := w.Defaults()
+		item.ID = widgetType + "-1"
+		items = append(items, item)
+	}
+	return items
+}
+
+func widgetList() []WidgetInfo {
+	list := make([]WidgetInfo, 0, len(widgetOrder))
+	for _, widgetType := range widgetOrder {
+		w := widgetRegistry[widgetType]
+		settings := w.Settings()
+		if settings == nil {
+			settings = []WidgetSetting{}
+		}
+		list = append(list, WidgetInfo{
+			Type:     w.Type(),
+			Name:     w.Name(),
+			Icon:     w.Icon(),
+			Settings: settings,
+			Defaults: w.Defaults(),
+		})
+	}
+	return list
+}
+
+func handleWidgets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"widgets": widgetList()})
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// basicWidget implements Widget from plain values and functions, which keeps
+// the built-in types declarative. New widgets may implement Widget directly.
+type basicWidget struct {
+	typeName string
+	name     string
+	icon     string
+	ttl      time.Duration
+	settings []WidgetSetting
+	itemTTL  func(item CycleItem) time.Duration
+	validate func(item CycleItem) error
+	render   func(ctx WidgetContext, item CycleItem) []Frame
+}
+
+func (b *basicWidget) Type() string              { return b.typeName }
+func (b *basicWidget) Name() string              { return b.name }
+func (b *basicWidget) Icon() string              { return b.icon }
+func (b *basicWidget) Settings() []WidgetSetting { return b.settings }
+func (b *basicWidget) CacheTTL() time.Duration   { return b.ttl }
+
+func (b *basicWidget) ItemCacheTTL(item CycleItem) time.Duration {
+	if b.itemTTL == nil {
+		return b.ttl
+	}
+	return b.itemTTL(item)
+}
+
+func (b *basicWidget) Defaults() CycleItem {
+	return CycleItem{Type: b.typeName, Label: b.icon + " " + b.name, Enabled: true, Duration: 3000}
+}
+
+func (b *basicWidget) Validate(item CycleItem) error {
+	if b.validate == nil {
+		return nil
+	}
+	return b.validate(item)
+}
+
+func (b *basicWidget) Render(ctx WidgetContext, item CycleItem) []Frame {
+	return b.render(ctx, item)
+}
+
+// singleFrame adapts a one-frame generator to a widget render function.
+func singleFrame(gen func(ctx WidgetContext, item CycleItem) Frame) func(WidgetContext, CycleItem) []Frame {
+	return func(ctx WidgetContext, item CycleItem) []Frame {
+		return []Frame{gen(ctx, item)}
+	}
+}
+
+func builtinWidgets() []Widget {
+	return []Widget{
+		&basicWidget{
+			typeName: "time",
+			name:     "Time",
+			icon:     "🕐",
+			ttl:      time.Second,
+			settings: []WidgetSetting{
+				{Key: "font", Type: "font", Label: "Clock font"},
+				{Key: "headerFont", Type: "font", Label: "Header font"},
+			},
+			validate: validateFontItem,
+			render:   singleFrame(renderTimeFrame),
+		},
+		&basicWidget{typeName: "bcd", name: "BCD Clock", icon: "🔢", ttl: time.Second, render: singleFrame(func(ctx WidgetContext, item CycleItem) Frame {
+			return generateBCDFrame(item.Duration, ctx.Location, ctx.ShowHeaders, ctx.BCD24HourMode, ctx.BCDShowSeconds)
+		})},
+		&basicWidget{typeName: "analog", name: "Analog Clock", icon: "🧮", ttl: time.Second, render: singleFrame(func(ctx WidgetContext, item CycleItem) Frame {
+			return generateAnalogFrame(item.Duration, ctx.Location, ctx.ShowHeaders, ctx.AnalogShowSeconds, ctx.AnalogShowRoman)
+		})},
+		&basicWidget{typeName: "spotify", name: "Now Playing", icon: "🎵", ttl: 5 * time.Second, render: singleFrame(func(ctx WidgetContext, item CycleItem) Frame {
+			return generateSpotifyFrame(item.Duration, ctx.SpotifyTrack, ctx.SpotifyEnabled)
+		})},
+		&basicWidget{typeName: "weather", name: "Weather", icon: "🌤", ttl: 10 * time.Minute, render: singleFrame(renderWeatherFrame)},
+		&basicWidget{typeName: "uptime", name: "Uptime", icon: "⏱", ttl: time.Second, render: singleFrame(renderUptimeFrame)},
+		&basicWidget{
+			typeName: "text",
+			name:     "Message",
+			icon:     "💬",
+			settings: []WidgetSetting{
+				{Key: "text", Type: "string", Label: "Text", Required: true},
+				{Key: "style", Type: "enum", Label: "Style", Options: []string{"normal", "centered", "framed"}},
+				{Key: "size", Type: "int", Label: "Text size", Min: 1, Max: 4},
+			},
+			itemTTL:  textItemTTL,
+			validate: validateTextItem,
+			render:   singleFrame(renderTextFrame),
+		},
+		&basicWidget{
+			typeName: "image",
+			name:     "Image",
+			icon:     "🖼",
+			settings: []WidgetSetting{
+				{Key: "assetId", Type: "asset", Label: "Media asset"},
+				{Key: "bitmap", Type: "bitmap", Label: "Bitmap"},
+				{Key: "width", Type: "int", Label: "Width", Min: 1, Max: 128},
+				{Key: "height", Type: "int", Label: "Height", Min: 1, Max: 64},
+			},
+			validate: validateImageItem,
+			render:   renderImageFrames,
+		},
+		&basicWidget{typeName: "pomodoro", name: "Pomodoro", icon: "🍅", ttl: time.Second, render: singleFrame(renderPomodoroFrame)},
+		&basicWidget{
+			typeName: "countdown",
+			name:     "Countdown",
+			icon:     "⏳",
+			ttl:      time.Second,
+			settings: []WidgetSetting{
+				{Key: "targetDate", Type: "date", Label: "Target date", Required: true},
+				{Key: "targetLabel", Type: "string", Label: "Label"},
+			},
+			validate: validateCountdownItem,
+			render:   renderCountdownFrames,
+		},
+		&basicWidget{
+			typeName: "qr",
+			name:     "QR Code",
+			icon:     "📱",
+			settings: []WidgetSetting{
+				{Key: "qrData", Type: "string", Label: "Text or URL", Required: true},
+			},
+			validate: validateQRItem,
+			render: func(ctx WidgetContext, item CycleItem) []Frame {
+				if item.QRData == "" {
+					return nil
+				}
+				qrFrame, err := generateQRFrame(item.QRData, item.Duration)
+				if err != nil {
+					return nil
+				}
+				return []Frame{qrFrame}
+			},
+		},
+		&basicWidget{typeName: "moonphase", name: "Moon Phase", icon: "🌙", ttl: time.Hour, render: singleFrame(func(ctx WidgetContext, item CycleItem) Frame {
+			return generateMoonPhaseFrame(item.Duration, ctx.MoonPhase, ctx.ShowHeaders)
+		})},
+		&basicWidget{typeName: "wordclock", name: "Word Clock", icon: "🕰️", ttl: 10 * time.Second, render: singleFrame(func(ctx WidgetContext, item CycleItem) Frame {
+			return generateWordClockFrame(item.Duration, ctx.Location, ctx.ShowHeaders)
+		})},
+		&basicWidget{typeName: "snake", name: "Snake Game", icon: "🐍", ttl: 100 * time.Millisecond, render: singleFrame(func(ctx WidgetContext, item CycleItem) Frame {
+			return generateSnakeFrame(item.Duration, ctx.ShowHeaders)
+		})},
+	}
+}
+
+func renderTimeFrame(ctx WidgetContext, item CycleItem) Frame {
+	timeFormat := "15:04"
+	if ctx.TimeShowSeconds {
+		timeFormat = "15:04:05"
+	}
+	currentTime := ctx.Now.Format(timeFormat)
+	tzAbbrev, _ := ctx.Now.Zone()
+	timeMainSize := getScaledTextSize(2)
+	headerSize := getScaledTextSize(1)
+
+	timeElements := []Element{centeredFontText(ctx, item.Font, currentTime, 22, timeMainSize)}
+	if ctx.ShowHeaders {
+		timeHeaderText := "= TIME ="
+		timeElements = append([]Element{
+			centeredFontText(ctx, item.HeaderFont, timeHeaderText, 2, headerSize),
+			{Type: "line", X: 0, Y: 12, Width: 128, Height: 1},
+		}, timeElements...)
+		timeElements = append(timeElements, Element{Type: "line", X: 0, Y: 52, Width: 128, Height: 1})
+		timeElements = append(timeElements, centeredFontText(ctx, item.HeaderFont, tzAbbrev, 55, headerSize))
+	}
+	return Frame{Version: 1, Duration: item.Duration, Clear: true, Elements: timeElements}
+}
+
+// centeredFontText is a horizontally centred text element in the named
+// font. Fonts that are not loaded fall back to the built-in 5x7 font, so an
+// item keeps rendering if its font file is removed.
+func centeredFontText(ctx WidgetContext, fontName, value string, y, size int) Element {
+	font, ok := ctx.Fonts[fontName]
+	if !ok {
+		return Element{Type: "text", X: calcCenteredX(value, size), Y: y, Size: size, Value: value}
+	}
+	x := max((oledWidth-font.Measure(value, size))/2, 0)
+	return Element{Type: "text", X: x, Y: y, Size: size, Value: value, Font: fontName}
+}
+
+func validateFontItem(item CycleItem) error {
+	if err := validateFontName(item.Font); err != nil {
+		return fmt.Errorf("font: %v", err)
+	}
+	if err := validateFontName(item.HeaderFont); err != nil {
+		return fmt.Errorf("headerFont: %v", err)
+	}
+	return nil
+}
+
+func renderWeatherFrame(ctx WidgetContext, item CycleItem) Frame {
+	weather := ctx.Weather
+	aqiDisplay := ""
+	if weather.AQI > 0 {
+		aqiDisplay = fmt.Sprintf("AQI:%d", weather.AQI)
+	}
+
+	weatherMainSize := getScaledTextSize(2)
+	weatherLabelSize := getScaledTextSize(1)
+	weatherElements := []Element{
+		{Type: "text", X: calcCenteredX(weather.Temperature, weatherMainSize), Y: 20, Size: weatherMainSize, Value: weather.Temperature},
+	}
+	if ctx.ShowHeaders {
+		weatherHeaderText := "= WEATHER ="
+		weatherElements = append([]Element{
+			{Type: "text", X: calcCenteredX(weatherHeaderText, weatherLabelSize), Y: 2, Size: weatherLabelSize, Value: weatherHeaderText},
+			{Type: "line", X: 0, Y: 12, Width: 128, Height: 1},
+		}, weatherElements...)
+
+		if aqiDisplay != "" {
+			weatherElements = append(weatherElements, Element{Type: "text", X: 5, Y: 42, Size: weatherLabelSize, Value: weather.Condition})
+			weatherElements = append(weatherElements, Element{Type: "text", X: 75, Y: 42, Size: weatherLabelSize, Value: aqiDisplay})
+		} else {
+			weatherElements = append(weatherElements, Element{Type: "text", X: calcCenteredX(weather.Condition, weatherLabelSize), Y: 42, Size: weatherLabelSize, Value: weather.Condition})
+		}
+		weatherElements = append(weatherElements, Element{Type: "line", X: 0, Y: 53, Width: 128, Height: 1})
+		weatherElements = append(weatherElements, Element{Type: "text", X: calcCenteredX(weather.City, weatherLabelSize), Y: 56, Size: weatherLabelSize, Value: weather.City})
+	} else {
+		weatherElements = append(weatherElements, Element{Type: "text", X: calcCenteredX(weather.Condition, weatherLabelSize), Y: 42, Size: weatherLabelSize, Value: weather.Condition})
+		if aqiDisplay != "" {
+			weatherElements = append(weatherElements, Element{Type: "text", X: calcCenteredX(aqiDisplay, weatherLabelSize), Y: 52, Size: weatherLabelSize, Value: aqiDisplay})
+		}
+	}
+	return Frame{Version: 1, Duration: item.Duration, Clear: true, Elements: weatherElements}
+}
+
+func renderUptimeFrame(ctx WidgetContext, item CycleItem) Frame {
+	uptime := ctx.Now.Sub(ctx.StartTime).Round(time.Second).String()
+	uptimeSize := getScaledTextSize(1)
+	headerSize := getScaledTextSize(1)
+	uptimeElements := []Element{
+		{Type: "text", X: calcCenteredX(uptime, uptimeSize), Y: 28, Size: uptimeSize, Value: uptime},
+	}
+	if ctx.ShowHeaders {
+		uptimeHeaderText := "= UPTIME ="
+		uptimeElements = append([]Element{
+			{Type: "text", X: calcCenteredX(uptimeHeaderText, headerSize), Y: 2, Size: headerSize, Value: uptimeHeaderText},
+			{Type: "line", X: 0, Y: 12, Width: 128, Height: 1},
+		}, uptimeElements...)
+	}
+	return Frame{Version: 1, Duration: item.Duration, Clear: true, Elements: uptimeElements}
+}
+
+func renderPomodoroFrame(ctx WidgetContext, item CycleItem) Frame {
+	session := ctx.Pomodoro
+	pomodoroTimeStr := fmt.Sprintf("%02d:%02d", session.TimeRemaining/60, session.TimeRemaining%60)
+
+	var modeText string
+	switch session.Mode {
+	case "work":
+		modeText = "FOCUS"
+	case "break":
+		modeText = "BREAK"
+	case "longBreak":
+		modeText = "LONG BREAK"
+	default:
+		modeText = "READY"
+	}
+
+	statusText := ""
+	if session.IsPaused {
+		statusText = "PAUSED"
+	} else if !session.Active {
+		statusText = "READY"
+		modeText = "POMODORO"
+	}
+
+	cycleText := fmt.Sprintf("%d/%d", session.CyclesCompleted, ctx.PomodoroSettings.CyclesUntilLong)
+
+	pomodoroElements := []Element{
+		{Type: "text", X: calcCenteredX(pomodoroTimeStr, 2), Y: 22, Size: 2, Value: pomodoroTimeStr},
+	}
+
+	if ctx.ShowHeaders {
+		headerText := fmt.Sprintf("= %s =", modeText)
+		pomodoroElements = append([]Element{
+			{Type: "text", X: calcCenteredX(headerText, 1), Y: 2, Size: 1, Value: headerText},
+			{Type: "line", X: 0, Y: 12, Width: 128, Height: 1},
+		}, pomodoroElements...)
+
+		pomodoroElements = append(pomodoroElements, Element{Type: "line", X: 0, Y: 52, Width: 128, Height: 1})
+		if statusText != "" {
+			pomodoroElements = append(pomodoroElements, Element{Type: "text", X: 8, Y: 55, Size: 1, Value: statusText})
+		}
+		pomodoroElements = append(pomodoroElements, Element{Type: "text", X: 90, Y: 55, Size: 1, Value: cycleText})
+	} else {
+		pomodoroElements = append(pomodoroElements, Element{Type: "text", X: calcCenteredX(modeText, 1), Y: 48, Size: 1, Value: modeText})
+	}
+	return Frame{Version: 1, Duration: item.Duration, Clear: true, Elements: pomodoroElements}
+}
+
+func validateTextItem(item CycleItem) error {
+	if item.Text == "" {
+		return fmt.Errorf("text is required")
+	}
+	switch item.Style {
+	case "", "normal", "centered", "framed":
+	default:
+		return fmt.Errorf("invalid style %q", item.Style)
+	}
+	if item.Size < 0 || item.Size > 4 {
+		return fmt.Errorf("size must be between 1 and 4")
+	}
+	return validateTextTemplate(item.Text)
+}
+
+// textItemTTL keeps plain messages cached until they change and refreshes
+// templates every second, since they read clocks and live data.
+func textItemTTL(item CycleItem) time.Duration {
+	if isTextTemplate(item.Text) {
+		return time.Second
+	}
+	return 0
+}
+
+func renderTextFrame(ctx WidgetContext, item CycleItem) Frame {
+	var elements []Element
+	text := expandTextItem(ctx, item.Text)
+	textSize := item.Size
+	if textSize <= 0 {
+		textSize = 2
+	}
+
+	switch item.Style {
+	case "centered":
+		charWidth := textSize * 6
+		textWidth := len(text) * charWidth
+		x := (128 - textWidth) / 2
+		if x < 0 {
+			x = 0
+		}
+		elements = []Element{
+			{Type: "text", X: x, Y: 28, Size: textSize, Value: text},
+		}
+	case "framed":
+		elements = []Element{
+			{Type: "line", X: 0, Y: 0, Width: 128, Height: 1},
+			{Type: "line", X: 0, Y: 63, Width: 128, Height: 1},
+			{Type: "line", X: 0, Y: 0, Width: 1, Height: 64},
+			{Type: "line", X: 127, Y: 0, Width: 1, Height: 64},
+			{Type: "text", X: 8, Y: 28, Size: textSize, Value: text},
+		}
+	default:
+		elements = []Element{
+			{Type: "text", X: 4, Y: 28, Size: textSize, Value: text},
+		}
+	}
+
+	if ctx.ShowHeaders && item.Label != "" {
+		elements = append([]Element{
+			{Type: "text", X: 32, Y: 2, Size: 1, Value: "= MESSAGE ="},
+			{Type: "line", X: 0, Y: 12, Width: 128, Height: 1},
+		}, elements...)
+	}
+
+	return Frame{Version: 1, Duration: item.Duration, Clear: true, Elements: elements}
+}
+
+func validateImageItem(item CycleItem) error {
+	if item.AssetID != "" {
+		if len(item.Bitmap) > 0 {
+			return fmt.Errorf("provide assetId or bitmap, not both")
+		}
+		return nil
+	}
+	if len(item.Bitmap) == 0 {
+		return fmt.Errorf("assetId or bitmap is required")
+	}
+	if item.Width < 0 || item.Width > 128 || item.Height < 0 || item.Height > 64 {
+		return fmt.Errorf("image must fit within 128x64")
+	}
+	if len(item.Bitmap) > 1024 {
+		return fmt.Errorf("bitmap exceeds 1024 bytes")
+	}
+	return nil
+}
+
+func renderImageFrames(ctx WidgetContext, item CycleItem) []Frame {
+	if item.AssetID != "" {
+		return assetCycleFrames(ctx.Media[item.AssetID], item.Duration)
+	}
+	if len(item.Bitmap) == 0 {
+		return nil
+	}
+	elements := []Element{
+		{Type: "bitmap", X: 0, Y: 0, Width: item.Width, Height: item.Height, Bitmap: item.Bitmap},
+	}
+	return []Frame{{Version: 1, Duration: item.Duration, Clear: true, Elements: elements}}
+}
+
+func validateCountdownItem(item CycleItem) error {
+	if item.TargetDate == "" {
+		return fmt.Errorf("targetDate is required")
+	}
+	if _, err := time.Parse("2006-01-02", item.TargetDate); err != nil {
+		return fmt.Errorf("targetDate must be YYYY-MM-DD")
+	}
+	return nil
+}
+
+func renderCountdownFrames(ctx WidgetContext, item CycleItem) []Frame {
+	if item.TargetDate == "" {
+		return nil
+	}
+	targetTime, err := time.Parse("2006-01-02", item.TargetDate)
+	if err != nil {
+		return nil
+	}
+
+	remaining := targetTime.Sub(ctx.Now)
+	var countdownStr string
+	if remaining <= 0 {
+		countdownStr = "Done!"
+	} else if remaining.Hours() >= 24 {
+		days := int(remaining.Hours() / 24)
+		hours := int(remaining.Hours()) % 24
+		countdownStr = fmt.Sprintf("%dd %dh", days, hours)
+	} else if remaining.Hours() >= 1 {
+		hours := int(remaining.Hours())
+		mins := int(remaining.Minutes()) % 60
+		countdownStr = fmt.Sprintf("%dh %dm", hours, mins)
+	} else {
+		mins := int(remaining.Minutes())
+		secs := int(remaining.Seconds()) % 60
+		countdownStr = fmt.Sprintf("%dm %ds", mins, secs)
+	}
+
+	label := item.TargetLabel
+	if label == "" {
+		label = "Countdown"
+	}
+
+	countdownElements := []Element{
+		{Type: "text", X: calcCenteredX(countdownStr, 2), Y: 24, Size: 2, Value: countdownStr},
+	}
+	if ctx.ShowHeaders {
+		headerText := fmt.Sprintf("= %s =", label)
+		countdownElements = append([]Element{
+			{Type: "text", X: calcCenteredX(headerText, 1), Y: 2, Size: 1, Value: headerText},
+			{Type: "line", X: 0, Y: 12, Width: 128, Height: 1},
+		}, countdownElements...)
+		countdownElements = append(countdownElements, Element{Type: "line", X: 0, Y: 52, Width: 128, Height: 1})
+
+		dateStr := targetTime.Format("Jan 2, 2006")
+		countdownElements = append(countdownElements, Element{Type: "text", X: calcCenteredX(dateStr, 1), Y: 55, Size: 1, Value: dateStr})
+	}
+
+	return []Frame{{Version: 1, Duration: item.Duration, Clear: true, Elements: countdownElements}}
+}
+
+func validateQRItem(item CycleItem) error {
+	if item.QRData == "" {
+		return fmt.Errorf("qrData is required")
+	}
+	if _, _, _, err := generateQRBitmap(item.QRData); err != nil {
+		return fmt.Errorf("qrData cannot be encoded: %v", err)
+	}
+	return nil
+}